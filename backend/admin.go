@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"web-scraper/logging"
+	"web-scraper/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WorkerPoolInput struct {
+	Workers        *int `json:"workers" binding:"omitempty,min=0,max=64"`
+	MaxJobsPerUser *int `json:"maxJobsPerUser" binding:"omitempty,min=0"`
+}
+
+// GetWorkerPool reports the size, load and per-lane queue of the worker pool
+func GetWorkerPool(c *gin.Context) {
+	c.JSON(http.StatusOK, services.WorkerPoolStatus())
+}
+
+// UpdateWorkerPool resizes the worker pool and changes the per-user job limit at runtime.
+// Zero workers pauses processing, queued analyses wait until workers are added again.
+func UpdateWorkerPool(c *gin.Context) {
+	var input WorkerPoolInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger := logging.FromContext(c.Request.Context())
+
+	if input.Workers != nil {
+		services.ResizeWorkers(*input.Workers)
+		logger.Info("Worker pool resized", "workers", *input.Workers)
+	}
+	if input.MaxJobsPerUser != nil {
+		services.SetMaxJobsPerUser(*input.MaxJobsPerUser)
+		logger.Info("Per-user job limit changed", "max_jobs_per_user", *input.MaxJobsPerUser)
+	}
+
+	c.JSON(http.StatusOK, services.WorkerPoolStatus())
+}
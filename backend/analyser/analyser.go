@@ -0,0 +1,220 @@
+// Package analyser fetches a page, analyses its document and iframes and checks its links. It knows nothing
+// about storage or queues: the server persists results through services, the command-line client prints
+// them, and other Go programs can embed it with their own HTTP client.
+package analyser
+
+import (
+	"context"
+	"net/http"
+	"time"
+	"web-scraper/config"
+	"web-scraper/models"
+
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("web-scraper/analyser")
+
+// Options configure an analysis, OptionsFromEnv returns the ones the server uses
+type Options struct {
+	// Profile is applied like a crawl profile of the server: identity, credentials and the login step, optional
+	Profile *models.CrawlProfile
+	// HTTPClient sends every request of the analysis through its transport, each analysis gets its own cookie jar.
+	// Nil uses a client with the SSRF policy of netguard.Default, the proxy pool and client spans.
+	HTTPClient *http.Client
+	Budget     Budget
+	Iframes    IframeOptions
+	Capture    CaptureOptions
+	// StoreMainContent keeps the extracted main content on the result
+	StoreMainContent bool
+	// CertExpiryWarningDays is how close to its expiry a certificate gets a finding
+	CertExpiryWarningDays int
+	// KnownTLS is reported for https pages when the client doesn't establish TLS itself, like a replay of a snapshot
+	KnownTLS *models.TLSDetails
+
+	// the identity sent with every request, the profile overrides it
+	UserAgent      string
+	AcceptLanguage string
+	// UseProxyPool routes the crawl through a proxy of CRAWL_PROXY_POOL, it has no effect with HTTPClient
+	UseProxyPool bool
+}
+
+// OptionsFromEnv returns the options analyses of the server run with, see BudgetFromEnv for the budget.
+// CRAWL_USER_AGENT, CRAWL_ACCEPT_LANGUAGE and CRAWL_USE_PROXY_POOL set the crawler identity.
+// CRAWL_IFRAMES enables iframe crawling, CRAWL_IFRAME_MAX_DEPTH limits nesting (default 1) and
+// CRAWL_IFRAME_POLICY is either "same-origin" (default) or "all".
+// CRAWL_STORE_CONTENT keeps the extracted main content and SECURITY_CERT_EXPIRY_DAYS (default 30) is how close
+// to its expiry a certificate gets a finding.
+func OptionsFromEnv() Options {
+	return Options{
+		Budget: BudgetFromEnv(),
+		Iframes: IframeOptions{
+			Enabled:          config.GetEnvBool("CRAWL_IFRAMES", false),
+			MaxDepth:         config.GetEnvInt("CRAWL_IFRAME_MAX_DEPTH", 1),
+			AllowCrossOrigin: config.GetEnv("CRAWL_IFRAME_POLICY") == "all",
+		},
+		StoreMainContent:      config.GetEnvBool("CRAWL_STORE_CONTENT", false),
+		CertExpiryWarningDays: config.GetEnvInt("SECURITY_CERT_EXPIRY_DAYS", 30),
+		UserAgent:             config.GetEnv("CRAWL_USER_AGENT"),
+		AcceptLanguage:        config.GetEnv("CRAWL_ACCEPT_LANGUAGE"),
+		UseProxyPool:          config.GetEnvBool("CRAWL_USE_PROXY_POOL", false),
+	}
+}
+
+// Result is the outcome of an analysis
+type Result struct {
+	URL string
+	// Status is done, partial when a budget ran out after the page was fetched, errored or cancelled
+	Status         string
+	PartialReasons []string
+	// Err failed the analysis, ErrorCategory and Retryable classify it
+	Err           error
+	ErrorCategory string
+	Retryable     bool
+	// StatusCode is the HTTP status of the page, 0 when no response was received
+	StatusCode int
+
+	HTMLVersion string
+	Title       string
+	// Headings counts the h1 to h6 elements
+	Headings      [6]int
+	InternalLinks int
+	ExternalLinks int
+	// Links of the page in document order, links found in iframes are only checked
+	Links []string
+
+	Content     models.ContentAnalysis
+	MainContent string
+	// Text is the visible text of the page and HeadingTexts its headings as "h2 Some heading".
+	// ContentHash and StructureHash fingerprint them and the links, to detect content changes.
+	Text          string
+	HeadingTexts  []string
+	ContentHash   string
+	StructureHash string
+
+	// Login is the login detection of the page merged with the one of its iframes
+	Login        models.LoginDetection
+	Frames       []models.FrameAnalysis
+	BrokenLinks  []models.BrokenLink
+	CheckedLinks int
+
+	Response models.ResponseMetadata
+	Security models.SecurityReport
+	// Capture holds the exchanges of the page fetch when Options.Capture is enabled, also of failed analyses
+	Capture *Capture
+}
+
+// Analyse fetches the page at rawURL with the identity and credentials of opts.Profile, crawls its iframes and
+// checks its links within opts.Budget. Nothing is stored.
+// The result is also returned when the analysis failed, with status errored and the error. Cancelling ctx stops
+// the analysis, the result then has status cancelled and the error is the cause of the cancellation.
+func Analyse(ctx context.Context, rawURL string, opts Options) (*Result, error) {
+	crawlCtx, cancelDeadline := WithDeadline(ctx, opts.Budget)
+	defer cancelDeadline()
+
+	run := crawlPage(crawlCtx, rawURL, opts, false)
+	result := run.result(rawURL, opts)
+	if ctx.Err() != nil {
+		result.Status = "cancelled"
+		return result, context.Cause(ctx)
+	}
+	return result, result.Err
+}
+
+// AnalyseDocument runs the page analysis on the document at rawURL alone: no login, iframes, resources or
+// link checks. With a client answering from an archive it analyses a page again without network access.
+func AnalyseDocument(ctx context.Context, rawURL string, opts Options) (*Result, error) {
+	run := crawlPage(ctx, rawURL, opts, true)
+	result := run.result(rawURL, opts)
+	return result, result.Err
+}
+
+// ApplyTo writes the result onto urlAnalysis: the error of a failed analysis, the analysis of the page
+// of a successful one, which is done or partial
+func (r *Result) ApplyTo(urlAnalysis *models.URLAnalysis) {
+	urlAnalysis.Response = r.Response
+	urlAnalysis.PartialReasons = models.StringList{}
+
+	if r.Err != nil {
+		urlAnalysis.Status = "errored"
+		urlAnalysis.LastError = r.Err.Error()
+		urlAnalysis.ErrorCategory = r.ErrorCategory
+		return
+	}
+
+	urlAnalysis.LastError = ""
+	urlAnalysis.ErrorCategory = ""
+	urlAnalysis.Status = r.Status
+	if len(r.PartialReasons) > 0 {
+		urlAnalysis.PartialReasons = r.PartialReasons
+	}
+	r.ApplyPageTo(urlAnalysis)
+	urlAnalysis.HasLoginForm = r.Login.Detected
+	urlAnalysis.LoginDetection = r.Login
+	urlAnalysis.InaccessibleLinkCount = len(r.BrokenLinks)
+	urlAnalysis.BrokenLinks = r.BrokenLinks
+	urlAnalysis.CheckedLinkCount = r.CheckedLinks
+	urlAnalysis.Frames = r.Frames
+	urlAnalysis.Security = r.Security
+	urlAnalysis.ContentHash, urlAnalysis.StructureHash = r.ContentHash, r.StructureHash
+}
+
+// ApplyPageTo copies the analysis of the page document onto urlAnalysis: HTML version, title, headings,
+// link counts and content
+func (r *Result) ApplyPageTo(urlAnalysis *models.URLAnalysis) {
+	urlAnalysis.HTMLVersion = r.HTMLVersion
+	urlAnalysis.PageTitle = r.Title
+	urlAnalysis.H1Count = r.Headings[0]
+	urlAnalysis.H2Count = r.Headings[1]
+	urlAnalysis.H3Count = r.Headings[2]
+	urlAnalysis.H4Count = r.Headings[3]
+	urlAnalysis.H5Count = r.Headings[4]
+	urlAnalysis.H6Count = r.Headings[5]
+	urlAnalysis.InternalLinkCount = r.InternalLinks
+	urlAnalysis.ExternalLinkCount = r.ExternalLinks
+	urlAnalysis.WordCount = r.Content.WordCount
+	urlAnalysis.Content = r.Content
+	urlAnalysis.MainContent = models.CompressedText(r.MainContent)
+}
+
+// result turns the run into the result of the analysis
+func (run *crawlRun) result(rawURL string, opts Options) *Result {
+	result := &Result{
+		URL:            rawURL,
+		Status:         "done",
+		PartialReasons: run.partialReasons,
+		Err:            run.err,
+		StatusCode:     run.statusCode,
+		Frames:         run.frames,
+		BrokenLinks:    run.brokenLinks,
+		CheckedLinks:   run.checkedLinks,
+		Response:       run.recorder.metadata(),
+		Capture:        run.capture,
+	}
+	if run.err != nil {
+		failure := Classify(run.err, run.statusCode)
+		result.Status, result.ErrorCategory, result.Retryable = "errored", failure.Category, failure.Transient
+		return result
+	}
+	if len(run.partialReasons) > 0 {
+		result.Status = "partial"
+	}
+
+	page := &run.page
+	result.HTMLVersion = page.htmlVersion
+	result.Title = page.title
+	result.Headings = [6]int{page.h1Count, page.h2Count, page.h3Count, page.h4Count, page.h5Count, page.h6Count}
+	result.InternalLinks = page.internalLinksCount
+	result.ExternalLinks = page.externalLinksCount
+	result.Links = page.links
+
+	result.Content = run.content.analysis
+	result.MainContent = run.content.mainContent
+	result.Text = run.content.text
+	result.HeadingTexts = run.content.headings
+	result.ContentHash, result.StructureHash = contentHashes(run.content.text, run.content.headings, UniqueLinks(page.links))
+
+	result.Login = run.login
+	result.Security = buildSecurityReport(run.recorder, page.mixedContent, opts.KnownTLS, opts.CertExpiryWarningDays, time.Now())
+	return result
+}
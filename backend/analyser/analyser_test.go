@@ -0,0 +1,439 @@
+package analyser
+
+import (
+	"errors"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"web-scraper/models"
+)
+
+// testOptions analyse pages of httptest servers, a client of its own bypasses the SSRF policy for 127.0.0.1
+func testOptions(budget Budget) Options {
+	return Options{HTTPClient: &http.Client{}, Budget: budget}
+}
+
+// newSite serves the pages of a test site at their paths, other paths are not found. A page of "slow" only
+// answers after the request was cancelled or a few seconds passed.
+func newSite(t *testing.T, pages map[string]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if page == "slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAnalysePage(t *testing.T) {
+	external := newSite(t, map[string]string{"/": "ok"})
+	site := newSite(t, map[string]string{
+		"/": `<!DOCTYPE html>
+<html>
+<head><title>Welcome</title></head>
+<body>
+<h1>Shop</h1>
+<h2>Offers</h2><h2>News</h2>
+<h3>Today</h3>
+<a href="/about">About</a>
+<a href="/missing">Gone</a>
+<a href="/about">About again</a>
+<a href="#top">Top</a>
+<a href="` + external.URL + `/">Partner</a>
+<form action="/session" method="post">
+  <input type="email" name="email" autocomplete="username">
+  <input type="password" name="password" autocomplete="current-password">
+  <button type="submit">Sign in</button>
+</form>
+</body>
+</html>`,
+		"/about": "<html><body>About</body></html>",
+	})
+
+	result, err := Analyse(t.Context(), site.URL+"/", testOptions(Budget{}))
+	if err != nil {
+		t.Fatalf("Analyse: %v", err)
+	}
+
+	if result.Status != "done" || result.StatusCode != http.StatusOK {
+		t.Errorf("status = %s %d, want done 200", result.Status, result.StatusCode)
+	}
+	if result.HTMLVersion != "HTML5" {
+		t.Errorf("HTMLVersion = %q, want HTML5", result.HTMLVersion)
+	}
+	if result.Title != "Welcome" {
+		t.Errorf("Title = %q, want Welcome", result.Title)
+	}
+	if want := [6]int{1, 2, 1, 0, 0, 0}; result.Headings != want {
+		t.Errorf("Headings = %v, want %v", result.Headings, want)
+	}
+
+	// fragment links are skipped, repeated links counted every time
+	if result.InternalLinks != 3 || result.ExternalLinks != 1 {
+		t.Errorf("links = %d internal, %d external, want 3 and 1", result.InternalLinks, result.ExternalLinks)
+	}
+	wantLinks := []string{site.URL + "/about", site.URL + "/missing", site.URL + "/about", external.URL + "/"}
+	if !slices.Equal(result.Links, wantLinks) {
+		t.Errorf("Links = %v, want %v", result.Links, wantLinks)
+	}
+
+	// repeated links are checked once
+	if result.CheckedLinks != 3 {
+		t.Errorf("CheckedLinks = %d, want 3", result.CheckedLinks)
+	}
+	if len(result.BrokenLinks) != 1 || result.BrokenLinks[0].URL != site.URL+"/missing" || result.BrokenLinks[0].StatusCode != http.StatusNotFound {
+		t.Errorf("BrokenLinks = %+v, want %s/missing with 404", result.BrokenLinks, site.URL)
+	}
+
+	if !result.Login.Detected || result.Login.Type != loginTypePassword {
+		t.Errorf("Login = %+v, want a detected password login", result.Login)
+	}
+}
+
+func TestAnalyseWithoutLogin(t *testing.T) {
+	site := newSite(t, map[string]string{
+		"/": `<html><head><title>Search</title></head><body>
+<form action="/search"><input type="text" name="q"><button>Search</button></form>
+<p>Written by our author, see the account of events.</p>
+</body></html>`,
+	})
+
+	result, err := Analyse(t.Context(), site.URL+"/", testOptions(Budget{}))
+	if err != nil {
+		t.Fatalf("Analyse: %v", err)
+	}
+	if result.HTMLVersion != "HTML4.01" {
+		t.Errorf("HTMLVersion = %q, want HTML4.01 without a doctype", result.HTMLVersion)
+	}
+	if result.Login.Detected {
+		t.Errorf("Login = %+v, want none on a search page", result.Login)
+	}
+}
+
+func TestAnalyseFailedPage(t *testing.T) {
+	site := newSite(t, map[string]string{})
+
+	result, err := Analyse(t.Context(), site.URL+"/missing", testOptions(Budget{}))
+	if err == nil {
+		t.Fatal("Analyse of a missing page succeeded")
+	}
+	if result.Status != "errored" || result.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %s %d, want errored 404", result.Status, result.StatusCode)
+	}
+	if result.ErrorCategory == "" {
+		t.Error("failed analysis without an error category")
+	}
+}
+
+func TestAnalyseBudgets(t *testing.T) {
+	links := `<html><body><a href="/a">a</a><a href="/b">b</a><a href="/c">c</a><a href="/slow">slow</a></body></html>`
+	site := newSite(t, map[string]string{
+		"/":      links,
+		"/a":     "a",
+		"/b":     "b",
+		"/c":     "c",
+		"/slow":  "slow",
+		"/stuck": "slow",
+	})
+
+	t.Run("link limit", func(t *testing.T) {
+		result, err := Analyse(t.Context(), site.URL+"/", testOptions(Budget{MaxLinks: 2}))
+		if err != nil {
+			t.Fatalf("Analyse: %v", err)
+		}
+		if result.Status != "partial" || result.CheckedLinks != 2 {
+			t.Errorf("status %s with %d links checked, want partial with 2", result.Status, result.CheckedLinks)
+		}
+		if len(result.PartialReasons) != 1 || !strings.Contains(result.PartialReasons[0], "the first 2 of 4 links") {
+			t.Errorf("PartialReasons = %v", result.PartialReasons)
+		}
+		// the page itself is analysed in full
+		if len(result.Links) != 4 {
+			t.Errorf("Links = %v, want all 4", result.Links)
+		}
+	})
+
+	t.Run("link check budget", func(t *testing.T) {
+		started := time.Now()
+		result, err := Analyse(t.Context(), site.URL+"/", testOptions(Budget{LinkCheckBudget: 300 * time.Millisecond}))
+		if err != nil {
+			t.Fatalf("Analyse: %v", err)
+		}
+		if elapsed := time.Since(started); elapsed > 3*time.Second {
+			t.Errorf("Analyse took %s, the budget didn't stop the link checks", elapsed)
+		}
+		if result.Status != "partial" || result.CheckedLinks != 3 {
+			t.Errorf("status %s with %d links checked, want partial with 3", result.Status, result.CheckedLinks)
+		}
+		if len(result.PartialReasons) != 1 || !strings.Contains(result.PartialReasons[0], errLinkCheckBudget.Error()) {
+			t.Errorf("PartialReasons = %v", result.PartialReasons)
+		}
+	})
+
+	t.Run("fetch timeout", func(t *testing.T) {
+		result, err := Analyse(t.Context(), site.URL+"/stuck", testOptions(Budget{FetchTimeout: 200 * time.Millisecond}))
+		if !errors.Is(err, errFetchBudget) {
+			t.Fatalf("Analyse = %v, want the fetch budget error", err)
+		}
+		if result.Status != "errored" {
+			t.Errorf("Status = %s, want errored", result.Status)
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		result, err := Analyse(t.Context(), site.URL+"/stuck", testOptions(Budget{Deadline: 200 * time.Millisecond}))
+		if !errors.Is(err, errCrawlDeadline) {
+			t.Fatalf("Analyse = %v, want the deadline error", err)
+		}
+		if result.Status != "errored" {
+			t.Errorf("Status = %s, want errored", result.Status)
+		}
+	})
+}
+
+// newLoginSite serves a login form posting to action, "{port}" in it is the port of the site. "/session" logs in
+// alice and "/" is for members only.
+func newLoginSite(t *testing.T, action string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var submits atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /login", func(w http.ResponseWriter, r *http.Request) {
+		_, port, _ := net.SplitHostPort(r.Host)
+		form := strings.ReplaceAll(action, "{port}", port)
+		io.WriteString(w, `<html><body><form action="`+form+`" method="post">
+<input type="hidden" name="csrf" value="token-1">
+<input type="text" name="user"><input type="password" name="password">
+</form></body></html>`)
+	})
+	mux.HandleFunc("POST /session", func(w http.ResponseWriter, r *http.Request) {
+		submits.Add(1)
+		if r.PostFormValue("csrf") != "token-1" || r.PostFormValue("user") != "alice" || r.PostFormValue("password") != "s3cret" {
+			http.Error(w, "wrong credentials", http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "alice", Path: "/"})
+		io.WriteString(w, "welcome")
+	})
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "alice" {
+			http.Error(w, "sign in first", http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, "<html><head><title>Members</title></head><body></body></html>")
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &submits
+}
+
+func loginProfile(site *httptest.Server) *models.CrawlProfile {
+	return &models.CrawlProfile{
+		ID:   1,
+		Site: "127.0.0.1",
+		Credentials: models.CrawlCredentials{FormLogin: &models.FormLogin{
+			PageURL: site.URL + "/login",
+			Fields:  map[string]string{"user": "alice", "password": "s3cret"},
+		}},
+	}
+}
+
+func TestAnalyseFormLogin(t *testing.T) {
+	site, submits := newLoginSite(t, "/session")
+	opts := testOptions(Budget{})
+	opts.Profile = loginProfile(site)
+
+	result, err := Analyse(t.Context(), site.URL+"/", opts)
+	if err != nil {
+		t.Fatalf("Analyse: %v", err)
+	}
+	if result.Title != "Members" {
+		t.Errorf("Title = %q, want the members page the login opens", result.Title)
+	}
+	if n := submits.Load(); n != 1 {
+		t.Errorf("login form submitted %d times, want once", n)
+	}
+}
+
+func TestAnalyseFormLoginOffSiteAction(t *testing.T) {
+	// the form is served by 127.0.0.1 and posts the credentials to localhost, another site
+	site, submits := newLoginSite(t, "http://localhost:{port}/session")
+	opts := testOptions(Budget{})
+	opts.Profile = loginProfile(site)
+
+	result, err := Analyse(t.Context(), site.URL+"/", opts)
+	if !errors.Is(err, errLoginFailed) || !strings.Contains(err.Error(), "outside the profile site") {
+		t.Fatalf("Analyse = %v, want the login refused", err)
+	}
+	if result.Status != "errored" {
+		t.Errorf("Status = %s, want errored", result.Status)
+	}
+	if n := submits.Load(); n != 0 {
+		t.Errorf("credentials posted %d times to another site", n)
+	}
+}
+
+func TestAnalyseIframes(t *testing.T) {
+	widgets := newSite(t, map[string]string{
+		"/widget": `<html><head><title>Widget</title></head><body><a href="/widget-missing">more</a></body></html>`,
+	})
+	site := newSite(t, map[string]string{
+		// the frame of a is embedded twice, the cross-origin widget once
+		"/": `<html><head><title>Page</title></head><body>
+<a href="/shared-missing">shared</a>
+<iframe src="/frame-a"></iframe>
+<iframe src="/frame-a"></iframe>
+<iframe src="` + widgets.URL + `/widget"></iframe>
+</body></html>`,
+		// a embeds the page again, which isn't crawled twice
+		"/frame-a": `<html><head><title>A</title></head><body>
+<h1>Frame A</h1>
+<a href="/a-missing">a</a>
+<a href="/shared-missing">shared</a>
+<iframe src="/frame-b"></iframe>
+<iframe src="/"></iframe>
+</body></html>`,
+		"/frame-b": `<html><head><title>B</title></head><body>
+<a href="/b-missing">b</a>
+<form action="/session" method="post"><input type="text" name="user"><input type="password" name="password"></form>
+<iframe src="/frame-c"></iframe>
+</body></html>`,
+		"/frame-c": `<html><head><title>C</title></head><body><a href="/c-missing">c</a></body></html>`,
+	})
+
+	analyse := func(t *testing.T, iframes IframeOptions) *Result {
+		t.Helper()
+		opts := testOptions(Budget{})
+		opts.Iframes = iframes
+		result, err := Analyse(t.Context(), site.URL+"/", opts)
+		if err != nil {
+			t.Fatalf("Analyse: %v", err)
+		}
+		return result
+	}
+	frameURLs := func(result *Result) []string {
+		var urls []string
+		for _, frame := range result.Frames {
+			urls = append(urls, frame.URL)
+		}
+		return urls
+	}
+	brokenFrames := func(result *Result) map[string]string {
+		frames := map[string]string{}
+		for _, link := range result.BrokenLinks {
+			frames[strings.TrimPrefix(link.URL, site.URL)] = link.Frame
+		}
+		return frames
+	}
+
+	t.Run("same origin up to the depth limit", func(t *testing.T) {
+		result := analyse(t, IframeOptions{Enabled: true, MaxDepth: 2})
+
+		if want := []string{site.URL + "/frame-a", site.URL + "/frame-b"}; !slices.Equal(frameURLs(result), want) {
+			t.Fatalf("frames %v, want %v: a once, b nested in it, c beyond the depth limit and no cross-origin widget", frameURLs(result), want)
+		}
+		a, b := result.Frames[0], result.Frames[1]
+		if a.Depth != 1 || a.ParentURL != site.URL+"/" || a.PageTitle != "A" || a.H1Count != 1 || a.CrossOrigin {
+			t.Errorf("frame a = %+v", a)
+		}
+		if b.Depth != 2 || b.ParentURL != site.URL+"/frame-a" || b.PageTitle != "B" || !b.HasLoginForm {
+			t.Errorf("frame b = %+v", b)
+		}
+
+		// broken links of frames name the frame they were found in, the ones also on the page don't
+		want := map[string]string{
+			"/shared-missing": "",
+			"/a-missing":      site.URL + "/frame-a",
+			"/b-missing":      site.URL + "/frame-b",
+		}
+		if got := brokenFrames(result); !maps.Equal(got, want) {
+			t.Errorf("broken links with their frame %v, want %v", got, want)
+		}
+
+		// the login form of frame b counts for the page, its evidence names the frame
+		if !result.Login.Detected || len(result.Login.Evidence) == 0 || result.Login.Evidence[0].Frame != site.URL+"/frame-b" {
+			t.Errorf("Login = %+v, want the form of frame b", result.Login)
+		}
+	})
+
+	t.Run("deeper limit", func(t *testing.T) {
+		result := analyse(t, IframeOptions{Enabled: true, MaxDepth: 3})
+
+		urls := frameURLs(result)
+		if len(urls) != 3 || urls[2] != site.URL+"/frame-c" || result.Frames[2].Depth != 3 {
+			t.Errorf("frames %v, want c at depth 3", urls)
+		}
+		if got := brokenFrames(result)["/c-missing"]; got != site.URL+"/frame-c" {
+			t.Errorf("frame of /c-missing = %q, want frame c", got)
+		}
+	})
+
+	t.Run("cross origin", func(t *testing.T) {
+		result := analyse(t, IframeOptions{Enabled: true, MaxDepth: 1, AllowCrossOrigin: true})
+
+		if want := []string{site.URL + "/frame-a", widgets.URL + "/widget"}; !slices.Equal(frameURLs(result), want) {
+			t.Fatalf("frames %v, want %v", frameURLs(result), want)
+		}
+		if widget := result.Frames[1]; !widget.CrossOrigin || widget.PageTitle != "Widget" || widget.Depth != 1 {
+			t.Errorf("widget frame = %+v", widget)
+		}
+		var widgetLink *models.BrokenLink
+		for i, link := range result.BrokenLinks {
+			if link.URL == widgets.URL+"/widget-missing" {
+				widgetLink = &result.BrokenLinks[i]
+			}
+		}
+		if widgetLink == nil || widgetLink.Frame != widgets.URL+"/widget" {
+			t.Errorf("broken link of the widget = %+v, want it with the widget frame", widgetLink)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		result := analyse(t, IframeOptions{MaxDepth: 3, AllowCrossOrigin: true})
+
+		if len(result.Frames) != 0 {
+			t.Errorf("frames %v, want none", frameURLs(result))
+		}
+		if _, ok := brokenFrames(result)["/a-missing"]; ok {
+			t.Error("links of an iframe checked with iframe crawling disabled")
+		}
+	})
+}
+
+func TestAnalyseRateLimited(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer site.Close()
+
+	result, err := Analyse(t.Context(), site.URL+"/", testOptions(Budget{}))
+	if !errors.Is(err, ErrBlockedByBotProtection) {
+		t.Fatalf("Analyse = %v, want ErrBlockedByBotProtection", err)
+	}
+	if result.ErrorCategory != ErrorCategoryBotProtection || !result.Retryable || result.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("failure %s, retryable %v, status %d, want a retryable bot protection 429", result.ErrorCategory, result.Retryable, result.StatusCode)
+	}
+	// the retry is scheduled after the wait the site asked for
+	if got := result.Response.Headers["Retry-After"]; got != "120" {
+		t.Errorf("Retry-After = %q, want 120", got)
+	}
+}
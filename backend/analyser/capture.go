@@ -0,0 +1,238 @@
+package analyser
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"web-scraper/warc"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// headers never written to a snapshot, they would leak the credentials of crawl profiles
+var redactedRequestHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// CaptureOptions controls capturing the HTTP exchanges of the page fetch for archiving
+type CaptureOptions struct {
+	Enabled bool
+	// Resources also fetches and captures the stylesheets, scripts and images of the page, up to MaxResources
+	Resources    bool
+	MaxResources int
+	// longer bodies are cut and their record marked as truncated
+	MaxBodyBytes int64
+}
+
+// CaptureStats describes the records written by Capture.WriteRecords
+type CaptureStats struct {
+	Records   int
+	Resources int
+	// Truncated is set when a body was cut at MaxBodyBytes
+	Truncated bool
+}
+
+type snapshotKey struct{}
+
+// capturedExchange is a request with its response and as much of the body as the reader consumed
+type capturedExchange struct {
+	request   *http.Request
+	response  *http.Response
+	body      bytes.Buffer
+	truncated bool
+	resource  bool
+}
+
+// Capture collects the HTTP exchanges of the requests made with its context
+type Capture struct {
+	mu           sync.Mutex
+	maxBodyBytes int64
+	exchanges    []*capturedExchange
+	// request headers masked when written, the credentials of the crawl profile
+	redact []string
+}
+
+// withSnapshotCapture returns a context whose requests are captured when sent through capturingTransport
+func withSnapshotCapture(ctx context.Context, capture *Capture) context.Context {
+	return context.WithValue(ctx, snapshotKey{}, capture)
+}
+
+func (sc *Capture) add(req *http.Request, resp *http.Response, resource bool) *capturedExchange {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	exchange := &capturedExchange{request: req, response: resp, resource: resource}
+	sc.exchanges = append(sc.exchanges, exchange)
+	return exchange
+}
+
+func (sc *Capture) write(exchange *capturedExchange, p []byte) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if room := sc.maxBodyBytes - int64(exchange.body.Len()); int64(len(p)) > room {
+		p = p[:max(room, 0)]
+		exchange.truncated = true
+	}
+	exchange.body.Write(p)
+}
+
+// Empty reports whether nothing was captured
+func (sc *Capture) Empty() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return len(sc.exchanges) == 0
+}
+
+// WriteRecords writes a request and a response record for every captured exchange to w. Credentials the
+// crawl sent and cookie values the sites set are redacted.
+func (sc *Capture) WriteRecords(w *warc.Writer) (CaptureStats, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	var stats CaptureStats
+	for _, exchange := range sc.exchanges {
+		target := exchange.request.URL.String()
+
+		request := exchange.request.Clone(context.Background())
+		redactRequest(request, sc.redact)
+		requestRecord := w.NewRecord(warc.TypeRequest, warc.ContentTypeHTTPRequest, warc.HTTPRequestBlock(request))
+		requestRecord.Header.Set("WARC-Target-URI", target)
+
+		response := *exchange.response
+		response.Header = redactSetCookie(exchange.response.Header)
+		responseRecord := w.NewRecord(warc.TypeResponse, warc.ContentTypeHTTPResponse, warc.HTTPResponseBlock(&response, exchange.body.Bytes()))
+		responseRecord.Header.Set("WARC-Target-URI", target)
+		responseRecord.Header.Set("WARC-Payload-Digest", warc.Digest(exchange.body.Bytes()))
+		if exchange.truncated {
+			responseRecord.Header.Set("WARC-Truncated", "length")
+			stats.Truncated = true
+		}
+		requestRecord.Header.Set("WARC-Concurrent-To", responseRecord.Header.Get("WARC-Record-ID"))
+
+		if err := w.WriteRecord(requestRecord); err != nil {
+			return stats, err
+		}
+		if err := w.WriteRecord(responseRecord); err != nil {
+			return stats, err
+		}
+		stats.Records += 2
+		if exchange.resource {
+			stats.Resources++
+		}
+	}
+	return stats, nil
+}
+
+type resourceKey struct{}
+
+// capturingTransport adds the requests carrying a Capture in their context to it
+type capturingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *capturingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	capture, ok := req.Context().Value(snapshotKey{}).(*Capture)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	_, resource := req.Context().Value(resourceKey{}).(bool)
+	exchange := capture.add(req, resp, resource)
+	resp.Body = &capturingBody{ReadCloser: resp.Body, capture: capture, exchange: exchange}
+	return resp, nil
+}
+
+type capturingBody struct {
+	io.ReadCloser
+	capture  *Capture
+	exchange *capturedExchange
+}
+
+func (b *capturingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.capture.write(b.exchange, p[:n])
+	}
+	return n, err
+}
+
+// registerResourceCollector collects the stylesheets, scripts and images of the page into resources
+func registerResourceCollector(c *colly.Collector, resources *[]string) {
+	seen := map[string]bool{}
+	for selector, attr := range map[string]string{"link[rel=stylesheet][href]": "href", "script[src]": "src", "img[src]": "src"} {
+		c.OnHTML(selector, func(e *colly.HTMLElement) {
+			resource := e.Request.AbsoluteURL(e.Attr(attr))
+			if !strings.HasPrefix(resource, "http://") && !strings.HasPrefix(resource, "https://") || seen[resource] {
+				return
+			}
+			seen[resource] = true
+			*resources = append(*resources, resource)
+		})
+	}
+}
+
+// fetchResources downloads resources with the crawl client into the capture of ctx, until ctx ends
+func fetchResources(ctx context.Context, client *http.Client, session *crawlSession, resources []string) int {
+	ctx = context.WithValue(ctx, resourceKey{}, true)
+	var fetched int
+	for _, resource := range resources {
+		if ctx.Err() != nil {
+			break
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, resource, nil)
+		if err != nil {
+			continue
+		}
+		session.authorize(req)
+		resp, err := client.Do(req)
+		if err != nil {
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		fetched++
+	}
+	return fetched
+}
+
+// redactedHeaders are the request headers masked in the capture of session, including the headers of its profile
+func redactedHeaders(session *crawlSession) []string {
+	names := slices.Clone(redactedRequestHeaders)
+	if session.profile != nil {
+		for name := range session.credentialHeaders() {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// redactRequest masks the headers of req named in names
+func redactRequest(req *http.Request, names []string) {
+	for _, name := range names {
+		if req.Header.Get(name) != "" {
+			req.Header.Set(name, "[redacted]")
+		}
+	}
+}
+
+// redactSetCookie masks the cookie values of header, their names and attributes are kept
+func redactSetCookie(header http.Header) http.Header {
+	header = header.Clone()
+	cookies := header.Values("Set-Cookie")
+	header.Del("Set-Cookie")
+	for _, cookie := range cookies {
+		pair, attributes, _ := strings.Cut(cookie, ";")
+		name, _, _ := strings.Cut(pair, "=")
+		redacted := name + "=[redacted]"
+		if attributes != "" {
+			redacted += ";" + attributes
+		}
+		header.Add("Set-Cookie", redacted)
+	}
+	return header
+}
@@ -0,0 +1,299 @@
+package analyser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"web-scraper/models"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+	"golang.org/x/net/html"
+)
+
+const (
+	topKeywordsCount = 10
+	// the stored main content is cut at this size, before compression
+	maxMainContentBytes = 1 << 20
+)
+
+// elements whose text is never shown
+var invisibleElements = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true, "template": true,
+	"svg": true, "canvas": true, "iframe": true, "object": true, "embed": true,
+}
+
+// elements that start a new line of text
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true, "dd": true, "div": true,
+	"dl": true, "dt": true, "figcaption": true, "figure": true, "footer": true, "form": true, "h1": true,
+	"h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true, "li": true,
+	"main": true, "nav": true, "ol": true, "p": true, "pre": true, "section": true, "table": true,
+	"td": true, "th": true, "tr": true, "ul": true,
+}
+
+// candidates for the main content of a page, the one with the most text wins
+const mainContentSelector = "main, article, [role=main]"
+
+// contentStats holds the text analysis of the crawled page
+type contentStats struct {
+	analysis    models.ContentAnalysis
+	mainContent string
+	// the visible text and the headings as "h2 Some heading", kept to detect content changes
+	text     string
+	headings []string
+}
+
+// registerContentExtractors attaches the text analysis callbacks to c, results are written to stats
+func registerContentExtractors(c *colly.Collector, stats *contentStats, storeMainContent bool) {
+	c.OnHTML("html", func(e *colly.HTMLElement) {
+		text := visibleText(e.DOM)
+		words := splitWords(text)
+
+		analysis := models.ContentAnalysis{
+			WordCount:     len(words),
+			SentenceCount: countSentences(text),
+			HTMLLang:      strings.TrimSpace(e.Attr("lang")),
+			TopKeywords:   []models.Keyword{},
+		}
+		if size := len(e.Response.Body); size > 0 {
+			analysis.TextHTMLRatio = round2(float64(len(text)) / float64(size) * 100)
+		}
+
+		analysis.Language, analysis.LanguageConfidence = detectLanguage(text, words)
+		analysis.LanguageConfidence = round2(analysis.LanguageConfidence)
+		analysis.LanguageMatches = analysis.Language != "" && primaryLanguage(analysis.HTMLLang) == analysis.Language
+		if analysis.Language == "en" {
+			analysis.Readability = fleschReadability(words, analysis.SentenceCount)
+		}
+		analysis.TopKeywords = topKeywords(words, analysis.Language)
+
+		stats.analysis = analysis
+		stats.text = text
+		stats.headings = nil
+		e.DOM.Find("h1, h2, h3, h4, h5, h6").Each(func(_ int, s *goquery.Selection) {
+			stats.headings = append(stats.headings, goquery.NodeName(s)+" "+strings.Join(strings.Fields(s.Text()), " "))
+		})
+		if storeMainContent {
+			stats.mainContent = truncateUTF8(mainContent(e.DOM), maxMainContentBytes)
+		}
+	})
+}
+
+// visibleText returns the text of the document a reader sees, one line per block element
+func visibleText(doc *goquery.Selection) string {
+	var b strings.Builder
+	for _, node := range doc.Nodes {
+		writeText(&b, node)
+	}
+
+	lines := strings.Split(b.String(), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+func writeText(b *strings.Builder, node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		b.WriteString(node.Data)
+		return
+	case html.ElementNode:
+		if invisibleElements[node.Data] || hasAttr(node, "hidden") {
+			return
+		}
+	}
+
+	block := node.Type == html.ElementNode && blockElements[node.Data]
+	if block {
+		b.WriteString("\n")
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		writeText(b, child)
+	}
+	if block {
+		b.WriteString("\n")
+	} else if node.Type == html.ElementNode {
+		b.WriteString(" ")
+	}
+}
+
+func hasAttr(node *html.Node, name string) bool {
+	for _, attr := range node.Attr {
+		if attr.Key == name {
+			return true
+		}
+	}
+	return false
+}
+
+// mainContent returns the text of the main content element, or of the whole body when there is none
+func mainContent(doc *goquery.Selection) string {
+	var best string
+	doc.Find(mainContentSelector).Each(func(_ int, s *goquery.Selection) {
+		if text := visibleText(s); len(text) > len(best) {
+			best = text
+		}
+	})
+	if best == "" {
+		best = visibleText(doc.Find("body"))
+	}
+	return best
+}
+
+// splitWords returns the lower-cased words of text, apostrophes and hyphens inside a word are kept
+func splitWords(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' && r != '’' && r != '-'
+	})
+
+	words := fields[:0]
+	for _, field := range fields {
+		if word := strings.Trim(field, "'’-"); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// countSentences counts runs of sentence terminators and line ends following text, at least 1 for any text
+func countSentences(text string) int {
+	var sentences int
+	inSentence := false
+	for _, r := range text {
+		switch {
+		case r == '.' || r == '!' || r == '?' || r == '\n' || r == '。' || r == '！' || r == '？':
+			if inSentence {
+				sentences++
+				inSentence = false
+			}
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			inSentence = true
+		}
+	}
+	if inSentence {
+		sentences++
+	}
+	return sentences
+}
+
+// fleschReadability scores English text, nil when there is no text
+func fleschReadability(words []string, sentences int) *models.Readability {
+	if len(words) == 0 || sentences == 0 {
+		return nil
+	}
+
+	var syllables int
+	for _, word := range words {
+		syllables += countSyllables(word)
+	}
+	wordsPerSentence := float64(len(words)) / float64(sentences)
+	syllablesPerWord := float64(syllables) / float64(len(words))
+
+	return &models.Readability{
+		FleschReadingEase:  round2(206.835 - 1.015*wordsPerSentence - 84.6*syllablesPerWord),
+		FleschKincaidGrade: round2(0.39*wordsPerSentence + 11.8*syllablesPerWord - 15.59),
+	}
+}
+
+// countSyllables estimates the syllables of an English word from its vowel groups
+func countSyllables(word string) int {
+	var count int
+	previousVowel := false
+	for _, r := range word {
+		vowel := strings.ContainsRune("aeiouy", r)
+		if vowel && !previousVowel {
+			count++
+		}
+		previousVowel = vowel
+	}
+	// a final silent e, as in "make", but not "table"
+	if strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "le") && count > 1 {
+		count--
+	}
+	return max(count, 1)
+}
+
+// topKeywords returns the most frequent words, stop words of the page language and English left out
+func topKeywords(words []string, language string) []models.Keyword {
+	counts := map[string]int{}
+	for _, word := range words {
+		if utf8.RuneCountInString(word) < 3 || stopWords["en"][word] || stopWords[language][word] || isNumber(word) {
+			continue
+		}
+		counts[word]++
+	}
+
+	keywords := make([]models.Keyword, 0, len(counts))
+	for word, count := range counts {
+		keywords = append(keywords, models.Keyword{Word: word, Count: count})
+	}
+	sort.Slice(keywords, func(i, j int) bool {
+		if keywords[i].Count != keywords[j].Count {
+			return keywords[i].Count > keywords[j].Count
+		}
+		return keywords[i].Word < keywords[j].Word
+	})
+	if len(keywords) > topKeywordsCount {
+		keywords = keywords[:topKeywordsCount]
+	}
+	return keywords
+}
+
+func isNumber(word string) bool {
+	return strings.IndexFunc(word, func(r rune) bool { return !unicode.IsDigit(r) }) == -1
+}
+
+func truncateUTF8(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	s = s[:limit]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// contentHashes returns the hash of the normalised text, case and whitespace don't count,
+// and the hash of the structure, the headings and links in document order
+func contentHashes(text string, headings, links []string) (string, string) {
+	textSum := sha256.Sum256([]byte(strings.ToLower(strings.Join(strings.Fields(text), " "))))
+
+	var structure strings.Builder
+	for _, heading := range headings {
+		structure.WriteString(strings.ToLower(heading) + "\n")
+	}
+	structure.WriteString("\x00\n") // headings and links never mix up
+	for _, link := range links {
+		structure.WriteString(link + "\n")
+	}
+	structureSum := sha256.Sum256([]byte(structure.String()))
+
+	return hex.EncodeToString(textSum[:]), hex.EncodeToString(structureSum[:])
+}
+
+// UniqueLinks drops repeated links, keeping the first occurrence
+func UniqueLinks(links []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, link := range links {
+		if !seen[link] {
+			seen[link] = true
+			unique = append(unique, link)
+		}
+	}
+	return unique
+}
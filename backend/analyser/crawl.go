@@ -0,0 +1,284 @@
+package analyser
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
+	netURL "net/url"
+	"slices"
+	"strconv"
+	"time"
+	"web-scraper/logging"
+	"web-scraper/metrics"
+	"web-scraper/models"
+	"web-scraper/netguard"
+
+	"github.com/gocolly/colly/v2"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/httptrace/otelhttptrace"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// how long a request of the page, its iframes or the login step may take without a fetch budget
+const requestTimeout = 30 * time.Second
+
+// crawlRun is what a crawl collected, turned into the Result once it is over
+type crawlRun struct {
+	// err fails the run, budgets that ran out after the page was fetched only make it partial
+	err            error
+	partialReasons []string
+	statusCode     int
+
+	page    pageStats
+	content contentStats
+	// login detection of the page merged with the one of its iframes
+	login  models.LoginDetection
+	frames []models.FrameAnalysis
+
+	brokenLinks                     []models.BrokenLink
+	inaccessibleLinks, checkedLinks int
+
+	recorder *responseRecorder
+	// what is archived of the run, nil unless capturing is enabled
+	capture *Capture
+}
+
+// transport returns the round tripper every request of the analysis goes through, and a func releasing it
+func (opts Options) transport(session *crawlSession) (http.RoundTripper, func()) {
+	if opts.HTTPClient != nil {
+		if opts.HTTPClient.Transport != nil {
+			return &credentialScopedTransport{next: opts.HTTPClient.Transport, session: session}, func() {}
+		}
+		return &credentialScopedTransport{next: http.DefaultTransport, session: session}, func() {}
+	}
+
+	guard := netguard.Default()
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:               session.proxyFunc(),
+		DialContext:         guard.DialContext(dialer),
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	if session.proxy != nil {
+		// the proxy resolves the target itself, the guarded transport checks every URL before it's sent but can't
+		// pin the address. Pool proxies are only used once the operator declared them trusted (CRAWL_PROXY_TRUSTED).
+		transport.DialContext = dialer.DialContext
+	}
+
+	// outbound requests get client spans with DNS, connect and TLS timings. Nothing is propagated
+	// to the crawled sites, our trace ids are none of their business.
+	guardedTransport := otelhttp.NewTransport(guard.Transport(transport),
+		otelhttp.WithPropagators(propagation.NewCompositeTextMapPropagator()),
+		otelhttp.WithClientTrace(func(ctx context.Context) *httptrace.ClientTrace {
+			return otelhttptrace.NewClientTrace(ctx)
+		}),
+	)
+	// credentials are only sent to the profile site, also when a redirect leads elsewhere
+	return &credentialScopedTransport{next: guardedTransport, session: session}, transport.CloseIdleConnections
+}
+
+// crawlPage fetches the page at rawURL with the identity and credentials of opts.Profile, crawls its iframes and
+// checks its links within the budget, documentOnly stops after the page fetch. Cancelling ctx stops it, what was
+// done so far is returned.
+func crawlPage(ctx context.Context, rawURL string, opts Options, documentOnly bool) *crawlRun {
+	logger := logging.FromContext(ctx)
+	budget := opts.Budget
+	run := &crawlRun{brokenLinks: []models.BrokenLink{}, frames: []models.FrameAnalysis{}}
+
+	pageURL, err := netURL.Parse(rawURL)
+	if err != nil {
+		run.err = fmt.Errorf("%w %w", errInvalidURL, err)
+	}
+
+	// the jar is shared by the page, its iframes, the login step and same-site link checks
+	jar, _ := cookiejar.New(nil)
+
+	session := newCrawlSession(opts.Profile, pageURL, opts)
+	if opts.Profile != nil {
+		session.seedCookies(jar, pageURL)
+		logger.Info("Applying crawl profile", "profile_id", opts.Profile.ID, "site", session.site)
+	}
+
+	// the transport is shared with the link checker so both go out with the same proxy and SSRF policy
+	transport, closeTransport := opts.transport(session)
+	defer closeTransport()
+
+	timeout := requestTimeout
+	if opts.HTTPClient != nil && opts.HTTPClient.Timeout > 0 {
+		timeout = opts.HTTPClient.Timeout
+	}
+	// the page fetch also records its redirect chain, headers and timings, see withResponseRecorder,
+	// and is captured for archiving with Options.Capture, see withSnapshotCapture
+	httpClientColly := &http.Client{
+		Transport: &capturingTransport{next: &recordingTransport{next: transport}},
+		Timeout:   timeout,
+		Jar:       jar,
+	}
+
+	// every document (the page and its iframes) gets its own collector sharing the same client
+	// requests run with reqCtx, for cancellation and to nest their spans under the crawl phase
+	newCollectorWithContext := func(reqCtx context.Context) *colly.Collector {
+		c := colly.NewCollector(
+			colly.MaxDepth(1), //just vist one link
+			colly.StdlibContext(reqCtx),
+		)
+		c.SetRequestTimeout(timeout)
+		c.SetClient(httpClientColly)
+		session.registerOn(c)
+		c.OnResponse(func(r *colly.Response) {
+			metrics.HTTPResponses.WithLabelValues("crawl", strconv.Itoa(r.StatusCode)).Inc()
+		})
+		c.OnError(func(r *colly.Response, err error) {
+			metrics.HTTPResponses.WithLabelValues("crawl", responseCodeLabel(r.StatusCode)).Inc()
+		})
+		return c
+	}
+
+	// newCollectorFor returns a collector factory whose requests belong to phaseCtx
+	newCollectorFor := func(phaseCtx context.Context) func() *colly.Collector {
+		return func() *colly.Collector { return newCollectorWithContext(phaseCtx) }
+	}
+
+	if run.err == nil && !documentOnly && session.profile != nil && session.profile.Credentials.FormLogin != nil {
+		loginCtx, loginSpan := tracer.Start(ctx, "crawl.login")
+		if err := session.login(loginCtx, newCollectorFor(loginCtx)); err != nil {
+			run.err = fmt.Errorf("%w %w", errLoginFailed, err)
+			endSpanWithError(loginSpan, run.err)
+		}
+		loginSpan.End()
+	}
+
+	fetchCtx, cancelFetch := withBudget(ctx, budget.FetchTimeout, errFetchBudget)
+	defer cancelFetch()
+	fetchCtx, fetchSpan := tracer.Start(fetchCtx, "crawl.fetch", trace.WithAttributes(attribute.String("url.full", rawURL)))
+	fetchCtx, run.recorder = withResponseRecorder(fetchCtx)
+
+	if opts.Capture.Enabled {
+		run.capture = &Capture{maxBodyBytes: opts.Capture.MaxBodyBytes, redact: redactedHeaders(session)}
+		fetchCtx = withSnapshotCapture(fetchCtx, run.capture)
+	}
+
+	c := newCollectorWithContext(fetchCtx)
+
+	c.OnError(func(r *colly.Response, err error) {
+		run.statusCode = r.StatusCode
+		run.err = responseError(r, err)
+
+		logger.Warn("Page fetch failed", "status_code", r.StatusCode, "error", run.err)
+	})
+
+	c.OnResponse(func(r *colly.Response) {
+		run.statusCode = r.StatusCode
+	})
+
+	registerPageHandlers(c, &run.page, logger)
+	registerContentExtractors(c, &run.content, opts.StoreMainContent)
+	var resources []string
+	if run.capture != nil && opts.Capture.Resources && !documentOnly {
+		registerResourceCollector(c, &resources)
+	}
+
+	if run.err == nil {
+		err := c.Visit(rawURL)
+
+		if err != nil {
+			if run.err == nil {
+				run.err = fmt.Errorf("%w %w", errVisitFailure, err)
+			}
+		} else if run.err == nil {
+			logger.Info("Page fetched", "status_code", run.statusCode, "links", len(run.page.links), "iframes", len(run.page.iframes))
+		}
+
+		session.reportProxy(run.statusCode, run.err)
+	}
+
+	// without the page there is nothing to keep, a budget running out here fails the analysis
+	if err := BudgetExceeded(fetchCtx); err != nil && run.err != nil {
+		run.err = err
+	}
+	cancelFetch()
+
+	fetchSpan.SetAttributes(attribute.Int("http.response.status_code", run.statusCode), attribute.Int("page.links", len(run.page.links)))
+	endSpanWithError(fetchSpan, run.err)
+	fetchSpan.End()
+
+	run.login = run.page.login
+	if run.err != nil || documentOnly {
+		return run
+	}
+
+	if len(resources) > 0 {
+		if len(resources) > opts.Capture.MaxResources {
+			resources = resources[:opts.Capture.MaxResources]
+		}
+		resourcesCtx, cancelResources := withBudget(withSnapshotCapture(ctx, run.capture), budget.FetchTimeout, errFetchBudget)
+		fetched := fetchResources(resourcesCtx, httpClientColly, session, resources)
+		cancelResources()
+		logger.Info("Archived page resources", "resources", len(resources), "fetched", fetched)
+	}
+
+	allLinks := slices.Clone(run.page.links)
+	// links found only inside iframes, mapped to the frame they came from
+	linkFrames := map[string]string{}
+
+	if opts.Iframes.Enabled && len(run.page.iframes) > 0 {
+		var frameLinks []frameLink
+		var frameLogins map[string]models.LoginDetection
+		framesCtx, framesSpan := tracer.Start(ctx, "crawl.iframes")
+		run.frames, frameLinks, frameLogins = crawlFrames(framesCtx, newCollectorFor(framesCtx), pageURL, run.page.iframes, opts.Iframes)
+		framesSpan.SetAttributes(attribute.Int("iframes.crawled", len(run.frames)))
+		framesSpan.End()
+
+		if err := BudgetExceeded(framesCtx); err != nil {
+			run.partialReasons = append(run.partialReasons, fmt.Sprintf("iframe crawling stopped: %v", err))
+		}
+
+		topLinks := make(map[string]bool, len(run.page.links))
+		for _, link := range run.page.links {
+			topLinks[link] = true
+		}
+		for _, fl := range frameLinks {
+			allLinks = append(allLinks, fl.url)
+			if _, ok := linkFrames[fl.url]; !ok && !topLinks[fl.url] {
+				linkFrames[fl.url] = fl.frame
+			}
+		}
+
+		for _, frame := range run.frames {
+			run.login = MergeFrameLogin(run.login, frame.URL, frameLogins[frame.URL])
+		}
+		logger.Info("Crawled iframes", "frames", len(run.frames), "frame_links", len(frameLinks))
+	}
+
+	// a link on the page and in a frame, or twice on the page, is checked and reported once
+	uniqueLinks := UniqueLinks(allLinks)
+	linksToCheck := uniqueLinks
+	if budget.MaxLinks > 0 && len(linksToCheck) > budget.MaxLinks {
+		run.partialReasons = append(run.partialReasons, fmt.Sprintf("link limit reached, the first %d of %d links were checked", budget.MaxLinks, len(uniqueLinks)))
+		linksToCheck = linksToCheck[:budget.MaxLinks]
+	}
+
+	linksCtx, cancelLinks := withBudget(ctx, budget.LinkCheckBudget, errLinkCheckBudget)
+	linksCtx, linksSpan := tracer.Start(linksCtx, "crawl.link_checks", trace.WithAttributes(attribute.Int("links.total", len(linksToCheck))))
+	run.brokenLinks, run.inaccessibleLinks, run.checkedLinks = checkLinks(linksCtx, linksToCheck, session, transport, jar, budget.LinkCheckTimeout)
+	if err := BudgetExceeded(linksCtx); err != nil && run.checkedLinks < len(linksToCheck) {
+		run.partialReasons = append(run.partialReasons, fmt.Sprintf("%v, %d of %d links checked", err, run.checkedLinks, len(linksToCheck)))
+	}
+	linksSpan.SetAttributes(attribute.Int("links.broken", run.inaccessibleLinks), attribute.Int("links.checked", run.checkedLinks))
+	linksSpan.End()
+	cancelLinks()
+	logger.Info("Checked links", "links", len(linksToCheck), "checked", run.checkedLinks, "broken", run.inaccessibleLinks)
+
+	for i := range run.brokenLinks {
+		run.brokenLinks[i].Frame = linkFrames[run.brokenLinks[i].URL]
+	}
+	return run
+}
@@ -0,0 +1,70 @@
+package analyser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"web-scraper/config"
+)
+
+// cancellation causes of the crawl budgets, an analysis that runs out of budget after its page was fetched
+// finishes as "partial" instead of errored
+var (
+	errCrawlDeadline   = errors.New("crawl deadline exceeded")
+	errFetchBudget     = errors.New("page fetch budget exceeded")
+	errLinkCheckBudget = errors.New("link check budget exceeded")
+)
+
+// Budget limits a single analysis, zero durations and a zero MaxLinks mean no limit
+type Budget struct {
+	// Deadline bounds the whole analysis
+	Deadline time.Duration
+	// FetchTimeout bounds the page fetch
+	FetchTimeout time.Duration
+	// LinkCheckBudget bounds all link checks together, LinkCheckTimeout each of them
+	LinkCheckBudget  time.Duration
+	LinkCheckTimeout time.Duration
+	// MaxLinks caps the links checked
+	MaxLinks int
+}
+
+// BudgetFromEnv reads the limits of a single analysis
+// CRAWL_DEADLINE bounds the whole analysis (default 5m), CRAWL_FETCH_TIMEOUT the page fetch (default 30s),
+// CRAWL_LINK_CHECK_BUDGET all link checks together (default 2m) and CRAWL_LINK_CHECK_TIMEOUT each of them (default 5s).
+// CRAWL_MAX_LINKS caps the links checked (default 1000, 0 means no cap).
+func BudgetFromEnv() Budget {
+	return Budget{
+		Deadline:         config.GetEnvDuration("CRAWL_DEADLINE", 5*time.Minute),
+		FetchTimeout:     config.GetEnvDuration("CRAWL_FETCH_TIMEOUT", 30*time.Second),
+		LinkCheckBudget:  config.GetEnvDuration("CRAWL_LINK_CHECK_BUDGET", 2*time.Minute),
+		LinkCheckTimeout: config.GetEnvDuration("CRAWL_LINK_CHECK_TIMEOUT", 5*time.Second),
+		MaxLinks:         config.GetEnvInt("CRAWL_MAX_LINKS", 1000),
+	}
+}
+
+// BudgetExceeded returns the budget cause ctx was cancelled with, nil when it wasn't cancelled by a budget
+func BudgetExceeded(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	for _, budgetErr := range []error{errCrawlDeadline, errFetchBudget, errLinkCheckBudget} {
+		if errors.Is(cause, budgetErr) {
+			return cause
+		}
+	}
+	return nil
+}
+
+// WithDeadline returns ctx bounded by the deadline of budget, running out of it cancels ctx with a cause
+// BudgetExceeded recognises
+func WithDeadline(ctx context.Context, budget Budget) (context.Context, context.CancelFunc) {
+	return withBudget(ctx, budget.Deadline, errCrawlDeadline)
+}
+
+// withBudget returns ctx bounded by limit, exceeding it cancels with a cause naming the budget.
+// Without a limit ctx is only cancelled by its parent.
+func withBudget(ctx context.Context, limit time.Duration, budgetErr error) (context.Context, context.CancelFunc) {
+	if limit <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, limit, fmt.Errorf("%w (%s)", budgetErr, limit))
+}
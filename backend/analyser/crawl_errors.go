@@ -0,0 +1,125 @@
+package analyser
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"web-scraper/netguard"
+)
+
+// categories of failed analyses
+const (
+	ErrorCategoryInvalidURL         = "invalid_url"
+	ErrorCategoryBlockedDestination = "blocked_destination"
+	ErrorCategoryDNS                = "dns"
+	ErrorCategoryConnection         = "connection"
+	ErrorCategoryTimeout            = "timeout"
+	ErrorCategoryTLS                = "tls"
+	ErrorCategoryHTTPClient         = "http_4xx"
+	ErrorCategoryHTTPServer         = "http_5xx"
+	ErrorCategoryBotProtection      = "bot_protection"
+	ErrorCategoryBudget             = "budget"
+	ErrorCategoryLogin              = "login"
+	ErrorCategoryInternal           = "internal"
+	ErrorCategoryUnknown            = "unknown"
+)
+
+var (
+	errInvalidURL   = errors.New("invalid url")
+	errLoginFailed  = errors.New("crawl profile login failed")
+	errVisitFailure = errors.New("visit error")
+)
+
+// Failure is the classification of a crawl error, transient failures are worth retrying
+type Failure struct {
+	Category  string
+	Transient bool
+}
+
+// Classify sorts err into a category and decides whether it is transient.
+// statusCode is the HTTP status of the page, 0 when no response was received.
+func Classify(err error, statusCode int) Failure {
+	if errors.Is(err, errLoginFailed) {
+		// wrong credentials or a changed form won't fix themselves, network trouble on the way might
+		failure := classifyCauses(err, 0)
+		return Failure{Category: ErrorCategoryLogin, Transient: failure.Transient}
+	}
+	return classifyCauses(err, statusCode)
+}
+
+func classifyCauses(err error, statusCode int) Failure {
+	switch {
+	case errors.Is(err, errInvalidURL):
+		return Failure{ErrorCategoryInvalidURL, false}
+	case errors.Is(err, netguard.ErrBlockedDestination):
+		return Failure{ErrorCategoryBlockedDestination, false}
+	case errors.Is(err, errFetchBudget), errors.Is(err, errCrawlDeadline):
+		return Failure{ErrorCategoryBudget, true}
+	}
+
+	if statusCode >= 400 {
+		return classifyStatus(err, statusCode)
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		// a host that doesn't exist stays that way, resolver hiccups don't
+		return Failure{ErrorCategoryDNS, !dnsErr.IsNotFound}
+	}
+
+	var certInvalid x509.CertificateInvalidError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certVerification *tls.CertificateVerificationError
+	var recordHeader tls.RecordHeaderError
+	var opErr *net.OpError
+	if errors.As(err, &certInvalid) || errors.As(err, &unknownAuthority) || errors.As(err, &hostnameErr) ||
+		errors.As(err, &certVerification) || errors.As(err, &recordHeader) ||
+		// an https URL served by a plain HTTP server
+		errors.Is(err, http.ErrSchemeMismatch) ||
+		// TLS alerts of the server, e.g. a handshake failure over unsupported protocol versions
+		(errors.As(err, &opErr) && opErr.Op == "remote error") {
+		return Failure{ErrorCategoryTLS, false}
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return Failure{ErrorCategoryTimeout, true}
+	}
+
+	// connections dropped halfway may work next time
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return Failure{ErrorCategoryConnection, true}
+	}
+	// refused connections and unreachable hosts, nothing listens there and retrying won't change that
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH) ||
+		errors.As(err, &opErr) {
+		return Failure{ErrorCategoryConnection, false}
+	}
+
+	return Failure{ErrorCategoryUnknown, false}
+}
+
+func classifyStatus(err error, statusCode int) Failure {
+	if errors.Is(err, ErrBlockedByBotProtection) {
+		// rate limits and challenges lift after a while, a plain 403 usually doesn't
+		return Failure{ErrorCategoryBotProtection, statusCode != http.StatusForbidden}
+	}
+
+	switch statusCode {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+		return Failure{ErrorCategoryHTTPClient, true}
+	case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+		return Failure{ErrorCategoryHTTPServer, false}
+	}
+
+	if statusCode >= 500 {
+		return Failure{ErrorCategoryHTTPServer, true}
+	}
+	return Failure{ErrorCategoryHTTPClient, false}
+}
@@ -0,0 +1,143 @@
+package analyser
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	netURL "net/url"
+	"os"
+	"syscall"
+	"testing"
+	"web-scraper/netguard"
+)
+
+// requestError wraps err the way http.Client returns the errors of a request
+func requestError(err error) error {
+	return fmt.Errorf("%w %w", errVisitFailure, &netURL.Error{Op: "Get", URL: "https://example.com/", Err: err})
+}
+
+// statusError is the error of a page answered with statusCode, see responseError
+func statusError(statusCode int) error {
+	return fmt.Errorf("HTTP Error %d - %w", statusCode, errors.New(http.StatusText(statusCode)))
+}
+
+func botError(statusCode int) error {
+	return fmt.Errorf("%w - HTTP %d", ErrBlockedByBotProtection, statusCode)
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		statusCode int
+		want       Failure
+	}{
+		{"invalid URL", fmt.Errorf("%w %w", errInvalidURL, errors.New("missing scheme")), 0, Failure{ErrorCategoryInvalidURL, false}},
+		{"blocked destination", requestError(fmt.Errorf("%w: 10.0.0.1 is an internal address", netguard.ErrBlockedDestination)), 0, Failure{ErrorCategoryBlockedDestination, false}},
+		{"fetch budget", fmt.Errorf("%w %w", errVisitFailure, errFetchBudget), 0, Failure{ErrorCategoryBudget, true}},
+		{"crawl deadline", errCrawlDeadline, 0, Failure{ErrorCategoryBudget, true}},
+
+		// DNS
+		{"host not found", requestError(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "nope.example", IsNotFound: true}}), 0, Failure{ErrorCategoryDNS, false}},
+		{"resolver failure", requestError(&net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}), 0, Failure{ErrorCategoryDNS, true}},
+		{"resolver timeout", requestError(&net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}), 0, Failure{ErrorCategoryDNS, true}},
+		{"host not found in the check of the SSRF policy", requestError(fmt.Errorf("nope.example: %w", &net.DNSError{Name: "nope.example", IsNotFound: true})), 0, Failure{ErrorCategoryDNS, false}},
+
+		// TLS
+		{"unknown authority", requestError(&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}), 0, Failure{ErrorCategoryTLS, false}},
+		{"expired certificate", requestError(x509.CertificateInvalidError{Reason: x509.Expired}), 0, Failure{ErrorCategoryTLS, false}},
+		{"wrong host name", requestError(x509.HostnameError{Host: "example.com", Certificate: &x509.Certificate{}}), 0, Failure{ErrorCategoryTLS, false}},
+		{"not TLS", requestError(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}), 0, Failure{ErrorCategoryTLS, false}},
+		{"handshake alert", requestError(&net.OpError{Op: "remote error", Err: errors.New("tls: handshake failure")}), 0, Failure{ErrorCategoryTLS, false}},
+
+		// timeouts
+		{"deadline", requestError(context.DeadlineExceeded), 0, Failure{ErrorCategoryTimeout, true}},
+		{"read timeout", requestError(&net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}), 0, Failure{ErrorCategoryTimeout, true}},
+
+		// connections
+		{"connection reset", requestError(&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), 0, Failure{ErrorCategoryConnection, true}},
+		{"broken pipe", requestError(&net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}), 0, Failure{ErrorCategoryConnection, true}},
+		{"unexpected EOF", requestError(io.ErrUnexpectedEOF), 0, Failure{ErrorCategoryConnection, true}},
+		{"connection refused", requestError(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), 0, Failure{ErrorCategoryConnection, false}},
+		{"network unreachable", requestError(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ENETUNREACH)}), 0, Failure{ErrorCategoryConnection, false}},
+		{"unknown", errors.New("something else"), 0, Failure{ErrorCategoryUnknown, false}},
+
+		// 4xx
+		{"not found", statusError(http.StatusNotFound), http.StatusNotFound, Failure{ErrorCategoryHTTPClient, false}},
+		{"gone", statusError(http.StatusGone), http.StatusGone, Failure{ErrorCategoryHTTPClient, false}},
+		{"unauthorized", statusError(http.StatusUnauthorized), http.StatusUnauthorized, Failure{ErrorCategoryHTTPClient, false}},
+		{"request timeout", statusError(http.StatusRequestTimeout), http.StatusRequestTimeout, Failure{ErrorCategoryHTTPClient, true}},
+		{"too early", statusError(http.StatusTooEarly), http.StatusTooEarly, Failure{ErrorCategoryHTTPClient, true}},
+		{"too many requests", statusError(http.StatusTooManyRequests), http.StatusTooManyRequests, Failure{ErrorCategoryHTTPClient, true}},
+
+		// 5xx
+		{"internal server error", statusError(http.StatusInternalServerError), http.StatusInternalServerError, Failure{ErrorCategoryHTTPServer, true}},
+		{"bad gateway", statusError(http.StatusBadGateway), http.StatusBadGateway, Failure{ErrorCategoryHTTPServer, true}},
+		{"service unavailable", statusError(http.StatusServiceUnavailable), http.StatusServiceUnavailable, Failure{ErrorCategoryHTTPServer, true}},
+		{"gateway timeout", statusError(http.StatusGatewayTimeout), http.StatusGatewayTimeout, Failure{ErrorCategoryHTTPServer, true}},
+		{"not implemented", statusError(http.StatusNotImplemented), http.StatusNotImplemented, Failure{ErrorCategoryHTTPServer, false}},
+		{"HTTP version not supported", statusError(http.StatusHTTPVersionNotSupported), http.StatusHTTPVersionNotSupported, Failure{ErrorCategoryHTTPServer, false}},
+		{"status wins over the error", requestError(context.DeadlineExceeded), http.StatusNotFound, Failure{ErrorCategoryHTTPClient, false}},
+
+		// bot protection
+		{"forbidden by bot protection", botError(http.StatusForbidden), http.StatusForbidden, Failure{ErrorCategoryBotProtection, false}},
+		{"rate limited by bot protection", botError(http.StatusTooManyRequests), http.StatusTooManyRequests, Failure{ErrorCategoryBotProtection, true}},
+		{"challenge page", botError(http.StatusServiceUnavailable), http.StatusServiceUnavailable, Failure{ErrorCategoryBotProtection, true}},
+
+		// login, transient when the cause is, whatever the status of the page
+		{"login rejected", fmt.Errorf("%w login submit: %w", errLoginFailed, statusError(http.StatusUnauthorized)), 0, Failure{ErrorCategoryLogin, false}},
+		{"login page timed out", fmt.Errorf("%w login page: %w", errLoginFailed, requestError(context.DeadlineExceeded)), 0, Failure{ErrorCategoryLogin, true}},
+		{"login resolver failure", fmt.Errorf("%w %w", errLoginFailed, requestError(&net.DNSError{IsTemporary: true})), http.StatusInternalServerError, Failure{ErrorCategoryLogin, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err, tt.statusCode); got != tt.want {
+				t.Errorf("Classify(%v, %d) = %+v, want %+v", tt.err, tt.statusCode, got, tt.want)
+			}
+		})
+	}
+}
+
+// the errors of real requests, not only the ones built above
+func TestClassifyRequestErrors(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedURL := "http://" + closed.Addr().String() + "/"
+	closed.Close()
+
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+	plainServer := httptest.NewServer(http.NotFoundHandler())
+	defer plainServer.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		want Failure
+	}{
+		{"connection refused", closedURL, Failure{ErrorCategoryConnection, false}},
+		{"self-signed certificate", tlsServer.URL, Failure{ErrorCategoryTLS, false}},
+		{"TLS to a plain HTTP server", "https://" + plainServer.Listener.Addr().String() + "/", Failure{ErrorCategoryTLS, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(tt.url)
+			if err == nil {
+				resp.Body.Close()
+				t.Fatalf("GET %s succeeded", tt.url)
+			}
+			if got := Classify(requestError(err), 0); got != tt.want {
+				t.Errorf("Classify(%v) = %+v, want %+v", err, got, tt.want)
+			}
+		})
+	}
+}
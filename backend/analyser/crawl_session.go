@@ -0,0 +1,316 @@
+package analyser
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	netURL "net/url"
+	"slices"
+	"strings"
+	"web-scraper/logging"
+	"web-scraper/models"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// DefaultUserAgent identifies the crawler when neither the options nor the profile set a user agent
+const DefaultUserAgent = "url-analyser-bot/1.0"
+
+// ErrBlockedByBotProtection is reported instead of a generic HTTP error when a site refuses the crawler
+var ErrBlockedByBotProtection = errors.New("blocked by bot protection")
+
+// crawlSession carries the identity and crawl profile of one analysis run.
+// Identity headers go to every host, credentials are only ever sent to the profile site.
+type crawlSession struct {
+	profile *models.CrawlProfile // nil when no profile applies
+	site    string
+
+	userAgent      string
+	acceptLanguage string
+	extraHeaders   map[string]string
+	proxy          *poolProxy
+}
+
+// HostMatchesSite reports whether host is site or one of its subdomains, how crawl profiles are matched to URLs
+func HostMatchesSite(host, site string) bool {
+	host = strings.ToLower(host)
+	site = strings.ToLower(strings.TrimPrefix(site, "."))
+	return host == site || strings.HasSuffix(host, "."+site)
+}
+
+// newCrawlSession builds the session of a crawl, the identity of opts is overridden by the profile
+func newCrawlSession(profile *models.CrawlProfile, pageURL *netURL.URL, opts Options) *crawlSession {
+	s := &crawlSession{
+		profile:        profile,
+		userAgent:      opts.UserAgent,
+		acceptLanguage: opts.AcceptLanguage,
+		extraHeaders:   map[string]string{},
+	}
+	useProxyPool := opts.UseProxyPool
+
+	if profile != nil {
+		s.site = profile.Site
+		if s.site == "" && pageURL != nil {
+			s.site = pageURL.Hostname()
+		}
+		if profile.UserAgent != "" {
+			s.userAgent = profile.UserAgent
+		}
+		if profile.AcceptLanguage != "" {
+			s.acceptLanguage = profile.AcceptLanguage
+		}
+		for name, value := range profile.ExtraHeaders {
+			s.extraHeaders[name] = value
+		}
+		useProxyPool = useProxyPool || profile.UseProxyPool
+	}
+
+	if s.userAgent == "" {
+		s.userAgent = DefaultUserAgent
+	}
+	if useProxyPool && opts.HTTPClient == nil {
+		s.proxy = defaultProxyPool().pick()
+	}
+	return s
+}
+
+// proxyFunc routes requests through the proxy picked for the session, or the environment proxy settings
+func (s *crawlSession) proxyFunc() func(*http.Request) (*netURL.URL, error) {
+	if s.proxy == nil {
+		return http.ProxyFromEnvironment
+	}
+	return http.ProxyURL(s.proxy.url)
+}
+
+// reportProxy feeds the outcome of the crawl into the proxy pool health tracking.
+// Network errors and refusals (403, 407, 429) count against the proxy.
+func (s *crawlSession) reportProxy(statusCode int, crawlError error) {
+	if s.proxy == nil {
+		return
+	}
+
+	failed := crawlError != nil && (statusCode == 0 || statusCode == http.StatusForbidden ||
+		statusCode == http.StatusProxyAuthRequired || statusCode == http.StatusTooManyRequests)
+	defaultProxyPool().report(s.proxy, failed)
+}
+
+// identityHeaders are sent with every request of the crawl
+func (s *crawlSession) identityHeaders() http.Header {
+	header := http.Header{}
+	for name, value := range s.extraHeaders {
+		header.Set(name, value)
+	}
+	header.Set("User-Agent", s.userAgent)
+	if s.acceptLanguage != "" {
+		header.Set("Accept-Language", s.acceptLanguage)
+	}
+	return header
+}
+
+// appliesTo reports whether credentials may be sent to u
+func (s *crawlSession) appliesTo(u *netURL.URL) bool {
+	return s.profile != nil && HostMatchesSite(u.Hostname(), s.site)
+}
+
+// credentialHeaders returns the profile headers, basic auth included as Authorization header
+func (s *crawlSession) credentialHeaders() http.Header {
+	header := http.Header{}
+	for name, value := range s.profile.Credentials.Headers {
+		header.Set(name, value)
+	}
+	if ba := s.profile.Credentials.BasicAuth; ba != nil {
+		token := base64.StdEncoding.EncodeToString([]byte(ba.Username + ":" + ba.Password))
+		header.Set("Authorization", "Basic "+token)
+	}
+	return header
+}
+
+// authorize adds the identity headers to req, and the profile headers and basic auth when it targets the profile site
+func (s *crawlSession) authorize(req *http.Request) {
+	for name, values := range s.identityHeaders() {
+		req.Header[name] = values
+	}
+	if !s.appliesTo(req.URL) {
+		return
+	}
+	for name, values := range s.credentialHeaders() {
+		req.Header[name] = values
+	}
+}
+
+// credentialScopedTransport removes the profile credentials from requests leaving the profile site. http.Client
+// copies the headers of a request to its redirects, a redirect to another host would carry them along.
+type credentialScopedTransport struct {
+	next    http.RoundTripper
+	session *crawlSession
+}
+
+func (t *credentialScopedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.session.profile == nil || t.session.appliesTo(req.URL) {
+		return t.next.RoundTrip(req)
+	}
+
+	var stripped *http.Request
+	for name, values := range t.session.credentialHeaders() {
+		if !slices.Equal(req.Header.Values(name), values) {
+			// not a credential, e.g. an identity header of the same name
+			continue
+		}
+		if stripped == nil {
+			// a RoundTripper must not modify the request it is given
+			stripped = req.Clone(req.Context())
+		}
+		stripped.Header.Del(name)
+	}
+	if stripped == nil {
+		return t.next.RoundTrip(req)
+	}
+	return t.next.RoundTrip(stripped)
+}
+
+// seedCookies puts the profile cookies into jar for the profile site
+func (s *crawlSession) seedCookies(jar http.CookieJar, pageURL *netURL.URL) {
+	if s.profile == nil || len(s.profile.Credentials.Cookies) == 0 {
+		return
+	}
+
+	cookieURL := &netURL.URL{Scheme: pageURL.Scheme, Host: pageURL.Host, Path: "/"}
+	if !s.appliesTo(pageURL) {
+		cookieURL.Host = s.site
+	}
+
+	cookies := make([]*http.Cookie, 0, len(s.profile.Credentials.Cookies))
+	for _, pc := range s.profile.Credentials.Cookies {
+		path := pc.Path
+		if path == "" {
+			path = "/"
+		}
+		cookies = append(cookies, &http.Cookie{Name: pc.Name, Value: pc.Value, Path: path, Domain: s.site})
+	}
+	jar.SetCookies(cookieURL, cookies)
+}
+
+// registerOn makes every request of c carry the session identity and, on the profile site, its credentials
+func (s *crawlSession) registerOn(c *colly.Collector) {
+	c.UserAgent = s.userAgent
+
+	identity := s.identityHeaders()
+	var credentials http.Header
+	if s.profile != nil {
+		credentials = s.credentialHeaders()
+	}
+
+	c.OnRequest(func(r *colly.Request) {
+		for name, values := range identity {
+			(*r.Headers)[name] = values
+		}
+		if !s.appliesTo(r.URL) {
+			return
+		}
+		for name, values := range credentials {
+			(*r.Headers)[name] = values
+		}
+	})
+}
+
+// login runs the scripted form login of the profile, session cookies end up in the shared client jar
+func (s *crawlSession) login(ctx context.Context, newCollector func() *colly.Collector) error {
+	if s.profile == nil || s.profile.Credentials.FormLogin == nil {
+		return nil
+	}
+
+	formLogin := s.profile.Credentials.FormLogin
+	selector := formLogin.FormSelector
+	if selector == "" {
+		selector = "form:has(input[type=password])"
+	}
+
+	// newCollector registered the session on c already
+	c := newCollector()
+
+	var action string
+	var found bool
+	fields := map[string]string{}
+
+	c.OnHTML(selector, func(e *colly.HTMLElement) {
+		if found {
+			return
+		}
+		found = true
+
+		action = e.Request.AbsoluteURL(e.Attr("action"))
+		if action == "" {
+			action = e.Request.URL.String()
+		}
+		// keep hidden inputs such as CSRF tokens
+		e.ForEach("input[type=hidden]", func(_ int, input *colly.HTMLElement) {
+			if name := input.Attr("name"); name != "" {
+				fields[name] = input.Attr("value")
+			}
+		})
+	})
+
+	var loginError error
+	c.OnError(func(r *colly.Response, err error) {
+		loginError = responseError(r, err)
+	})
+
+	if err := c.Visit(formLogin.PageURL); err != nil && loginError == nil {
+		loginError = fmt.Errorf("%w %w", errVisitFailure, err)
+	}
+	if loginError != nil {
+		return fmt.Errorf("login page: %w", loginError)
+	}
+	if !found {
+		return errors.New("login page has no form matching " + selector)
+	}
+
+	// the fields are the credentials of the profile, like its headers they only go to the profile site
+	actionURL, err := netURL.Parse(action)
+	if err != nil {
+		return fmt.Errorf("login form action %q: %w", action, err)
+	}
+	if !s.appliesTo(actionURL) {
+		return fmt.Errorf("login form posts to %s, outside the profile site %s", actionURL.Hostname(), s.site)
+	}
+
+	for name, value := range formLogin.Fields {
+		fields[name] = value
+	}
+
+	if err := c.Post(action, fields); err != nil && loginError == nil {
+		loginError = fmt.Errorf("%w %w", errVisitFailure, err)
+	}
+	if loginError != nil {
+		return fmt.Errorf("login submit: %w", loginError)
+	}
+
+	logging.FromContext(ctx).Info("Form login completed", "profile_id", s.profile.ID, "action", action)
+	return nil
+}
+
+// isBotBlock reports whether a response looks like a bot protection refusal rather than a real page error
+func isBotBlock(statusCode int, header http.Header) bool {
+	if statusCode == http.StatusForbidden || statusCode == http.StatusTooManyRequests {
+		return true
+	}
+	// challenge pages of CDNs e.g. Cloudflare answer 503 with a mitigation header
+	return statusCode == http.StatusServiceUnavailable && header != nil && header.Get("Cf-Mitigated") != ""
+}
+
+// responseError turns a colly error into the error reported for the analysis
+func responseError(r *colly.Response, err error) error {
+	if isBotBlock(r.StatusCode, headerOf(r)) {
+		return fmt.Errorf("%w - HTTP %d", ErrBlockedByBotProtection, r.StatusCode)
+	}
+	return fmt.Errorf("HTTP Error %d - %w", r.StatusCode, err)
+}
+
+func headerOf(r *colly.Response) http.Header {
+	if r.Headers == nil {
+		return nil
+	}
+	return *r.Headers
+}
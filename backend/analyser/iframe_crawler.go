@@ -0,0 +1,137 @@
+package analyser
+
+import (
+	"context"
+	"fmt"
+	netURL "net/url"
+	"web-scraper/logging"
+	"web-scraper/models"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// upper bound of iframes crawled for a single page, so a page full of widgets can't hold a worker forever
+const maxFramesPerPage = 20
+
+// IframeOptions controls iframe crawling, the documents of iframes get the page analysis and their links are checked
+type IframeOptions struct {
+	Enabled bool
+	// MaxDepth limits the nesting of iframes followed
+	MaxDepth int
+	// AllowCrossOrigin also crawls iframes of other origins than the page
+	AllowCrossOrigin bool
+}
+
+// frameLink is a link found inside an iframe together with the frame it came from
+type frameLink struct {
+	url   string
+	frame string
+}
+
+type frameTarget struct {
+	url    string
+	parent string
+	depth  int
+}
+
+func sameOrigin(a, b *netURL.URL) bool {
+	return a.Scheme == b.Scheme && a.Host == b.Host
+}
+
+// crawlFrames runs the page analysis on the documents embedded by iframes, breadth first up to opts.MaxDepth.
+// Nested iframes are only followed from frames that could be crawled. Login detections are returned keyed by frame URL.
+func crawlFrames(ctx context.Context, newCollector func() *colly.Collector, pageURL *netURL.URL, iframes []string, opts IframeOptions) ([]models.FrameAnalysis, []frameLink, map[string]models.LoginDetection) {
+	logger := logging.FromContext(ctx)
+	frames := []models.FrameAnalysis{}
+	var links []frameLink
+	logins := map[string]models.LoginDetection{}
+
+	seen := map[string]bool{pageURL.String(): true}
+	var pending []frameTarget
+	for _, src := range iframes {
+		pending = append(pending, frameTarget{url: src, parent: pageURL.String(), depth: 1})
+	}
+
+	for len(pending) > 0 && len(frames) < maxFramesPerPage {
+		select {
+		case <-ctx.Done():
+			logger.Warn("Context cancelled while crawling iframes")
+			return frames, links, logins
+		default:
+		}
+
+		target := pending[0]
+		pending = pending[1:]
+
+		if seen[target.url] {
+			continue
+		}
+		seen[target.url] = true
+
+		frameURL, err := netURL.Parse(target.url)
+		if err != nil || (frameURL.Scheme != "http" && frameURL.Scheme != "https") {
+			continue // about:blank, data: and javascript: frames have nothing to fetch
+		}
+
+		crossOrigin := !sameOrigin(pageURL, frameURL)
+		if crossOrigin && !opts.AllowCrossOrigin {
+			logger.Info("Skipping cross-origin iframe", "frame", target.url)
+			continue
+		}
+
+		frame := models.FrameAnalysis{
+			URL:         target.url,
+			ParentURL:   target.parent,
+			Depth:       target.depth,
+			CrossOrigin: crossOrigin,
+		}
+
+		var stats pageStats
+		var frameError error
+
+		c := newCollector()
+		registerPageHandlers(c, &stats, logger)
+		c.OnError(func(r *colly.Response, err error) {
+			frameError = responseError(r, err)
+		})
+
+		if err := c.Visit(target.url); err != nil && frameError == nil {
+			frameError = fmt.Errorf("%w %w", errVisitFailure, err)
+		}
+
+		if frameError != nil {
+			logger.Warn("Iframe fetch failed", "frame", target.url, "error", frameError)
+			frame.ErrorMessage = frameError.Error()
+			frames = append(frames, frame)
+			continue
+		}
+
+		frame.PageTitle = stats.title
+		frame.H1Count = stats.h1Count
+		frame.H2Count = stats.h2Count
+		frame.H3Count = stats.h3Count
+		frame.H4Count = stats.h4Count
+		frame.H5Count = stats.h5Count
+		frame.H6Count = stats.h6Count
+		frame.InternalLinkCount = stats.internalLinksCount
+		frame.ExternalLinkCount = stats.externalLinksCount
+		frame.HasLoginForm = stats.login.Detected
+		if stats.login.Detected {
+			frame.LoginType = stats.login.Type
+		}
+		logins[target.url] = stats.login
+		frames = append(frames, frame)
+
+		for _, link := range stats.links {
+			links = append(links, frameLink{url: link, frame: target.url})
+		}
+
+		if target.depth < opts.MaxDepth {
+			for _, src := range stats.iframes {
+				pending = append(pending, frameTarget{url: src, parent: target.url, depth: target.depth + 1})
+			}
+		}
+	}
+
+	return frames, links, logins
+}
@@ -0,0 +1,117 @@
+package analyser
+
+import (
+	"strings"
+	"unicode"
+)
+
+// less text than this is too little to tell the language, words only count for Latin script text
+const (
+	minLettersForLanguage = 40
+	minWordsForLanguage   = 20
+)
+
+// stop words of the Latin script languages told apart by detectLanguage, also left out of the keywords
+var stopWords = map[string]map[string]bool{
+	"en": wordSet("the and of to a in is it that for on with as was are be this by at or from an have not but they you we his her their which will can has were been would there what all if more about"),
+	"de": wordSet("der die und in den von zu das mit sich des auf für ist im dem nicht ein eine als auch es an werden aus er hat dass sie nach wird bei einer um am sind noch wie einem über einen so zum oder"),
+	"fr": wordSet("le la les de des et en un une du est que qui dans pour pas sur au par avec ce il elle sont ne se plus ont aux ou mais nous vous leur cette été son sa ses"),
+	"es": wordSet("el la los las de del y en un una que es por para con no se su al lo como más pero sus le ya o este esta entre cuando muy sin sobre también fue han"),
+	"it": wordSet("il lo la le gli di del della dei e è un una che per non in con si da al alla sono come più ma anche questo questa nel nella ha hanno essere"),
+	"pt": wordSet("o a os as de do da dos das e em um uma que é para com não se por no na mais mas como ao foi são seu sua ou ele ela também está pelo pela"),
+	"nl": wordSet("de het een en van in is dat op te zijn met voor niet aan er die ook als bij door maar om naar dan wordt nog uit hij zij was werd heeft"),
+}
+
+// non-Latin scripts mostly used by a single language
+var scriptLanguages = []struct {
+	table    *unicode.RangeTable
+	language string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Greek, "el"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Thai, "th"},
+}
+
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+// detectLanguage guesses the language of text from its script, or from the stop words it uses for
+// Latin script text. It returns an ISO 639-1 code and a confidence between 0 and 1, or "" when unsure.
+func detectLanguage(text string, words []string) (string, float64) {
+	var letters, latin int
+	scripts := make([]int, len(scriptLanguages))
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for i, script := range scriptLanguages {
+			if unicode.Is(script.table, r) {
+				scripts[i]++
+				break
+			}
+		}
+	}
+	if letters < minLettersForLanguage {
+		return "", 0
+	}
+
+	// Japanese mixes kana with Han characters, any amount of kana makes it Japanese
+	if kana := scripts[0] + scripts[1]; kana > 0 && kana+scripts[2] > letters/2 {
+		return "ja", float64(kana+scripts[2]) / float64(letters)
+	}
+	for i, script := range scriptLanguages {
+		if scripts[i] > letters/2 {
+			return script.language, float64(scripts[i]) / float64(letters)
+		}
+	}
+	if latin <= letters/2 || len(words) < minWordsForLanguage {
+		return "", 0
+	}
+
+	hits := map[string]int{}
+	var total int
+	for _, word := range words {
+		for language, set := range stopWords {
+			if set[word] {
+				hits[language]++
+				total++
+			}
+		}
+	}
+
+	var best string
+	for language, count := range hits {
+		if count > hits[best] || (count == hits[best] && language < best) {
+			best = language
+		}
+	}
+	// a real text has plenty of stop words, a word list or a menu doesn't
+	if best == "" || hits[best]*20 < len(words) {
+		return "", 0
+	}
+	return best, float64(hits[best]) / float64(total)
+}
+
+// primaryLanguage returns the primary subtag of a language tag, "en" for "en-GB"
+func primaryLanguage(tag string) string {
+	primary, _, _ := strings.Cut(strings.TrimSpace(tag), "-")
+	primary, _, _ = strings.Cut(primary, "_")
+	return strings.ToLower(primary)
+}
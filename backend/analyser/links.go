@@ -0,0 +1,150 @@
+package analyser
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"web-scraper/logging"
+	"web-scraper/metrics"
+	"web-scraper/models"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// checkLinks sends a HEAD request to every link with the crawl identity and transport,
+// links on the crawl profile site also carry its credentials and session cookies.
+// It returns the broken links, their count and the number of links checked before ctx ended.
+func checkLinks(ctx context.Context, links []string, session *crawlSession, transport http.RoundTripper, jar http.CookieJar, timeout time.Duration) ([]models.BrokenLink, int, int) {
+
+	if len(links) == 0 {
+		return []models.BrokenLink{}, 0, 0
+	}
+
+	select {
+	case <-ctx.Done():
+		logging.FromContext(ctx).Warn("Context cancelled before starting link checks", "error", context.Cause(ctx))
+		return []models.BrokenLink{}, 0, 0
+	default:
+	}
+
+	var checked atomic.Int64
+
+	linksToCheck := make(chan string, len(links))
+	brokenLinksChan := make(chan models.BrokenLink, len(links))
+
+	var wg sync.WaitGroup
+
+	var linksCheckerWorkers = 20
+
+	httpClient := &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
+	if session.profile != nil {
+		// the jar scopes cookies to their domain, so only same-site links get the session
+		httpClient.Jar = jar
+	}
+
+	for range linksCheckerWorkers {
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			for link := range linksToCheck {
+				func(currentLink string) {
+
+					select {
+					case <-ctx.Done():
+						logging.FromContext(ctx).Debug("Context cancelled while checking links, skipping remaining links")
+						return // Stop this worker goroutine
+					default:
+					}
+					linkCtx, span := tracer.Start(ctx, "link.check", trace.WithAttributes(attribute.String("url.full", currentLink)))
+					defer span.End()
+
+					req, err := http.NewRequestWithContext(linkCtx, http.MethodHead, currentLink, nil)
+					if err == nil {
+						session.authorize(req)
+					}
+
+					var resp *http.Response
+					if err == nil {
+						resp, err = httpClient.Do(req)
+					}
+
+					if err != nil && ctx.Err() != nil {
+						// cut off by the budget or a cancellation, the link wasn't checked
+						return
+					}
+					checked.Add(1)
+
+					if err != nil {
+						endSpanWithError(span, err)
+						metrics.HTTPResponses.WithLabelValues("link_check", responseCodeLabel(0)).Inc()
+						metrics.LinkChecks.WithLabelValues("error").Inc()
+						brokenLinksChan <- models.BrokenLink{
+							ErrorMessage: err.Error(),
+							StatusCode:   0,
+							URL:          currentLink,
+						}
+						return
+					}
+
+					defer resp.Body.Close()
+
+					span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+					metrics.HTTPResponses.WithLabelValues("link_check", strconv.Itoa(resp.StatusCode)).Inc()
+
+					if isBotBlock(resp.StatusCode, resp.Header) {
+						metrics.LinkChecks.WithLabelValues("blocked").Inc()
+						brokenLinksChan <- models.BrokenLink{
+							StatusCode:   resp.StatusCode,
+							ErrorMessage: ErrBlockedByBotProtection.Error(),
+							URL:          currentLink,
+						}
+						return
+					}
+
+					if resp.StatusCode >= 400 {
+						metrics.LinkChecks.WithLabelValues("broken").Inc()
+						brokenLinksChan <- models.BrokenLink{
+							StatusCode:   resp.StatusCode,
+							ErrorMessage: http.StatusText(resp.StatusCode),
+							URL:          currentLink,
+						}
+						return
+					}
+
+					metrics.LinkChecks.WithLabelValues("ok").Inc()
+
+				}(link)
+			}
+
+		}()
+	}
+
+	for _, link := range links {
+		linksToCheck <- link
+	}
+
+	close(linksToCheck)
+
+	wg.Wait()
+
+	close(brokenLinksChan)
+
+	var collectedBrokenLinks []models.BrokenLink = []models.BrokenLink{}
+	var inaccessibleLinksCount int
+	for bl := range brokenLinksChan {
+		collectedBrokenLinks = append(collectedBrokenLinks, bl)
+		inaccessibleLinksCount++
+	}
+
+	return collectedBrokenLinks, inaccessibleLinksCount, int(checked.Load())
+
+}
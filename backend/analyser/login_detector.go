@@ -0,0 +1,190 @@
+package analyser
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"web-scraper/models"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// a page is reported as having a login once its signals add up to this score
+const loginScoreThreshold = 50
+
+const (
+	loginTypePassword        = "password"
+	loginTypeIdentifierFirst = "identifier-first"
+	loginTypeSSO             = "sso"
+	loginTypeWebAuthn        = "webauthn"
+	loginTypeNone            = "none"
+)
+
+var (
+	// matched against a form's action, id, class, name and submit button text, as whole words so that
+	// "author" or "accountant" don't count
+	loginLikePattern = regexp.MustCompile(`(?:^|[^a-z0-9])(?:log[\s_-]?in|sign[\s_-]?in|auth|authenticate|authentication|session|sessions|sso|account|accounts|my[\s_-]?account)(?:[^a-z0-9]|$)`)
+	// splits camel case identifiers such as "loginForm" into words
+	camelCaseBoundary = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+	oauthTextPattern  = regexp.MustCompile(`(?:(?:sign|log)\s?in|continue|login)\s+(?:with|using)\s+(google|microsoft|apple|github|facebook|a passkey)`)
+	oauthHosts        = map[string]string{
+		"accounts.google.com":       "google",
+		"login.microsoftonline.com": "microsoft",
+		"login.live.com":            "microsoft",
+		"appleid.apple.com":         "apple",
+		"github.com/login/oauth":    "github",
+		"facebook.com/dialog/oauth": "facebook",
+	}
+	identifierInputs = `input[type=email], input[autocomplete~="username"], input[autocomplete~="email"], input[name*=user], input[name*=email], input[name*=login], input[id*=user], input[id*=email]`
+)
+
+// loginSignal is a single piece of evidence together with the kind of login it points to
+type loginSignal struct {
+	loginType string
+	evidence  models.LoginEvidence
+}
+
+// detectLogin scores doc for login and authentication signals. Password forms, email or username only
+// forms posting to login-like actions (multi-step flows), "Sign in with ..." OAuth links, WebAuthn hints and
+// autocomplete username/current-password tokens all add to the score.
+// Forms rendered purely by JavaScript at runtime still can't be seen without a headless browser.
+func detectLogin(doc *goquery.Selection) models.LoginDetection {
+	var signals []loginSignal
+	add := func(loginType, signal, detail string, score int) {
+		signals = append(signals, loginSignal{
+			loginType: loginType,
+			evidence:  models.LoginEvidence{Signal: signal, Detail: detail, Score: score},
+		})
+	}
+
+	doc.Find("form").Each(func(_ int, form *goquery.Selection) {
+		if form.Find("input[type=password], input[name=password]").Length() > 0 {
+			// registration forms only ask for a new password
+			if form.Find(`input[autocomplete~="new-password"]`).Length() > 0 && form.Find(`input[autocomplete~="current-password"]`).Length() == 0 {
+				return
+			}
+			add(loginTypePassword, "password-form", describeForm(form), 60)
+			return
+		}
+
+		hint := strings.ToLower(camelCaseBoundary.ReplaceAllString(strings.Join([]string{
+			form.AttrOr("action", ""),
+			form.AttrOr("id", ""),
+			form.AttrOr("class", ""),
+			form.AttrOr("name", ""),
+			form.Find("button, input[type=submit]").Text(),
+			form.Find("input[type=submit]").AttrOr("value", ""),
+		}, " "), "$1 $2"))
+
+		if form.Find(identifierInputs).Length() > 0 && loginLikePattern.MatchString(hint) {
+			add(loginTypeIdentifierFirst, "identifier-only-form", describeForm(form), 50)
+		}
+	})
+
+	if doc.Find(`input[autocomplete~="current-password"]`).Length() > 0 {
+		add(loginTypePassword, "autocomplete-current-password", `input with autocomplete="current-password"`, 40)
+	}
+	if doc.Find(`input[autocomplete~="username"]`).Length() > 0 {
+		add(loginTypeIdentifierFirst, "autocomplete-username", `input with autocomplete="username"`, 20)
+	}
+
+	providers := map[string]bool{}
+	doc.Find("a, button").Each(func(_ int, el *goquery.Selection) {
+		text := strings.ToLower(strings.Join(strings.Fields(el.Text()+" "+el.AttrOr("aria-label", "")+" "+el.AttrOr("title", "")), " "))
+		if match := oauthTextPattern.FindStringSubmatch(text); match != nil {
+			providers[match[1]] = true
+			return
+		}
+
+		href := strings.ToLower(el.AttrOr("href", ""))
+		for host, provider := range oauthHosts {
+			if strings.Contains(href, host) {
+				providers[provider] = true
+				return
+			}
+		}
+	})
+	for provider := range providers {
+		if provider == "a passkey" {
+			add(loginTypeWebAuthn, "passkey-button", "sign in with a passkey", 40)
+			continue
+		}
+		add(loginTypeSSO, "oauth-provider", "sign in with "+provider, 50)
+	}
+
+	if doc.Find(`input[autocomplete~="webauthn"]`).Length() > 0 {
+		add(loginTypeWebAuthn, "autocomplete-webauthn", `input with autocomplete="webauthn"`, 40)
+	}
+	scripts := doc.Find("script").Text()
+	if strings.Contains(scripts, "navigator.credentials.get") || strings.Contains(scripts, "PublicKeyCredential") {
+		add(loginTypeWebAuthn, "webauthn-script", "page script calls the WebAuthn API", 30)
+	}
+
+	return scoreLoginSignals(signals)
+}
+
+// scoreLoginSignals sums the signals, the login type is the one with the highest combined score
+func scoreLoginSignals(signals []loginSignal) models.LoginDetection {
+	detection := models.LoginDetection{Type: loginTypeNone, Evidence: []models.LoginEvidence{}}
+
+	scoreByType := map[string]int{}
+	for _, s := range signals {
+		detection.Score += s.evidence.Score
+		detection.Evidence = append(detection.Evidence, s.evidence)
+		scoreByType[s.loginType] += s.evidence.Score
+	}
+	if detection.Score > 100 {
+		detection.Score = 100
+	}
+
+	detection.Detected = detection.Score >= loginScoreThreshold
+	if !detection.Detected {
+		return detection
+	}
+
+	// stable order so ties always resolve to the same type
+	types := make([]string, 0, len(scoreByType))
+	for t := range scoreByType {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	best := 0
+	for _, t := range types {
+		if scoreByType[t] > best {
+			best = scoreByType[t]
+			detection.Type = t
+		}
+	}
+
+	return detection
+}
+
+// MergeFrameLogin folds the login detection of an iframe into the page detection, keeping the frame as evidence source
+func MergeFrameLogin(page models.LoginDetection, frameURL string, frame models.LoginDetection) models.LoginDetection {
+	if !frame.Detected {
+		return page
+	}
+
+	for _, e := range frame.Evidence {
+		e.Frame = frameURL
+		page.Evidence = append(page.Evidence, e)
+	}
+	if frame.Score > page.Score || !page.Detected {
+		page.Score = frame.Score
+		page.Type = frame.Type
+	}
+	page.Detected = true
+
+	return page
+}
+
+func describeForm(form *goquery.Selection) string {
+	if action, ok := form.Attr("action"); ok && action != "" {
+		return fmt.Sprintf("form posting to %s", action)
+	}
+	if id, ok := form.Attr("id"); ok && id != "" {
+		return fmt.Sprintf("form #%s", id)
+	}
+	return "form without action"
+}
@@ -0,0 +1,198 @@
+package analyser
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestDetectLogin(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		// loginTypeNone for pages without a login
+		want    string
+		score   int
+		signals []string
+	}{
+		{
+			name:    "password form",
+			html:    `<form action="/session" method="post"><input name="email"><input type="password" name="password"><button>Go</button></form>`,
+			want:    loginTypePassword,
+			score:   60,
+			signals: []string{"password-form"},
+		},
+		{
+			name:    "password input without a type",
+			html:    `<form><input name="user"><input name="password"></form>`,
+			want:    loginTypePassword,
+			score:   60,
+			signals: []string{"password-form"},
+		},
+		{
+			name: "password form with autocomplete tokens",
+			html: `<form id="login"><input type="email" autocomplete="username"><input type="password" autocomplete="current-password"></form>`,
+			want: loginTypePassword,
+			// 60 + 40 + 20, capped
+			score:   100,
+			signals: []string{"autocomplete-current-password", "autocomplete-username", "password-form"},
+		},
+		{
+			name:    "password change form with the current password",
+			html:    `<form action="/account/password"><input type="password" autocomplete="current-password"><input type="password" autocomplete="new-password"></form>`,
+			want:    loginTypePassword,
+			score:   100,
+			signals: []string{"autocomplete-current-password", "password-form"},
+		},
+		{
+			name:    "identifier-first form",
+			html:    `<form action="/login/identifier"><input type="email" name="email"><button>Next</button></form>`,
+			want:    loginTypeIdentifierFirst,
+			score:   50,
+			signals: []string{"identifier-only-form"},
+		},
+		{
+			name:    "identifier-first form with a camel case id",
+			html:    `<form id="signInForm"><input name="username"><button>Continue</button></form>`,
+			want:    loginTypeIdentifierFirst,
+			score:   50,
+			signals: []string{"identifier-only-form"},
+		},
+		{
+			name:    "identifier-first form named by its button",
+			html:    `<form action="/next"><input type="email" autocomplete="username"><input type="submit" value="Log in"></form>`,
+			want:    loginTypeIdentifierFirst,
+			score:   70,
+			signals: []string{"autocomplete-username", "identifier-only-form"},
+		},
+		{
+			name:    "sign in with Google link",
+			html:    `<a href="https://accounts.google.com/o/oauth2/v2/auth?client_id=x">Google</a>`,
+			want:    loginTypeSSO,
+			score:   50,
+			signals: []string{"oauth-provider"},
+		},
+		{
+			name:    "sign in with Microsoft button",
+			html:    `<button type="button">Sign in with   Microsoft</button>`,
+			want:    loginTypeSSO,
+			score:   50,
+			signals: []string{"oauth-provider"},
+		},
+		{
+			name:    "continue with GitHub by aria-label",
+			html:    `<a href="/auth/github" aria-label="Continue with GitHub"><svg></svg></a>`,
+			want:    loginTypeSSO,
+			score:   50,
+			signals: []string{"oauth-provider"},
+		},
+		{
+			name:    "several providers",
+			html:    `<button>Continue with Google</button><button>Continue with Apple</button>`,
+			want:    loginTypeSSO,
+			score:   100,
+			signals: []string{"oauth-provider", "oauth-provider"},
+		},
+		{
+			name:    "password form beats a single provider",
+			html:    `<form><input type="password"></form><a href="https://appleid.apple.com/auth/authorize">Apple</a>`,
+			want:    loginTypePassword,
+			score:   100,
+			signals: []string{"oauth-provider", "password-form"},
+		},
+		{
+			name:    "passkey button with conditional UI",
+			html:    `<input name="id" autocomplete="username webauthn"><button>Sign in with a passkey</button>`,
+			want:    loginTypeWebAuthn,
+			score:   100,
+			signals: []string{"autocomplete-username", "autocomplete-webauthn", "passkey-button"},
+		},
+		{
+			name:    "passkey button calling the WebAuthn API",
+			html:    `<button>Log in with a passkey</button><script>navigator.credentials.get({publicKey: options})</script>`,
+			want:    loginTypeWebAuthn,
+			score:   70,
+			signals: []string{"passkey-button", "webauthn-script"},
+		},
+
+		// sign-up forms and false positives
+		{
+			name:    "sign-up form",
+			html:    `<form action="/register"><input type="email" autocomplete="email"><input type="password" autocomplete="new-password"><button>Sign up</button></form>`,
+			want:    loginTypeNone,
+			signals: []string{},
+		},
+		{
+			name:    "sign-up form with a confirmation",
+			html:    `<form id="signup"><input type="password" name="password" autocomplete="new-password"><input type="password" name="password_confirmation" autocomplete="new-password"></form>`,
+			want:    loginTypeNone,
+			signals: []string{},
+		},
+		{
+			name:    "newsletter form",
+			html:    `<form action="/subscribe"><input type="email" name="email"><button>Subscribe</button></form>`,
+			want:    loginTypeNone,
+			signals: []string{},
+		},
+		{
+			name:    "search form",
+			html:    `<form action="/search"><input type="search" name="q"><button>Search</button></form>`,
+			want:    loginTypeNone,
+			signals: []string{},
+		},
+		{
+			name:    "words containing login terms",
+			html:    `<form class="author-filter" action="/accountants"><input name="username_filter"><button>Filter authors</button></form>`,
+			want:    loginTypeNone,
+			signals: []string{},
+		},
+		{
+			name:    "link to a sign in page",
+			html:    `<nav><a href="/login">Sign in</a> <a href="https://github.com/example/repo">Code on GitHub</a></nav>`,
+			want:    loginTypeNone,
+			signals: []string{},
+		},
+		{
+			name:    "username autocomplete alone",
+			html:    `<form action="/profile"><input autocomplete="username"><button>Save</button></form>`,
+			want:    loginTypeNone,
+			score:   20,
+			signals: []string{"autocomplete-username"},
+		},
+		{
+			name:    "WebAuthn feature check alone",
+			html:    `<script>if (window.PublicKeyCredential) { document.body.classList.add("passkeys") }</script>`,
+			want:    loginTypeNone,
+			score:   30,
+			signals: []string{"webauthn-script"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><body>" + tt.html + "</body></html>"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := detectLogin(doc.Selection)
+
+			if got.Detected != (tt.want != loginTypeNone) || got.Type != tt.want {
+				t.Errorf("detected %v as %q, want %q", got.Detected, got.Type, tt.want)
+			}
+			if got.Score != tt.score {
+				t.Errorf("score %d, want %d", got.Score, tt.score)
+			}
+			signals := []string{}
+			for _, evidence := range got.Evidence {
+				signals = append(signals, evidence.Signal)
+			}
+			slices.Sort(signals)
+			if !slices.Equal(signals, tt.signals) {
+				t.Errorf("signals %v, want %v", signals, tt.signals)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package analyser
+
+import (
+	"log/slog"
+	netURL "net/url"
+	"strconv"
+	"strings"
+	"web-scraper/models"
+
+	"github.com/gocolly/colly/v2"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// pageStats holds the analysis of a single document, the crawled page or one of its iframes
+type pageStats struct {
+	title                                                string
+	h1Count, h2Count, h3Count, h4Count, h5Count, h6Count int
+	externalLinksCount, internalLinksCount               int
+	links                                                []string
+	login                                                models.LoginDetection
+	htmlVersion                                          string
+	iframes                                              []string
+	mixedContent                                         []models.MixedContent
+}
+
+// registerPageHandlers attaches the document analysis callbacks to c, results are written to stats
+func registerPageHandlers(c *colly.Collector, stats *pageStats, logger *slog.Logger) {
+	c.OnResponse(func(r *colly.Response) {
+		bodyString := strings.ToLower(string(r.Body))
+		bodyString = strings.TrimSpace(bodyString)
+
+		if strings.HasPrefix(bodyString, "<!doctype html>") {
+			stats.htmlVersion = "HTML5"
+		} else {
+			stats.htmlVersion = "HTML4.01"
+		}
+		// could ass XHTML etc
+	})
+
+	c.OnHTML("title", func(e *colly.HTMLElement) {
+		stats.title = e.Text
+	})
+
+	c.OnHTML("h1", func(e *colly.HTMLElement) {
+		stats.h1Count++
+	})
+	c.OnHTML("h2", func(e *colly.HTMLElement) {
+		stats.h2Count++
+	})
+
+	c.OnHTML("h3", func(e *colly.HTMLElement) {
+		stats.h3Count++
+	})
+
+	c.OnHTML("h4", func(e *colly.HTMLElement) {
+		stats.h4Count++
+	})
+
+	c.OnHTML("h5", func(e *colly.HTMLElement) {
+		stats.h5Count++
+	})
+
+	c.OnHTML("h6", func(e *colly.HTMLElement) {
+		stats.h6Count++
+	})
+
+	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		link := e.Attr("href")
+		absoluteUrl := e.Request.AbsoluteURL(link)
+
+		if absoluteUrl == "" || strings.Contains(absoluteUrl, "#") || strings.HasPrefix(absoluteUrl, "javascript:") {
+			return
+		}
+
+		parsedAbsoluteURL, err := netURL.Parse(absoluteUrl)
+		if err != nil {
+			logger.Debug("Skipping unparsable link", "link", absoluteUrl, "error", err)
+			return
+		}
+
+		if parsedAbsoluteURL.Host == e.Request.URL.Host {
+			stats.internalLinksCount++
+		} else {
+			stats.externalLinksCount++
+		}
+		// could be a channel too to enable stream processing of links like as soon as you found one link starts processing
+		stats.links = append(stats.links, absoluteUrl)
+	})
+
+	c.OnHTML("html", func(e *colly.HTMLElement) {
+		stats.login = detectLogin(e.DOM)
+	})
+
+	c.OnHTML("iframe[src]", func(e *colly.HTMLElement) {
+		if src := e.Request.AbsoluteURL(e.Attr("src")); src != "" {
+			stats.iframes = append(stats.iframes, src)
+		}
+	})
+
+	registerMixedContentHandlers(c, stats)
+}
+
+// endSpanWithError marks span as failed when err is set
+func endSpanWithError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// responseCodeLabel is the status code label of outbound response metrics, 0 meaning no response was received
+func responseCodeLabel(statusCode int) string {
+	if statusCode == 0 {
+		return "error"
+	}
+	return strconv.Itoa(statusCode)
+}
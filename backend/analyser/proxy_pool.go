@@ -0,0 +1,147 @@
+package analyser
+
+import (
+	"log/slog"
+	netURL "net/url"
+	"strings"
+	"sync"
+	"time"
+	"web-scraper/config"
+	"web-scraper/netguard"
+)
+
+const (
+	// a proxy is taken out of rotation after this many failures in a row
+	proxyFailureThreshold = 3
+	proxyCooldown         = 2 * time.Minute
+)
+
+type poolProxy struct {
+	url                 *netURL.URL
+	consecutiveFailures int
+	successes           int
+	failures            int
+	unhealthyUntil      time.Time
+}
+
+// ProxyStatus is the health of one proxy of the pool as reported by the API
+type ProxyStatus struct {
+	URL                 string    `json:"url"`
+	Healthy             bool      `json:"healthy"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	Successes           int       `json:"successes"`
+	Failures            int       `json:"failures"`
+	UnhealthyUntil      time.Time `json:"unhealthyUntil"`
+}
+
+// proxyPool hands out outbound proxies round robin, skipping the ones that keep failing
+type proxyPool struct {
+	mu      sync.Mutex
+	proxies []*poolProxy
+	next    int
+}
+
+var (
+	crawlProxyPool     *proxyPool
+	crawlProxyPoolOnce sync.Once
+)
+
+// defaultProxyPool returns the pool configured by CRAWL_PROXY_POOL, a comma separated list of proxy URLs.
+// A proxy resolves the crawled hosts itself, past the address checks of the SSRF policy, so with the protection on
+// the pool stays empty until CRAWL_PROXY_TRUSTED confirms the proxies refuse internal destinations on their own.
+func defaultProxyPool() *proxyPool {
+	crawlProxyPoolOnce.Do(func() {
+		crawlProxyPool = &proxyPool{}
+		if netguard.Default().Enabled() && !config.GetEnvBool("CRAWL_PROXY_TRUSTED", false) {
+			if strings.TrimSpace(config.GetEnv("CRAWL_PROXY_POOL")) != "" {
+				slog.Warn("Ignoring CRAWL_PROXY_POOL, set CRAWL_PROXY_TRUSTED=true once the proxies refuse internal destinations themselves")
+			}
+			return
+		}
+		for _, raw := range strings.Split(config.GetEnv("CRAWL_PROXY_POOL"), ",") {
+			raw = strings.TrimSpace(raw)
+			if raw == "" {
+				continue
+			}
+			proxyURL, err := netURL.Parse(raw)
+			if err != nil || proxyURL.Host == "" {
+				slog.Warn("Ignoring invalid proxy in CRAWL_PROXY_POOL", "proxy", raw)
+				continue
+			}
+			crawlProxyPool.proxies = append(crawlProxyPool.proxies, &poolProxy{url: proxyURL})
+		}
+	})
+	return crawlProxyPool
+}
+
+// pick returns the next healthy proxy. When every proxy is cooling down the one that recovers first is used,
+// nil is only returned for an empty pool.
+func (p *proxyPool) pick() *poolProxy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.proxies) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var soonest *poolProxy
+	for range p.proxies {
+		candidate := p.proxies[p.next%len(p.proxies)]
+		p.next++
+
+		if !now.Before(candidate.unhealthyUntil) {
+			return candidate
+		}
+		if soonest == nil || candidate.unhealthyUntil.Before(soonest.unhealthyUntil) {
+			soonest = candidate
+		}
+	}
+	return soonest
+}
+
+// report records the outcome of a crawl that went through proxy
+func (p *proxyPool) report(proxy *poolProxy, failed bool) {
+	if proxy == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !failed {
+		proxy.successes++
+		proxy.consecutiveFailures = 0
+		proxy.unhealthyUntil = time.Time{}
+		return
+	}
+
+	proxy.failures++
+	proxy.consecutiveFailures++
+	if proxy.consecutiveFailures >= proxyFailureThreshold {
+		proxy.unhealthyUntil = time.Now().Add(proxyCooldown)
+		slog.Warn("Proxy marked unhealthy", "proxy", proxy.url.Redacted(), "consecutive_failures", proxy.consecutiveFailures, "cooldown", proxyCooldown)
+	}
+}
+
+// ProxyPoolStatus returns the health of every configured proxy, credentials redacted
+func ProxyPoolStatus() []ProxyStatus {
+	p := defaultProxyPool()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]ProxyStatus, 0, len(p.proxies))
+	for _, proxy := range p.proxies {
+		statuses = append(statuses, ProxyStatus{
+			URL:                 proxy.url.Redacted(),
+			Healthy:             !now.Before(proxy.unhealthyUntil),
+			ConsecutiveFailures: proxy.consecutiveFailures,
+			Successes:           proxy.successes,
+			Failures:            proxy.failures,
+			UnhealthyUntil:      proxy.unhealthyUntil,
+		})
+	}
+	return statuses
+}
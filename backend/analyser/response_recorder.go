@@ -0,0 +1,214 @@
+package analyser
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+	"web-scraper/models"
+)
+
+// response headers kept on the analysis
+var headersOfInterest = []string{
+	"Content-Type",
+	"Content-Length",
+	"Content-Encoding",
+	"Server",
+	"X-Powered-By",
+	"Cache-Control",
+	"Expires",
+	"ETag",
+	"Last-Modified",
+	"Age",
+	"Retry-After",
+	"Strict-Transport-Security",
+	"Content-Security-Policy",
+	"X-Frame-Options",
+	"X-Content-Type-Options",
+	"Referrer-Policy",
+	"Permissions-Policy",
+	"Cross-Origin-Opener-Policy",
+	"Cross-Origin-Resource-Policy",
+}
+
+type recorderKey struct{}
+
+// responseRecorder collects the redirect chain, final response and timings of the requests made with its context
+type responseRecorder struct {
+	mu sync.Mutex
+
+	start     time.Time
+	end       time.Time
+	redirects []models.Redirect
+	final     *http.Response
+	finalURL  string
+	bodySize  int64
+	// cookies set along the whole redirect chain
+	cookies []*http.Cookie
+
+	// phases of the last request, a redirect starts them over
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	requestStart, firstByte   time.Time
+}
+
+// withResponseRecorder returns a context whose requests are recorded when sent through recordingTransport
+func withResponseRecorder(ctx context.Context) (context.Context, *responseRecorder) {
+	rec := &responseRecorder{}
+	return context.WithValue(ctx, recorderKey{}, rec), rec
+}
+
+func (r *responseRecorder) set(field *time.Time) func() {
+	return func() {
+		r.mu.Lock()
+		*field = time.Now()
+		r.mu.Unlock()
+	}
+}
+
+func (r *responseRecorder) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { r.set(&r.dnsStart)() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { r.set(&r.dnsDone)() },
+		ConnectStart:         func(string, string) { r.setOnce(&r.connectStart) },
+		ConnectDone:          func(string, string, error) { r.set(&r.connectDone)() },
+		TLSHandshakeStart:    r.set(&r.tlsStart),
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { r.set(&r.tlsDone)() },
+		GotFirstResponseByte: r.set(&r.firstByte),
+	}
+}
+
+// setOnce keeps the first time, with several addresses the dialer may try more than one
+func (r *responseRecorder) setOnce(field *time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if field.IsZero() {
+		*field = time.Now()
+	}
+}
+
+func (r *responseRecorder) startRequest() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if r.start.IsZero() {
+		r.start = now
+	}
+	r.requestStart = now
+	r.dnsStart, r.dnsDone = time.Time{}, time.Time{}
+	r.connectStart, r.connectDone = time.Time{}, time.Time{}
+	r.tlsStart, r.tlsDone = time.Time{}, time.Time{}
+	r.firstByte = time.Time{}
+}
+
+func (r *responseRecorder) finishRequest(req *http.Request, resp *http.Response) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.finalURL = req.URL.String()
+	r.end = time.Now()
+	if resp == nil {
+		return
+	}
+	r.final = resp
+	r.bodySize = 0
+	r.cookies = append(r.cookies, resp.Cookies()...)
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 && resp.Header.Get("Location") != "" {
+		r.redirects = append(r.redirects, models.Redirect{
+			URL:        req.URL.String(),
+			StatusCode: resp.StatusCode,
+			Location:   resp.Header.Get("Location"),
+		})
+	}
+}
+
+func (r *responseRecorder) bodyRead(resp *http.Response, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if resp != r.final {
+		return // a redirect body drained by the client
+	}
+	r.bodySize += int64(n)
+	r.end = time.Now()
+}
+
+// metadata returns what was recorded, a zero value when no request was made
+func (r *responseRecorder) metadata() models.ResponseMetadata {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	meta := models.ResponseMetadata{
+		FinalURL:      r.finalURL,
+		Redirects:     r.redirects,
+		BodySize:      r.bodySize,
+		ContentLength: -1,
+		Timing: models.ResponseTiming{
+			DNSMs:     elapsedMs(r.dnsStart, r.dnsDone),
+			ConnectMs: elapsedMs(r.connectStart, r.connectDone),
+			TLSMs:     elapsedMs(r.tlsStart, r.tlsDone),
+			TTFBMs:    elapsedMs(r.requestStart, r.firstByte),
+			TotalMs:   elapsedMs(r.start, r.end),
+		},
+	}
+	if meta.Redirects == nil {
+		meta.Redirects = []models.Redirect{}
+	}
+	if r.final != nil {
+		meta.StatusCode = r.final.StatusCode
+		meta.ContentLength = r.final.ContentLength
+		meta.Headers = models.StringMap{}
+		for _, name := range headersOfInterest {
+			if value := r.final.Header.Get(name); value != "" {
+				meta.Headers[name] = value
+			}
+		}
+	}
+	return meta
+}
+
+func elapsedMs(from, to time.Time) float64 {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return 0
+	}
+	return float64(to.Sub(from).Microseconds()) / 1000
+}
+
+// recordingTransport feeds requests carrying a responseRecorder in their context into it,
+// each hop of a redirect chain is a separate round trip
+type recordingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec, ok := req.Context().Value(recorderKey{}).(*responseRecorder)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	rec.startRequest()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), rec.clientTrace()))
+
+	resp, err := t.next.RoundTrip(req)
+	rec.finishRequest(req, resp)
+	if resp != nil && resp.Body != nil {
+		resp.Body = &countingBody{ReadCloser: resp.Body, rec: rec, resp: resp}
+	}
+	return resp, err
+}
+
+type countingBody struct {
+	io.ReadCloser
+	rec  *responseRecorder
+	resp *http.Response
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.rec.bodyRead(b.resp, n)
+	return n, err
+}
@@ -0,0 +1,250 @@
+package analyser
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	netURL "net/url"
+	"strconv"
+	"strings"
+	"time"
+	"web-scraper/models"
+
+	"github.com/gocolly/colly/v2"
+)
+
+const (
+	severityHigh   = "high"
+	severityMedium = "medium"
+	severityLow    = "low"
+	severityInfo   = "info"
+)
+
+// the HSTS max-age below which browsers are told to forget https too soon, 180 days
+const minHSTSMaxAge = 180 * 24 * 60 * 60
+
+// headers reported on, in this order
+var securityHeaders = []string{
+	"Strict-Transport-Security",
+	"Content-Security-Policy",
+	"X-Frame-Options",
+	"X-Content-Type-Options",
+	"Referrer-Policy",
+	"Permissions-Policy",
+}
+
+// elements loading subresources, active ones can change the page and are blocked by browsers when mixed
+var mixedContentElements = []struct {
+	selector string
+	attr     string
+	active   bool
+}{
+	{"script[src]", "src", true},
+	{"link[rel=stylesheet][href]", "href", true},
+	{"iframe[src]", "src", true},
+	{"frame[src]", "src", true},
+	{"object[data]", "data", true},
+	{"embed[src]", "src", true},
+	{"img[src]", "src", false},
+	{"audio[src]", "src", false},
+	{"video[src]", "src", false},
+	{"source[src]", "src", false},
+}
+
+// registerMixedContentHandlers collects the http resources of documents served over https into stats
+func registerMixedContentHandlers(c *colly.Collector, stats *pageStats) {
+	for _, element := range mixedContentElements {
+		c.OnHTML(element.selector, func(e *colly.HTMLElement) {
+			if e.Request.URL.Scheme != "https" {
+				return
+			}
+			resource := e.Request.AbsoluteURL(e.Attr(element.attr))
+			if !strings.HasPrefix(resource, "http://") {
+				return
+			}
+			stats.mixedContent = append(stats.mixedContent, models.MixedContent{
+				URL:     resource,
+				Element: e.Name,
+				Active:  element.active,
+			})
+		})
+	}
+}
+
+// buildSecurityReport checks the final response recorded by rec, the cookies of its redirect chain
+// and the mixed content found on the page. knownTLS stands in for the TLS connection of responses
+// replayed from a snapshot, which have none.
+func buildSecurityReport(rec *responseRecorder, mixedContent []models.MixedContent, knownTLS *models.TLSDetails, expiryWarningDays int, now time.Time) models.SecurityReport {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	report := models.SecurityReport{
+		Headers:      []models.SecurityHeader{},
+		Cookies:      []models.CookieFlags{},
+		MixedContent: mixedContent,
+		Findings:     []models.SecurityFinding{},
+	}
+	if report.MixedContent == nil {
+		report.MixedContent = []models.MixedContent{}
+	}
+	if rec.final == nil {
+		return report
+	}
+
+	var host string
+	finalURL, _ := netURL.Parse(rec.finalURL)
+	if finalURL != nil {
+		host = finalURL.Hostname()
+	}
+	https := finalURL != nil && finalURL.Scheme == "https"
+	addFinding := func(check, severity, format string, args ...any) {
+		report.Findings = append(report.Findings, models.SecurityFinding{Check: check, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !https {
+		addFinding("https", severityHigh, "the page is served over plain http")
+	}
+
+	header := rec.final.Header
+	for _, name := range securityHeaders {
+		value := header.Get(name)
+		report.Headers = append(report.Headers, models.SecurityHeader{Name: name, Present: value != "", Value: value})
+	}
+	checkSecurityHeaders(header, https, addFinding)
+
+	for _, cookie := range rec.cookies {
+		flags := models.CookieFlags{
+			Name:     cookie.Name,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+			SameSite: sameSiteName(cookie.SameSite),
+		}
+		report.Cookies = append(report.Cookies, flags)
+
+		if https && !flags.Secure {
+			addFinding("cookie-secure", severityMedium, "cookie %q is set without the Secure flag", flags.Name)
+		}
+		if !flags.HttpOnly {
+			addFinding("cookie-httponly", severityLow, "cookie %q is readable from scripts, HttpOnly is not set", flags.Name)
+		}
+		if flags.SameSite == "" {
+			addFinding("cookie-samesite", severityLow, "cookie %q has no SameSite attribute", flags.Name)
+		} else if flags.SameSite == "None" && !flags.Secure {
+			addFinding("cookie-samesite", severityMedium, "cookie %q has SameSite=None without Secure and is rejected by browsers", flags.Name)
+		}
+	}
+
+	if state := rec.final.TLS; state != nil && len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		report.TLS = &models.TLSDetails{
+			Version:       tls.VersionName(state.Version),
+			CipherSuite:   tls.CipherSuiteName(state.CipherSuite),
+			Subject:       cert.Subject.String(),
+			Issuer:        cert.Issuer.String(),
+			NotAfter:      cert.NotAfter,
+			DNSNames:      cert.DNSNames,
+			HostnameMatch: cert.VerifyHostname(host) == nil,
+		}
+		if report.TLS.DNSNames == nil {
+			report.TLS.DNSNames = []string{}
+		}
+	} else if https && knownTLS != nil {
+		details := *knownTLS
+		report.TLS = &details
+	}
+	if report.TLS != nil {
+		checkTLS(report.TLS, host, expiryWarningDays, now, addFinding)
+	}
+
+	var active, passive int
+	for _, resource := range report.MixedContent {
+		if resource.Active {
+			active++
+		} else {
+			passive++
+		}
+	}
+	if active > 0 {
+		addFinding("mixed-content", severityHigh, "%d scripts, stylesheets or frames are loaded over http and blocked by browsers", active)
+	}
+	if passive > 0 {
+		addFinding("mixed-content", severityMedium, "%d images or media are loaded over http", passive)
+	}
+
+	return report
+}
+
+// legacy protocol versions, as named by tls.VersionName
+var legacyTLSVersions = map[string]bool{"SSL 3.0": true, "TLS 1.0": true, "TLS 1.1": true}
+
+// checkTLS updates the days until expiry of details and adds the findings of the connection and certificate
+func checkTLS(details *models.TLSDetails, host string, expiryWarningDays int, now time.Time, addFinding func(check, severity, format string, args ...any)) {
+	details.DaysUntilExpiry = int(details.NotAfter.Sub(now).Hours() / 24)
+
+	if legacyTLSVersions[details.Version] {
+		addFinding("tls-version", severityHigh, "the connection uses %s, TLS 1.2 or later is expected", details.Version)
+	}
+	if !details.HostnameMatch {
+		addFinding("certificate-hostname", severityHigh, "the certificate is not valid for %s", host)
+	}
+	switch {
+	case now.After(details.NotAfter):
+		addFinding("certificate-expiry", severityHigh, "the certificate expired on %s", details.NotAfter.Format(time.DateOnly))
+	case details.DaysUntilExpiry < expiryWarningDays:
+		addFinding("certificate-expiry", severityMedium, "the certificate expires in %d days, on %s", details.DaysUntilExpiry, details.NotAfter.Format(time.DateOnly))
+	}
+}
+
+// checkSecurityHeaders adds a finding for every missing or weak security header
+func checkSecurityHeaders(header http.Header, https bool, addFinding func(check, severity, format string, args ...any)) {
+	// HSTS is ignored by browsers on plain http, the https finding covers it
+	if https {
+		if hsts := header.Get("Strict-Transport-Security"); hsts == "" {
+			addFinding("hsts", severityMedium, "Strict-Transport-Security is missing")
+		} else if maxAge, ok := hstsMaxAge(hsts); !ok || maxAge < minHSTSMaxAge {
+			addFinding("hsts", severityLow, "Strict-Transport-Security max-age is below 180 days")
+		}
+	}
+
+	csp := header.Get("Content-Security-Policy")
+	if csp == "" {
+		addFinding("csp", severityMedium, "Content-Security-Policy is missing")
+	}
+	if header.Get("X-Frame-Options") == "" && !strings.Contains(strings.ToLower(csp), "frame-ancestors") {
+		addFinding("clickjacking", severityMedium, "neither X-Frame-Options nor a CSP frame-ancestors directive restricts framing")
+	}
+	if !strings.EqualFold(strings.TrimSpace(header.Get("X-Content-Type-Options")), "nosniff") {
+		addFinding("x-content-type-options", severityLow, "X-Content-Type-Options is not set to nosniff")
+	}
+	if header.Get("Referrer-Policy") == "" {
+		addFinding("referrer-policy", severityLow, "Referrer-Policy is missing")
+	}
+	if header.Get("Permissions-Policy") == "" {
+		addFinding("permissions-policy", severityInfo, "Permissions-Policy is missing")
+	}
+}
+
+// hstsMaxAge returns the max-age directive of a Strict-Transport-Security value
+func hstsMaxAge(value string) (int, bool) {
+	for _, directive := range strings.Split(value, ";") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "max-age") {
+			maxAge, err := strconv.Atoi(strings.Trim(strings.TrimSpace(arg), `"`))
+			return maxAge, err == nil
+		}
+	}
+	return 0, false
+}
+
+func sameSiteName(mode http.SameSite) string {
+	switch mode {
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteNoneMode:
+		return "None"
+	default:
+		return ""
+	}
+}
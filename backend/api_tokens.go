@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"web-scraper/logging"
+	"web-scraper/models"
+	"web-scraper/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type APITokenInput struct {
+	Name string `json:"name" binding:"required,max=100"`
+	// the token never expires when unset
+	ExpiresInDays *int `json:"expiresInDays" binding:"omitempty,min=1,max=3650"`
+}
+
+// CreateAPIToken issues an API token for the caller, the response carries the token, it isn't shown again
+func CreateAPIToken(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	var input APITokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, hash := services.NewAPIToken()
+	apiToken := models.APIToken{
+		UserID:    c.GetString("UserID"),
+		Name:      strings.TrimSpace(input.Name),
+		Prefix:    token[:12],
+		TokenHash: hash,
+	}
+	if input.ExpiresInDays != nil {
+		expiresAt := time.Now().AddDate(0, 0, *input.ExpiresInDays)
+		apiToken.ExpiresAt = &expiresAt
+	}
+
+	if err := db.Create(&apiToken).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API token: " + err.Error()})
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("API token created", "token_id", apiToken.ID)
+	c.JSON(http.StatusCreated, gin.H{
+		"id":        apiToken.ID,
+		"name":      apiToken.Name,
+		"prefix":    apiToken.Prefix,
+		"expiresAt": apiToken.ExpiresAt,
+		"createdAt": apiToken.CreatedAt,
+		"token":     token,
+	})
+}
+
+func GetAPITokens(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	tokens := []models.APIToken{}
+	if err := db.Where("user_id = ?", c.GetString("UserID")).Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch API tokens " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// DeleteAPIToken revokes an API token of the caller
+func DeleteAPIToken(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API token ID format"})
+		return
+	}
+
+	var apiToken models.APIToken
+	if err := db.Where("user_id = ?", c.GetString("UserID")).First(&apiToken, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API token not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API token: " + err.Error()})
+		}
+		return
+	}
+
+	if err := db.Delete(&apiToken).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete API token: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "API token revoked", "id": apiToken.ID})
+}
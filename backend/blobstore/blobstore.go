@@ -0,0 +1,45 @@
+// Package blobstore stores opaque blobs such as page snapshots, on the local filesystem or in an
+// S3 compatible object store
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"web-scraper/config"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps blobs under slash separated keys, e.g. "snapshots/12/20250101T101010Z.warc.gz"
+type Store interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	// Get returns ErrNotFound for unknown keys, the caller closes the returned reader
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete succeeds for unknown keys
+	Delete(ctx context.Context, key string) error
+}
+
+// New returns the store selected by BLOB_STORE, "local" (default) or "s3"
+func New() (Store, error) {
+	switch name := config.GetEnv("BLOB_STORE"); name {
+	case "", "local":
+		dir := config.GetEnv("BLOB_LOCAL_DIR")
+		if dir == "" {
+			dir = "data/blobs"
+		}
+		return NewLocal(dir)
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:        config.GetEnv("S3_ENDPOINT"),
+			Region:          config.GetEnv("S3_REGION"),
+			Bucket:          config.GetEnv("S3_BUCKET"),
+			AccessKeyID:     config.GetEnv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: config.GetEnv("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       config.GetEnvBool("S3_PATH_STYLE", true),
+		})
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q, expected local or s3", name)
+	}
+}
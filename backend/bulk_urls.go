@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"web-scraper/models"
+	"web-scraper/netguard"
+	"web-scraper/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AddURLsInput struct {
+	URLs []string `json:"urls" binding:"required,min=1,max=1000"`
+	// optional crawl profile applied to every URL, must belong to the caller
+	ProfileID *uint `json:"profileId"`
+}
+
+// AddURLs queues many URLs at once in the bulk lane, so imports don't hold up interactive checks.
+// Every URL is validated on its own, the response reports the outcome per URL.
+func AddURLs(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	var input AddURLsInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("UserID")
+
+	if input.ProfileID != nil {
+		owned, err := checkProfileOwner(db, userID, *input.ProfileID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check crawl profile: " + err.Error()})
+			return
+		}
+		if !owned {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Crawl profile not found"})
+			return
+		}
+	}
+
+	results := make([]gin.H, 0, len(input.URLs))
+	seen := map[string]bool{}
+	queued := 0
+
+	for _, rawURL := range input.URLs {
+		rawURL = strings.TrimSpace(rawURL)
+		if rawURL == "" || seen[rawURL] {
+			continue
+		}
+		seen[rawURL] = true
+
+		if err := netguard.Default().ValidateURL(c.Request.Context(), rawURL); err != nil {
+			results = append(results, gin.H{"url": rawURL, "error": "URL is not allowed: " + err.Error()})
+			continue
+		}
+
+		urlAnalysis := models.URLAnalysis{URL: rawURL, Status: "queued", UserID: userID, CrawlProfileID: input.ProfileID, Lane: string(services.LaneBulk)}
+		if err := saveQueuedAnalysis(db, &urlAnalysis); errors.Is(err, errAnalysisRunning) {
+			results = append(results, gin.H{"url": rawURL, "error": "URL is being analysed"})
+			continue
+		} else if err != nil {
+			results = append(results, gin.H{"url": rawURL, "error": "Failed to add URL: " + err.Error()})
+			continue
+		}
+
+		if err := services.EnqueueURL(c.Request.Context(), urlAnalysis.ID, userID, services.LaneBulk); err != nil {
+			// stays queued and is picked up after the restart
+			results = append(results, gin.H{"url": rawURL, "id": urlAnalysis.ID, "status": "queued", "error": err.Error()})
+			continue
+		}
+
+		queued++
+		results = append(results, gin.H{"url": rawURL, "id": urlAnalysis.ID, "status": urlAnalysis.Status})
+	}
+
+	status := http.StatusCreated
+	if queued == 0 {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"queued": queued, "lane": services.LaneBulk, "results": results})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"web-scraper/analyser"
+	"web-scraper/models"
+)
+
+// headerFlag collects repeated --header "Name: value" flags
+type headerFlag map[string]string
+
+func (h headerFlag) String() string {
+	return ""
+}
+
+func (h headerFlag) Set(value string) error {
+	name, headerValue, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return errors.New(`expected "Name: value"`)
+	}
+	h[strings.TrimSpace(name)] = strings.TrimSpace(headerValue)
+	return nil
+}
+
+// runAnalyse crawls a URL in-process. It exits with 1 when the crawl failed.
+func runAnalyse(ctx context.Context, args []string) int {
+	fs := newFlagSet("analyse", "<url>")
+	format := fs.String("format", "table", "output format, table or json")
+	userAgent := fs.String("user-agent", "", "User-Agent of the crawler, CRAWL_USER_AGENT by default")
+	headers := headerFlag{}
+	fs.Var(headers, "header", `header sent to the host of the URL, "Name: value", repeatable`)
+	verbose := fs.Bool("v", false, "log the progress of the crawl to stderr")
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(args) != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *format != "table" && *format != "json" {
+		return fail(fmt.Errorf("unknown format %q", *format))
+	}
+	initLogging(*verbose)
+
+	opts := analyser.OptionsFromEnv()
+	opts.Profile = profileFromFlags(*userAgent, headers)
+
+	result, err := analyser.Analyse(ctx, args[0], opts)
+	if result.Status == "cancelled" {
+		return fail(err)
+	}
+	// printed like the analyses of the server
+	urlAnalysis := &models.URLAnalysis{URL: result.URL, Attempts: 1}
+	result.ApplyTo(urlAnalysis)
+
+	if *format == "json" {
+		err = printJSON(os.Stdout, urlAnalysis)
+	} else {
+		err = printAnalysis(os.Stdout, urlAnalysis)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if urlAnalysis.Status == "errored" {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// profileFromFlags returns the crawl profile of --user-agent and --header, nil when neither is set.
+// Credential headers of a profile only go to its site, the host of the analysed URL.
+func profileFromFlags(userAgent string, headers headerFlag) *models.CrawlProfile {
+	if userAgent == "" && len(headers) == 0 {
+		return nil
+	}
+	return &models.CrawlProfile{UserAgent: userAgent, Credentials: models.CrawlCredentials{Headers: headers}}
+}
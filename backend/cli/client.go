@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"web-scraper/models"
+)
+
+// apiClient calls the API of a running server as the owner of an API token
+type apiClient struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+// apiFlags adds --server and --token to fs, the returned function builds the client once fs is parsed
+func apiFlags(fs *flag.FlagSet) func() (*apiClient, error) {
+	server := fs.String("server", envOr("URL_ANALYSER_SERVER", "http://localhost:8080"), "URL of the server, URL_ANALYSER_SERVER")
+	token := fs.String("token", os.Getenv("URL_ANALYSER_TOKEN"), "API token, URL_ANALYSER_TOKEN")
+	return func() (*apiClient, error) {
+		if *token == "" {
+			return nil, errors.New("an API token is needed, create one with POST /tokens and pass it with --token or URL_ANALYSER_TOKEN")
+		}
+		return &apiClient{server: strings.TrimRight(*server, "/"), token: *token, http: &http.Client{Timeout: 30 * time.Second}}, nil
+	}
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// do sends a request with body as JSON and decodes the JSON answer into out, error answers become errors
+func (c *apiClient) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.server+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var answer struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &answer) != nil || answer.Error == "" {
+			answer.Error = strings.TrimSpace(string(data))
+		}
+		return fmt.Errorf("server answered %d: %s", resp.StatusCode, answer.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *apiClient) getAnalysis(ctx context.Context, id string) (*models.URLAnalysis, error) {
+	var urlAnalysis models.URLAnalysis
+	if err := c.do(ctx, http.MethodGet, "/urls/"+id, nil, &urlAnalysis); err != nil {
+		return nil, err
+	}
+	return &urlAnalysis, nil
+}
+
+func (c *apiClient) listAnalyses(ctx context.Context) ([]models.URLAnalysis, error) {
+	var answer struct {
+		URLs []models.URLAnalysis `json:"urls"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/urls", nil, &answer); err != nil {
+		return nil, err
+	}
+	return answer.URLs, nil
+}
+
+// finished reports whether an analysis won't change anymore without being submitted again
+func finished(status string) bool {
+	switch status {
+	case "done", "partial", "errored", "cancelled":
+		return true
+	}
+	return false
+}
+
+// waitFor polls an analysis until it finished
+func (c *apiClient) waitFor(ctx context.Context, id uint, interval time.Duration) (*models.URLAnalysis, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		urlAnalysis, err := c.getAnalysis(ctx, fmt.Sprint(id))
+		if err != nil {
+			return nil, err
+		}
+		if finished(urlAnalysis.Status) {
+			return urlAnalysis, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("analysis %d is still %s: %w", id, urlAnalysis.Status, context.Cause(ctx))
+		case <-ticker.C:
+		}
+	}
+}
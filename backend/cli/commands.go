@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+	"web-scraper/models"
+)
+
+func checkFormat(format string, formats ...string) error {
+	for _, f := range formats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// runAdd submits URLs, with --wait it prints their results and exits with 1 when one failed
+func runAdd(ctx context.Context, args []string) int {
+	fs := newFlagSet("add", "<url>...")
+	client := apiFlags(fs)
+	lane := fs.String("lane", "", "priority lane: interactive, scheduled or bulk")
+	profileID := fs.Uint("profile", 0, "ID of the crawl profile to use")
+	wait := fs.Bool("wait", false, "wait for the analyses to finish and print them")
+	timeout := fs.Duration("timeout", 10*time.Minute, "how long --wait waits")
+	format := fs.String("format", "table", "output format, table or json")
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := checkFormat(*format, "table", "json"); err != nil {
+		return fail(err)
+	}
+	api, err := client()
+	if err != nil {
+		return fail(err)
+	}
+
+	type added struct {
+		ID     uint   `json:"id"`
+		URL    string `json:"url"`
+		Status string `json:"status"`
+		Lane   string `json:"lane"`
+	}
+	var submitted []added
+	for _, url := range args {
+		input := map[string]any{"url": url, "lane": *lane}
+		if *profileID != 0 {
+			input["profileId"] = *profileID
+		}
+		var answer added
+		if err := api.do(ctx, http.MethodPost, "/urls", input, &answer); err != nil {
+			return fail(fmt.Errorf("%s: %w", url, err))
+		}
+		submitted = append(submitted, answer)
+	}
+
+	if !*wait {
+		if *format == "json" {
+			err = printJSON(os.Stdout, submitted)
+		} else {
+			for _, answer := range submitted {
+				fmt.Printf("%d\t%s\t%s\n", answer.ID, answer.Status, answer.URL)
+			}
+		}
+		if err != nil {
+			return fail(err)
+		}
+		return exitOK
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	code := exitOK
+	results := []*models.URLAnalysis{}
+	for _, answer := range submitted {
+		urlAnalysis, err := api.waitFor(waitCtx, answer.ID, 2*time.Second)
+		if err != nil {
+			return fail(err)
+		}
+		if urlAnalysis.Status == "errored" || urlAnalysis.Status == "cancelled" {
+			code = exitFailed
+		}
+		results = append(results, urlAnalysis)
+	}
+
+	if *format == "json" {
+		err = printJSON(os.Stdout, results)
+	} else {
+		for i, urlAnalysis := range results {
+			if i > 0 {
+				fmt.Println()
+			}
+			if err = printAnalysis(os.Stdout, urlAnalysis); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return code
+}
+
+func runList(ctx context.Context, args []string) int {
+	fs := newFlagSet("list", "")
+	client := apiFlags(fs)
+	status := fs.String("status", "", "only list analyses with this status")
+	format := fs.String("format", "table", "output format, table or json")
+
+	if _, err := parseFlags(fs, args); err != nil {
+		return exitUsage
+	}
+	if err := checkFormat(*format, "table", "json"); err != nil {
+		return fail(err)
+	}
+	api, err := client()
+	if err != nil {
+		return fail(err)
+	}
+
+	analyses, err := api.listAnalyses(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	if *status != "" {
+		filtered := []models.URLAnalysis{}
+		for _, urlAnalysis := range analyses {
+			if urlAnalysis.Status == *status {
+				filtered = append(filtered, urlAnalysis)
+			}
+		}
+		analyses = filtered
+	}
+
+	if *format == "json" {
+		err = printJSON(os.Stdout, analyses)
+	} else {
+		err = printAnalyses(os.Stdout, analyses)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
+
+func runGet(ctx context.Context, args []string) int {
+	fs := newFlagSet("get", "<id>")
+	client := apiFlags(fs)
+	format := fs.String("format", "table", "output format, table or json")
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(args) != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := checkFormat(*format, "table", "json"); err != nil {
+		return fail(err)
+	}
+	api, err := client()
+	if err != nil {
+		return fail(err)
+	}
+
+	urlAnalysis, err := api.getAnalysis(ctx, args[0])
+	if err != nil {
+		return fail(err)
+	}
+	if *format == "json" {
+		err = printJSON(os.Stdout, urlAnalysis)
+	} else {
+		err = printAnalysis(os.Stdout, urlAnalysis)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
+
+func runCancel(ctx context.Context, args []string) int {
+	fs := newFlagSet("cancel", "<id>")
+	client := apiFlags(fs)
+
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(args) != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	api, err := client()
+	if err != nil {
+		return fail(err)
+	}
+
+	var answer struct {
+		Message string `json:"message"`
+	}
+	if err := api.do(ctx, http.MethodPost, "/urls/"+args[0]+"/cancel", nil, &answer); err != nil {
+		return fail(err)
+	}
+	fmt.Println(answer.Message)
+	return exitOK
+}
+
+// runExport writes the given analyses, or all of them, as CSV or JSON
+func runExport(ctx context.Context, args []string) int {
+	fs := newFlagSet("export", "[<id>...]")
+	client := apiFlags(fs)
+	format := fs.String("format", "csv", "output format, csv or json")
+	output := fs.String("o", "", "file to write to instead of stdout")
+
+	ids, err := parseFlags(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if err := checkFormat(*format, "csv", "json"); err != nil {
+		return fail(err)
+	}
+	api, err := client()
+	if err != nil {
+		return fail(err)
+	}
+
+	var analyses []models.URLAnalysis
+	if len(ids) == 0 {
+		if analyses, err = api.listAnalyses(ctx); err != nil {
+			return fail(err)
+		}
+	}
+	for _, id := range ids {
+		urlAnalysis, err := api.getAnalysis(ctx, id)
+		if err != nil {
+			return fail(fmt.Errorf("analysis %s: %w", id, err))
+		}
+		analyses = append(analyses, *urlAnalysis)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fail(err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if *format == "json" {
+		err = printJSON(w, analyses)
+	} else {
+		err = writeCSV(w, analyses)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
+
+var csvHeader = []string{
+	"id", "url", "status", "title", "html_version", "h1", "h2", "h3", "h4", "h5", "h6",
+	"internal_links", "external_links", "checked_links", "broken_links", "login_form",
+	"word_count", "language", "status_code", "error", "updated_at",
+}
+
+func writeCSV(w io.Writer, analyses []models.URLAnalysis) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, a := range analyses {
+		cw.Write([]string{
+			strconv.FormatUint(uint64(a.ID), 10), a.URL, a.Status, a.PageTitle, a.HTMLVersion,
+			strconv.Itoa(a.H1Count), strconv.Itoa(a.H2Count), strconv.Itoa(a.H3Count),
+			strconv.Itoa(a.H4Count), strconv.Itoa(a.H5Count), strconv.Itoa(a.H6Count),
+			strconv.Itoa(a.InternalLinkCount), strconv.Itoa(a.ExternalLinkCount),
+			strconv.Itoa(a.CheckedLinkCount), strconv.Itoa(a.InaccessibleLinkCount),
+			strconv.FormatBool(a.HasLoginForm), strconv.Itoa(a.WordCount), a.Content.Language,
+			strconv.Itoa(a.Response.StatusCode), a.LastError, a.UpdatedAt.Format(time.RFC3339),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"web-scraper/analyser"
+	"web-scraper/gate"
+)
+
+// runGate analyses URLs in-process and checks them against quality thresholds, for CI pipelines.
+// It exits with 1 when a page missed a threshold.
+func runGate(ctx context.Context, args []string) int {
+	fs := newFlagSet("gate", "[<url>...]")
+	urlsFile := fs.String("urls", "", `file with one URL per line, "-" reads stdin`)
+	crawl := fs.Bool("crawl", false, "also check the pages the URLs link to on their host")
+	maxPages := fs.Int("max-pages", 50, "pages checked at most with --crawl")
+	maxBroken := fs.Int("max-broken-links", 0, "broken links a page may have, -1 allows any number")
+	requireTitle := fs.Bool("require-title", true, "pages need a title")
+	requireH1 := fs.Bool("require-h1", true, "pages need an h1 heading")
+	htmlVersions := fs.String("html-versions", "", "comma separated HTML versions pages may use, e.g. HTML5, any by default")
+	allowPartial := fs.Bool("allow-partial", false, "pass pages whose analysis ran out of budget")
+	junitFile := fs.String("junit", "", "write a JUnit XML report to this file")
+	sarifFile := fs.String("sarif", "", "write a SARIF report to this file")
+	userAgent := fs.String("user-agent", "", "User-Agent of the crawler, CRAWL_USER_AGENT by default")
+	headers := headerFlag{}
+	fs.Var(headers, "header", `header sent to the hosts of the URLs, "Name: value", repeatable`)
+	verbose := fs.Bool("v", false, "log the progress of the crawls to stderr")
+
+	urls, err := parseFlags(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if *urlsFile != "" {
+		listed, err := readURLList(*urlsFile)
+		if err != nil {
+			return fail(err)
+		}
+		urls = append(urls, listed...)
+	}
+	if len(urls) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	initLogging(*verbose)
+
+	opts := gate.Options{
+		Thresholds: gate.Thresholds{
+			MaxBrokenLinks: *maxBroken,
+			RequireTitle:   *requireTitle,
+			RequireH1:      *requireH1,
+			AllowPartial:   *allowPartial,
+		},
+		Analyser: analyser.OptionsFromEnv(),
+		Crawl:    *crawl,
+		MaxPages: *maxPages,
+		OnPage:   func(page gate.PageReport) { printPageReport(os.Stdout, page) },
+	}
+	for _, version := range strings.Split(*htmlVersions, ",") {
+		if version = strings.TrimSpace(version); version != "" {
+			opts.Thresholds.HTMLVersions = append(opts.Thresholds.HTMLVersions, version)
+		}
+	}
+	opts.Analyser.Profile = profileFromFlags(*userAgent, headers)
+
+	report, err := gate.Run(ctx, urls, opts)
+	if err != nil {
+		return fail(err)
+	}
+
+	if *junitFile != "" {
+		if err := writeReport(*junitFile, report, gate.WriteJUnit); err != nil {
+			return fail(err)
+		}
+	}
+	if *sarifFile != "" {
+		if err := writeReport(*sarifFile, report, gate.WriteSARIF); err != nil {
+			return fail(err)
+		}
+	}
+
+	fmt.Printf("\n%d page(s) checked, %d violation(s) in %s\n", len(report.Pages), report.Violations(), report.Duration.Round(time.Millisecond))
+	if !report.Passed() {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// readURLList reads one URL per line from path, "-" being stdin. Blank lines and lines starting with # are skipped.
+func readURLList(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(urls) == 0 {
+		return nil, errors.New(path + " lists no URLs")
+	}
+	return urls, nil
+}
+
+// printPageReport prints whether a page passed, with its violations
+func printPageReport(w io.Writer, page gate.PageReport) {
+	if len(page.Violations) == 0 {
+		fmt.Fprintf(w, "PASS  %s\n", page.URL)
+		return
+	}
+	fmt.Fprintf(w, "FAIL  %s\n", page.URL)
+	for _, violation := range page.Violations {
+		fmt.Fprintf(w, "      %-14s %s\n", violation.Rule, violation.Message)
+	}
+}
+
+// writeReport writes report to the file at path with write
+func writeReport(path string, report gate.Report, write func(io.Writer, gate.Report) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file, report); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// the page served at / of every site, the gate requires a title and an h1 by default
+const (
+	passingPage  = `<!DOCTYPE html><html><head><title>Home</title></head><body><h1>Home</h1><a href="/about">About</a></body></html>`
+	brokenPage   = `<!DOCTYPE html><html><head><title>Home</title></head><body><h1>Home</h1><a href="/missing">Gone</a></body></html>`
+	untitledPage = `<!DOCTYPE html><html><body><p>No title, no heading</p></body></html>`
+)
+
+func newGateSite(t *testing.T, page string) string {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	})
+	mux.HandleFunc("/about", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(passingPage))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL + "/"
+}
+
+func TestRunGateExitCode(t *testing.T) {
+	// the test sites listen on loopback, which the SSRF guard refuses
+	t.Setenv("SSRF_PROTECTION", "false")
+
+	tests := []struct {
+		name     string
+		page     string
+		args     []string
+		want     int
+		failures int
+	}{
+		{"passing page", passingPage, nil, exitOK, 0},
+		{"broken link over the threshold", brokenPage, nil, exitFailed, 1},
+		{"broken link within the threshold", brokenPage, []string{"--max-broken-links", "1"}, exitOK, 0},
+		{"missing title and h1", untitledPage, nil, exitFailed, 2},
+		{"title and h1 not required", untitledPage, []string{"--require-title=false", "--require-h1=false"}, exitOK, 0},
+		{"HTML version not allowed", passingPage, []string{"--html-versions", "HTML4.01, XHTML1.1"}, exitFailed, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			junitPath, sarifPath := filepath.Join(dir, "gate.xml"), filepath.Join(dir, "gate.sarif")
+			args := append([]string{"--junit", junitPath, "--sarif", sarifPath, newGateSite(t, tt.page)}, tt.args...)
+
+			if got := runGate(context.Background(), args); got != tt.want {
+				t.Fatalf("runGate exited with %d, want %d", got, tt.want)
+			}
+
+			var junit struct {
+				Failures int `xml:"failures,attr"`
+			}
+			data, err := os.ReadFile(junitPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := xml.Unmarshal(data, &junit); err != nil {
+				t.Fatalf("JUnit report: %v", err)
+			}
+			if junit.Failures != tt.failures {
+				t.Errorf("JUnit report counts %d failures, want %d", junit.Failures, tt.failures)
+			}
+
+			var sarif struct {
+				Runs []struct {
+					Results []json.RawMessage `json:"results"`
+				} `json:"runs"`
+			}
+			if data, err = os.ReadFile(sarifPath); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(data, &sarif); err != nil || len(sarif.Runs) != 1 {
+				t.Fatalf("SARIF report with %d runs: %v", len(sarif.Runs), err)
+			}
+			if len(sarif.Runs[0].Results) != tt.failures {
+				t.Errorf("SARIF report has %d results, want %d", len(sarif.Runs[0].Results), tt.failures)
+			}
+		})
+	}
+}
+
+func TestRunGateUsage(t *testing.T) {
+	if got := runGate(context.Background(), nil); got != exitUsage {
+		t.Errorf("runGate without URLs exited with %d, want %d", got, exitUsage)
+	}
+	if got := runGate(context.Background(), []string{"--max-pages", "many", "https://example.com/"}); got != exitUsage {
+		t.Errorf("runGate with a bad flag exited with %d, want %d", got, exitUsage)
+	}
+}
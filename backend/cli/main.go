@@ -0,0 +1,110 @@
+// Command cli, built as url-analyser, analyses URLs from a terminal or a CI job. "analyse" and "gate" run
+// the crawler in-process, without the server, a database or Auth0. The other commands call the API of a
+// running server with an API token.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// exit codes, scripts tell a failed analysis from a failing command by them
+const (
+	exitOK     = 0
+	exitFailed = 1 // the analysis failed or found problems
+	exitUsage  = 2 // bad arguments or the command couldn't run
+)
+
+const usage = `Usage: url-analyser <command> [flags] [arguments]
+
+Standalone, nothing but network access needed:
+  analyse <url>     crawl and analyse a URL, print the result
+  gate [<url>...]   check URLs or a site against quality thresholds, for CI
+
+Against a running server, see --server and --token:
+  add <url>...      submit URLs for analysis, --wait waits for the results
+  list              list analyses
+  get <id>          show an analysis
+  cancel <id>       cancel a queued or running analysis
+  export [<id>...]  write analyses as CSV or JSON
+
+Run "url-analyser <command> -h" for the flags of a command.
+`
+
+var commands = map[string]func(ctx context.Context, args []string) int{
+	"analyse": runAnalyse,
+	"gate":    runGate,
+	"add":     runAdd,
+	"list":    runList,
+	"get":     runGet,
+	"cancel":  runCancel,
+	"export":  runExport,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitUsage)
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		if os.Args[1] != "-h" && os.Args[1] != "--help" && os.Args[1] != "help" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		}
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitUsage)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	code := command(ctx, os.Args[2:])
+	stop()
+	os.Exit(code)
+}
+
+// parseFlags parses args with flags allowed before and after the arguments, it returns the arguments.
+// Errors are reported by the flag set.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// newFlagSet returns the flag set of a command, its usage line lists the arguments
+func newFlagSet(name, arguments string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: url-analyser %s [flags] %s\n", name, arguments)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// initLogging sends log output to stderr, which keeps stdout for the results. Only warnings are shown
+// unless verbose.
+func initLogging(verbose bool) {
+	level := slog.LevelWarn
+	if verbose {
+		level = slog.LevelInfo
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+}
+
+// fail reports an error that kept the command from running
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	return exitUsage
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"web-scraper/models"
+)
+
+func printJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// printAnalysis prints the outcome of an analysis as aligned rows, followed by its broken links
+func printAnalysis(w io.Writer, urlAnalysis *models.URLAnalysis) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	row := func(name string, value any) {
+		fmt.Fprintf(tw, "%s\t%v\n", name, value)
+	}
+
+	if urlAnalysis.ID != 0 {
+		row("ID", urlAnalysis.ID)
+	}
+	row("URL", urlAnalysis.URL)
+	row("Status", urlAnalysis.Status)
+	if urlAnalysis.LastError != "" {
+		row("Error", fmt.Sprintf("%s (%s)", urlAnalysis.LastError, urlAnalysis.ErrorCategory))
+	}
+	for _, reason := range urlAnalysis.PartialReasons {
+		row("Partial", reason)
+	}
+	if urlAnalysis.Response.StatusCode != 0 {
+		row("Status code", urlAnalysis.Response.StatusCode)
+	}
+	if urlAnalysis.Response.FinalURL != "" && urlAnalysis.Response.FinalURL != urlAnalysis.URL {
+		row("Final URL", urlAnalysis.Response.FinalURL)
+	}
+
+	if urlAnalysis.Status == "done" || urlAnalysis.Status == "partial" {
+		row("Title", urlAnalysis.PageTitle)
+		row("HTML version", urlAnalysis.HTMLVersion)
+		row("Headings", fmt.Sprintf("h1 %d, h2 %d, h3 %d, h4 %d, h5 %d, h6 %d",
+			urlAnalysis.H1Count, urlAnalysis.H2Count, urlAnalysis.H3Count, urlAnalysis.H4Count, urlAnalysis.H5Count, urlAnalysis.H6Count))
+		row("Links", fmt.Sprintf("%d internal, %d external, %d checked", urlAnalysis.InternalLinkCount, urlAnalysis.ExternalLinkCount, urlAnalysis.CheckedLinkCount))
+		row("Broken links", urlAnalysis.InaccessibleLinkCount)
+		row("Login form", yesNo(urlAnalysis.HasLoginForm))
+		row("Words", urlAnalysis.WordCount)
+		if urlAnalysis.Content.Language != "" {
+			row("Language", urlAnalysis.Content.Language)
+		}
+		row("Response time", fmt.Sprintf("%.0f ms", urlAnalysis.Response.Timing.TotalMs))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(urlAnalysis.BrokenLinks) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tBROKEN LINK\tERROR")
+	for _, link := range urlAnalysis.BrokenLinks {
+		status := "-"
+		if link.StatusCode != 0 {
+			status = strconv.Itoa(link.StatusCode)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", status, link.URL, link.ErrorMessage)
+	}
+	return tw.Flush()
+}
+
+// printAnalyses prints one row per analysis
+func printAnalyses(w io.Writer, analyses []models.URLAnalysis) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tBROKEN\tTITLE\tURL")
+	for _, urlAnalysis := range analyses {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\n", urlAnalysis.ID, urlAnalysis.Status, urlAnalysis.InaccessibleLinkCount,
+			truncate(strings.TrimSpace(urlAnalysis.PageTitle), 40), urlAnalysis.URL)
+	}
+	return tw.Flush()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// truncate shortens s to limit runes for table cells
+func truncate(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit-1]) + "…"
+}
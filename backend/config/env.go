@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -35,3 +37,30 @@ func GetAuth0Audience() string {
 	}
 	return audience
 }
+
+// GetEnvBool returns the boolean value of key, or fallback when it is unset or unparsable.
+func GetEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(GetEnv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// GetEnvInt returns the integer value of key, or fallback when it is unset or unparsable.
+func GetEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(GetEnv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// GetEnvDuration returns the duration value of key such as "30s" or "2m", or fallback when it is unset or unparsable.
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(GetEnv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
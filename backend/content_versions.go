@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"web-scraper/models"
+	"web-scraper/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetUrlVersions lists the content versions of an analysis with their diffs, newest first
+func GetUrlVersions(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	urlAnalysis, ok := findUserAnalysis(c, db, "id", "content_hash", "structure_hash", "content_changed_at")
+	if !ok {
+		return
+	}
+
+	versions := []models.ContentVersion{}
+	if err := db.Omit("text").Where("url_analysis_id = ?", urlAnalysis.ID).Order("id DESC").Find(&versions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch content versions " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":               urlAnalysis.ID,
+		"contentHash":      urlAnalysis.ContentHash,
+		"structureHash":    urlAnalysis.StructureHash,
+		"contentChangedAt": urlAnalysis.ContentChangedAt,
+		"versions":         versions,
+	})
+}
+
+// GetUrlDiff compares two content versions of an analysis, ?from= and ?to= take version IDs.
+// Without them the newest version is compared with the one before it.
+func GetUrlDiff(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	urlAnalysis, ok := findUserAnalysis(c, db, "id")
+	if !ok {
+		return
+	}
+	id := urlAnalysis.ID
+
+	var fromID, toID int64
+	for param, target := range map[string]*int64{"from": &fromID, "to": &toID} {
+		if value := c.Query(param); value != "" {
+			var err error
+			if *target, err = strconv.ParseInt(value, 10, 64); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version ID format for " + param})
+				return
+			}
+		}
+	}
+
+	var to models.ContentVersion
+	query := db.Where("url_analysis_id = ?", id)
+	if toID != 0 {
+		query = query.Where("id = ?", toID)
+	}
+	if err := query.Order("id DESC").First(&to).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Content version not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch content version " + err.Error()})
+		}
+		return
+	}
+
+	var from models.ContentVersion
+	query = db.Where("url_analysis_id = ?", id)
+	if fromID != 0 {
+		query = query.Where("id = ?", fromID)
+	} else {
+		query = query.Where("id < ?", to.ID)
+	}
+	if err := query.Order("id DESC").First(&from).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No earlier content version to compare with"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch content version " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":   id,
+		"from": from.ID,
+		"to":   to.ID,
+		"diff": services.DiffContentVersions(from, to),
+	})
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"web-scraper/analyser"
+	"web-scraper/logging"
+	"web-scraper/models"
+	"web-scraper/secrets"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CrawlProfileInput struct {
+	Name string `json:"name" binding:"required,max=100"`
+	Site string `json:"site" binding:"max=255"`
+
+	UserAgent      string            `json:"userAgent" binding:"max=512"`
+	AcceptLanguage string            `json:"acceptLanguage" binding:"max=100"`
+	ExtraHeaders   map[string]string `json:"extraHeaders"`
+	UseProxyPool   bool              `json:"useProxyPool"`
+
+	Headers   map[string]string      `json:"headers"`
+	Cookies   []models.ProfileCookie `json:"cookies" binding:"dive"`
+	BasicAuth *models.BasicAuth      `json:"basicAuth"`
+	FormLogin *models.FormLogin      `json:"formLogin"`
+}
+
+// applyTo copies everything but the owner onto profile
+func (input CrawlProfileInput) applyTo(profile *models.CrawlProfile) {
+	profile.Name = strings.TrimSpace(input.Name)
+	profile.Site = strings.ToLower(strings.TrimSpace(input.Site))
+	profile.UserAgent = strings.TrimSpace(input.UserAgent)
+	profile.AcceptLanguage = strings.TrimSpace(input.AcceptLanguage)
+	profile.ExtraHeaders = input.ExtraHeaders
+	profile.UseProxyPool = input.UseProxyPool
+	profile.Credentials = input.credentials()
+}
+
+func (input CrawlProfileInput) credentials() models.CrawlCredentials {
+	return models.CrawlCredentials{
+		Headers:   input.Headers,
+		Cookies:   input.Cookies,
+		BasicAuth: input.BasicAuth,
+		FormLogin: input.FormLogin,
+	}
+}
+
+// crawlProfileResponse describes a profile without exposing any of its secrets
+func crawlProfileResponse(profile models.CrawlProfile) gin.H {
+	creds := profile.Credentials
+
+	headerNames := make([]string, 0, len(creds.Headers))
+	for name := range creds.Headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+
+	cookieNames := make([]string, 0, len(creds.Cookies))
+	for _, cookie := range creds.Cookies {
+		cookieNames = append(cookieNames, cookie.Name)
+	}
+
+	response := gin.H{
+		"id":        profile.ID,
+		"name":      profile.Name,
+		"site":      profile.Site,
+		"headers":   headerNames,
+		"cookies":   cookieNames,
+		"createdAt": profile.CreatedAt,
+		"updatedAt": profile.UpdatedAt,
+
+		"userAgent":      profile.UserAgent,
+		"acceptLanguage": profile.AcceptLanguage,
+		"extraHeaders":   profile.ExtraHeaders,
+		"useProxyPool":   profile.UseProxyPool,
+	}
+	if creds.BasicAuth != nil {
+		response["basicAuthUser"] = creds.BasicAuth.Username
+	}
+	if creds.FormLogin != nil {
+		response["formLoginUrl"] = creds.FormLogin.PageURL
+	}
+	return response
+}
+
+// findUserCrawlProfile loads the profile with the id of the request path, making sure it belongs to the caller
+func findUserCrawlProfile(c *gin.Context, db *gorm.DB) (models.CrawlProfile, bool) {
+	var profile models.CrawlProfile
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid profile ID format"})
+		return profile, false
+	}
+
+	result := db.Where("user_id = ?", c.GetString("UserID")).First(&profile, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Crawl profile not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch crawl profile: " + result.Error.Error()})
+		}
+		return profile, false
+	}
+
+	return profile, true
+}
+
+func crawlProfileSaveError(c *gin.Context, err error) {
+	if errors.Is(err, secrets.ErrKeyNotConfigured) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Crawl profiles are disabled: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save crawl profile: " + err.Error()})
+}
+
+func CreateCrawlProfile(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	var input CrawlProfileInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profile := models.CrawlProfile{UserID: c.GetString("UserID")}
+	input.applyTo(&profile)
+
+	if err := db.Create(&profile).Error; err != nil {
+		crawlProfileSaveError(c, err)
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Crawl profile created", "profile_id", profile.ID, "site", profile.Site)
+	c.JSON(http.StatusCreated, crawlProfileResponse(profile))
+}
+
+func GetCrawlProfiles(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	profiles := []models.CrawlProfile{}
+	if err := db.Where("user_id = ?", c.GetString("UserID")).Find(&profiles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch crawl profiles " + err.Error()})
+		return
+	}
+
+	response := make([]gin.H, 0, len(profiles))
+	for _, profile := range profiles {
+		response = append(response, crawlProfileResponse(profile))
+	}
+	c.JSON(http.StatusOK, gin.H{"profiles": response})
+}
+
+func GetCrawlProfile(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	profile, ok := findUserCrawlProfile(c, db)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, crawlProfileResponse(profile))
+}
+
+// UpdateCrawlProfile replaces all settings and credentials of a profile
+func UpdateCrawlProfile(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	profile, ok := findUserCrawlProfile(c, db)
+	if !ok {
+		return
+	}
+
+	var input CrawlProfileInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input.applyTo(&profile)
+
+	if err := db.Save(&profile).Error; err != nil {
+		crawlProfileSaveError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, crawlProfileResponse(profile))
+}
+
+func DeleteCrawlProfile(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	profile, ok := findUserCrawlProfile(c, db)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// analyses fall back to site matching once their profile is gone
+		if err := tx.Model(&models.URLAnalysis{}).Where("crawl_profile_id = ?", profile.ID).Update("crawl_profile_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&profile).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete crawl profile: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Crawl profile deleted", "id": profile.ID})
+}
+
+// GetProxyPool reports the health of the outbound proxies configured in CRAWL_PROXY_POOL, to admins only as
+// the hosts are part of the operator's infrastructure
+func GetProxyPool(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"proxies": analyser.ProxyPoolStatus()})
+}
@@ -0,0 +1,101 @@
+// Package database opens the database of the server, MySQL, PostgreSQL or SQLite. SQLite needs no
+// database server, e.g. to run the backend locally.
+package database
+
+import (
+	"fmt"
+	"strings"
+	"web-scraper/config"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// drivers of DB_DRIVER, also the names of their gorm dialectors
+const (
+	MySQL    = "mysql"
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// Options select and address the database
+type Options struct {
+	Driver string
+	// DSN is passed to the driver as is, for SQLite the path of the database file or ":memory:"
+	DSN string
+}
+
+// OptionsFromEnv reads DB_DRIVER, "mysql" (default), "postgres" or "sqlite", and DB_DSN. Without DB_DSN the DSN is
+// built from DB_USER, DB_PASSWORD, DB_HOST, DB_PORT and DB_NAME, plus DB_SSLMODE for PostgreSQL ("disable" by
+// default). DB_NAME is the database file of SQLite, "url-analyser.db" by default.
+func OptionsFromEnv() Options {
+	opts := Options{Driver: config.GetEnv("DB_DRIVER"), DSN: config.GetEnv("DB_DSN")}
+	if opts.Driver == "" {
+		opts.Driver = MySQL
+	}
+	if opts.DSN != "" {
+		return opts
+	}
+
+	user, password := config.GetEnv("DB_USER"), config.GetEnv("DB_PASSWORD")
+	host, port, name := config.GetEnv("DB_HOST"), config.GetEnv("DB_PORT"), config.GetEnv("DB_NAME")
+	switch opts.Driver {
+	case MySQL:
+		opts.DSN = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", user, password, host, port, name)
+	case Postgres:
+		sslMode := config.GetEnv("DB_SSLMODE")
+		if sslMode == "" {
+			sslMode = "disable"
+		}
+		opts.DSN = fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s", host, port, user, password, name, sslMode)
+	case SQLite:
+		opts.DSN = name
+		if opts.DSN == "" {
+			opts.DSN = "url-analyser.db"
+		}
+	}
+	return opts
+}
+
+// Open connects to the database of opts
+func Open(opts Options) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch opts.Driver {
+	case MySQL:
+		dialector = mysql.Open(opts.DSN)
+	case Postgres:
+		dialector = postgres.Open(opts.DSN)
+	case SQLite:
+		dialector = sqlite.Open(sqliteDSN(opts.DSN))
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q, expected mysql, postgres or sqlite", opts.Driver)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	if opts.Driver == SQLite {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		// SQLite takes one writer at a time, and every connection to ":memory:" has a database of its own
+		sqlDB.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
+
+// sqliteDSN waits for locks instead of failing with "database is locked", unless dsn sets pragmas itself
+func sqliteDSN(dsn string) string {
+	if dsn == ":memory:" || strings.Contains(dsn, "_pragma=") {
+		return dsn
+	}
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+}
@@ -0,0 +1,292 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrationFiles are the schema changes of every driver, migrations/<driver>/<version>_<name>.up.sql and .down.sql
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+var (
+	// ErrSchemaOutdated is returned by CheckSchema when migrations are pending
+	ErrSchemaOutdated = errors.New("database schema is outdated")
+	// ErrNoMigrationHistory is returned for databases with tables but no applied migrations, created by AutoMigrate
+	ErrNoMigrationHistory = errors.New(`database has tables but no migration history, run "migrate baseline" once`)
+)
+
+// Migration is a versioned schema change and the change reverting it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration with when it was applied, AppliedAt is nil for pending migrations.
+// Unknown migrations were applied to the database but aren't part of this build, it is newer than the binary.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+	Unknown   bool
+}
+
+// schemaMigration is a row of the status table, one per applied migration
+type schemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:255;not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrations returns the migrations of driver, ordered by version
+func Migrations(driver string) ([]Migration, error) {
+	dir := path.Join("migrations", driver)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for driver %q", driver)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name, direction, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		versionText, label, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(versionText)
+		if !ok || err != nil || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration file %s isn't named <version>_<name>.up.sql or .down.sql", entry.Name())
+		}
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: label}
+			byVersion[version] = migration
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up script", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+	return migrations, nil
+}
+
+// Status returns every migration of the database, applied or pending, ordered by version
+func Status(db *gorm.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var status []MigrationStatus
+	for _, migration := range migrations {
+		entry := MigrationStatus{Migration: migration}
+		if row, ok := applied[migration.Version]; ok {
+			entry.AppliedAt = &row.AppliedAt
+			delete(applied, migration.Version)
+		}
+		status = append(status, entry)
+	}
+	for _, row := range applied {
+		status = append(status, MigrationStatus{Migration: Migration{Version: row.Version, Name: row.Name}, AppliedAt: &row.AppliedAt, Unknown: true})
+	}
+	slices.SortFunc(status, func(a, b MigrationStatus) int { return a.Version - b.Version })
+	return status, nil
+}
+
+// CheckSchema returns ErrSchemaOutdated when migrations are pending, and ErrNoMigrationHistory for databases
+// created by AutoMigrate. Migrations unknown to this build don't fail the check, the previous release keeps
+// running while the next one is rolled out.
+func CheckSchema(db *gorm.DB) error {
+	status, err := Status(db)
+	if err != nil {
+		return err
+	}
+	if err := checkHistory(db, status); err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, migration := range status {
+		if migration.AppliedAt == nil {
+			pending = append(pending, fmt.Sprintf("%04d_%s", migration.Version, migration.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf(`%w, %d pending migration(s): %s, run "migrate up"`, ErrSchemaOutdated, len(pending), strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// MigrateUp applies the pending migrations up to version, all of them when version is 0. It returns the
+// applied migrations. Each runs in a transaction, except on MySQL where schema changes commit implicitly.
+func MigrateUp(db *gorm.DB, version int) ([]Migration, error) {
+	status, err := Status(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkHistory(db, status); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range status {
+		if migration.AppliedAt != nil || migration.Unknown || (version > 0 && migration.Version > version) {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := execScript(tx, migration.Up); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		applied = append(applied, migration.Migration)
+	}
+	return applied, nil
+}
+
+// MigrateDown reverts the last steps applied migrations and returns them
+func MigrateDown(db *gorm.DB, steps int) ([]Migration, error) {
+	status, err := Status(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(status) - 1; i >= 0 && len(reverted) < steps; i-- {
+		migration := status[i]
+		if migration.AppliedAt == nil {
+			continue
+		}
+		if migration.Unknown {
+			return reverted, fmt.Errorf("migration %04d_%s isn't part of this build, revert it with the release that added it", migration.Version, migration.Name)
+		}
+		if migration.Down == "" {
+			return reverted, fmt.Errorf("migration %04d_%s has no down script", migration.Version, migration.Name)
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := execScript(tx, migration.Down); err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{Version: migration.Version}).Error
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("reverting migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		reverted = append(reverted, migration.Migration)
+	}
+	return reverted, nil
+}
+
+// Baseline records the migrations up to version as applied without running them, for databases whose
+// schema is already at that version, e.g. created by AutoMigrate at version 1
+func Baseline(db *gorm.DB, version int) ([]Migration, error) {
+	status, err := Status(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var baselined []Migration
+	for _, migration := range status {
+		if migration.AppliedAt != nil {
+			return nil, fmt.Errorf("migration %04d_%s is applied already, baseline is for databases without migration history", migration.Version, migration.Name)
+		}
+		if migration.Version > version {
+			continue
+		}
+		if err := db.Create(&schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error; err != nil {
+			return baselined, err
+		}
+		baselined = append(baselined, migration.Migration)
+	}
+	return baselined, nil
+}
+
+// appliedMigrations returns the rows of the status table by version, creating the table when it is missing
+func appliedMigrations(db *gorm.DB) (map[int]schemaMigration, error) {
+	if !db.Migrator().HasTable(&schemaMigration{}) {
+		if err := db.Migrator().CreateTable(&schemaMigration{}); err != nil {
+			return nil, fmt.Errorf("creating the migration status table: %w", err)
+		}
+	}
+
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// checkHistory returns ErrNoMigrationHistory when no migration was applied to a database that has tables
+func checkHistory(db *gorm.DB, status []MigrationStatus) error {
+	for _, migration := range status {
+		if migration.AppliedAt != nil {
+			return nil
+		}
+	}
+	if db.Migrator().HasTable("url_analyses") {
+		return ErrNoMigrationHistory
+	}
+	return nil
+}
+
+// execScript runs the statements of a migration script one by one, drivers don't all take several at once.
+// Statements end with a semicolon at the end of a line, lines starting with -- are comments.
+func execScript(tx *gorm.DB, script string) error {
+	var statement strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		statement.WriteString(line)
+		statement.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			if err := tx.Exec(statement.String()).Error; err != nil {
+				return err
+			}
+			statement.Reset()
+		}
+	}
+	if strings.TrimSpace(statement.String()) != "" {
+		return tx.Exec(statement.String()).Error
+	}
+	return nil
+}
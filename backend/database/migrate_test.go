@@ -0,0 +1,167 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"web-scraper/models"
+
+	"gorm.io/gorm"
+)
+
+// every model with a table, the migrations have to create a column for each of their fields
+var migratedModels = []any{
+	&models.URLAnalysis{},
+	&models.CrawlLogEntry{},
+	&models.CrawlProfile{},
+	&models.ContentVersion{},
+	&models.Snapshot{},
+	&models.Webhook{},
+	&models.WebhookDelivery{},
+	&models.NotificationChannel{},
+	&models.NotificationRule{},
+	&models.APIToken{},
+}
+
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := Open(Options{Driver: SQLite, DSN: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// checkModelColumns fails t for every field of the models without a column in the database
+func checkModelColumns(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	for _, model := range migratedModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatal(err)
+		}
+		if !db.Migrator().HasTable(model) {
+			t.Errorf("table %s is missing", stmt.Schema.Table)
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !db.Migrator().HasColumn(model, field.DBName) {
+				t.Errorf("column %s.%s of %s.%s is missing", stmt.Schema.Table, field.DBName, stmt.Schema.Name, field.Name)
+			}
+		}
+	}
+}
+
+func TestMigrateSQLite(t *testing.T) {
+	db := openSQLite(t)
+
+	if err := CheckSchema(db); !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("CheckSchema of an empty database = %v, want ErrSchemaOutdated", err)
+	}
+
+	migrations, err := Migrations(SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := MigrateUp(db, 0)
+	if err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Fatalf("applied %d migrations, want %d", len(applied), len(migrations))
+	}
+	if err := CheckSchema(db); err != nil {
+		t.Fatalf("CheckSchema after MigrateUp: %v", err)
+	}
+	checkModelColumns(t, db)
+
+	// every down script reverts its up script, so the migrations apply again afterwards
+	reverted, err := MigrateDown(db, len(migrations))
+	if err != nil {
+		t.Fatalf("MigrateDown: %v", err)
+	}
+	if len(reverted) != len(migrations) {
+		t.Fatalf("reverted %d migrations, want %d", len(reverted), len(migrations))
+	}
+	for _, model := range migratedModels {
+		if db.Migrator().HasTable(model) {
+			t.Errorf("table of %T is left after reverting every migration", model)
+		}
+	}
+
+	if _, err := MigrateUp(db, 0); err != nil {
+		t.Fatalf("MigrateUp after MigrateDown: %v", err)
+	}
+	if err := CheckSchema(db); err != nil {
+		t.Fatalf("CheckSchema after migrating up again: %v", err)
+	}
+}
+
+func TestMigrateSQLiteStepByStep(t *testing.T) {
+	db := openSQLite(t)
+
+	migrations, err := Migrations(SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each migration applies on top of the previous one and reverts to it
+	for _, migration := range migrations {
+		if _, err := MigrateUp(db, migration.Version); err != nil {
+			t.Fatalf("MigrateUp to %d: %v", migration.Version, err)
+		}
+		if _, err := MigrateDown(db, 1); err != nil {
+			t.Fatalf("MigrateDown from %d: %v", migration.Version, err)
+		}
+		if _, err := MigrateUp(db, migration.Version); err != nil {
+			t.Fatalf("MigrateUp to %d again: %v", migration.Version, err)
+		}
+	}
+}
+
+// the MySQL and PostgreSQL migrations can't run here, they are checked to match the SQLite ones and to
+// stay clear of the types and quoting of the other database
+func TestMigrationsOfEveryDriver(t *testing.T) {
+	sqlite, err := Migrations(SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := func(migrations []Migration) []string {
+		result := make([]string, len(migrations))
+		for i, migration := range migrations {
+			result[i] = fmt.Sprintf("%04d_%s", migration.Version, migration.Name)
+		}
+		return result
+	}
+
+	notPortable := map[string]*regexp.Regexp{
+		Postgres: regexp.MustCompile("(?i)`|\\b(?:mediumtext|longtext|tinyint|datetime|mediumblob|longblob)\\b|auto_increment"),
+		MySQL:    regexp.MustCompile(`(?i)"[a-z_]+"\s|\b(?:jsonb|bytea|timestamptz|serial|bigserial)\b`),
+	}
+	for _, driver := range []string{MySQL, Postgres} {
+		migrations, err := Migrations(driver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(names(migrations), names(sqlite)) {
+			t.Errorf("%s migrations %v, want the ones of sqlite %v", driver, names(migrations), names(sqlite))
+		}
+		for _, migration := range migrations {
+			if strings.TrimSpace(migration.Down) == "" {
+				t.Errorf("%s migration %04d_%s has no down script", driver, migration.Version, migration.Name)
+			}
+			for _, script := range []string{migration.Up, migration.Down} {
+				for _, line := range strings.Split(script, "\n") {
+					if strings.HasPrefix(strings.TrimSpace(line), "--") {
+						continue
+					}
+					if match := notPortable[driver].FindString(line); match != "" {
+						t.Errorf("%s migration %04d_%s uses %q: %s", driver, migration.Version, migration.Name, match, strings.TrimSpace(line))
+					}
+				}
+			}
+		}
+	}
+}
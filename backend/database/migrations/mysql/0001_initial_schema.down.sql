@@ -0,0 +1,10 @@
+DROP TABLE `api_tokens`;
+DROP TABLE `notification_rules`;
+DROP TABLE `notification_channels`;
+DROP TABLE `webhook_deliveries`;
+DROP TABLE `webhooks`;
+DROP TABLE `content_versions`;
+DROP TABLE `snapshots`;
+DROP TABLE `crawl_log_entries`;
+DROP TABLE `crawl_profiles`;
+DROP TABLE `url_analyses`;
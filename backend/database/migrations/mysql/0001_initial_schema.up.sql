@@ -0,0 +1,202 @@
+-- The schema AutoMigrate created before versioned migrations. Databases created by it are marked as
+-- migrated to this version with "migrate baseline".
+
+CREATE TABLE `url_analyses` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `url` varchar(255) NOT NULL,
+    `status` varchar(20) DEFAULT 'queued',
+    `lane` varchar(20) DEFAULT 'interactive',
+    `user_id` varchar(255),
+    `crawl_profile_id` bigint unsigned,
+    `html_version` varchar(50),
+    `page_title` varchar(512),
+    `h1_count` bigint DEFAULT 0,
+    `h2_count` bigint DEFAULT 0,
+    `h3_count` bigint DEFAULT 0,
+    `h4_count` bigint DEFAULT 0,
+    `h5_count` bigint DEFAULT 0,
+    `h6_count` bigint DEFAULT 0,
+    `internal_link_count` bigint DEFAULT 0,
+    `external_link_count` bigint DEFAULT 0,
+    `inaccessible_link_count` bigint DEFAULT 0,
+    `broken_links` JSON,
+    `has_login_form` boolean DEFAULT false,
+    `login_detection` JSON,
+    `frames` JSON,
+    `checked_link_count` bigint DEFAULT 0,
+    `partial_reasons` JSON,
+    `attempts` bigint DEFAULT 0,
+    `last_error` text,
+    `next_retry_at` datetime(3) NULL,
+    `attempt_history` JSON,
+    `error_category` varchar(50),
+    `response` JSON,
+    `security` JSON,
+    `word_count` bigint DEFAULT 0,
+    `content` JSON,
+    `main_content` MEDIUMBLOB,
+    `snapshot_id` bigint unsigned,
+    `reprocessed_at` datetime(3) NULL,
+    `content_hash` varchar(64),
+    `structure_hash` varchar(64),
+    `content_changed_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_url_analyses_deleted_at` (`deleted_at`),
+    INDEX `idx_url_analyses_user_id` (`user_id`),
+    INDEX `idx_url_analyses_crawl_profile_id` (`crawl_profile_id`),
+    CONSTRAINT `uni_url_analyses_url` UNIQUE (`url`)
+);
+
+CREATE TABLE `crawl_profiles` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `user_id` varchar(255) NOT NULL,
+    `name` varchar(100) NOT NULL,
+    `site` varchar(255),
+    `user_agent` varchar(512),
+    `accept_language` varchar(100),
+    `extra_headers` JSON,
+    `use_proxy_pool` boolean DEFAULT false,
+    `credentials` text,
+    PRIMARY KEY (`id`),
+    INDEX `idx_crawl_profiles_deleted_at` (`deleted_at`),
+    INDEX `idx_crawl_profiles_user_id` (`user_id`),
+    INDEX `idx_crawl_profiles_site` (`site`)
+);
+
+CREATE TABLE `crawl_log_entries` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `url_analysis_id` bigint unsigned NOT NULL,
+    `request_id` varchar(128),
+    `level` varchar(10),
+    `message` text,
+    `fields` JSON,
+    `created_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_crawl_log_entries_url_analysis_id` (`url_analysis_id`)
+);
+
+CREATE TABLE `snapshots` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `url_analysis_id` bigint unsigned NOT NULL,
+    `attempt` bigint,
+    `url` text,
+    `blob_key` varchar(512) NOT NULL,
+    `size` bigint,
+    `records` bigint,
+    `resources` bigint,
+    `truncated` boolean,
+    `created_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_snapshots_url_analysis_id` (`url_analysis_id`)
+);
+
+CREATE TABLE `content_versions` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `url_analysis_id` bigint unsigned NOT NULL,
+    `attempt` bigint,
+    `text_hash` varchar(64),
+    `structure_hash` varchar(64),
+    `text` MEDIUMBLOB,
+    `headings` JSON,
+    `links` JSON,
+    `diff` JSON,
+    `created_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_content_versions_url_analysis_id` (`url_analysis_id`)
+);
+
+CREATE TABLE `webhooks` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `user_id` varchar(255) NOT NULL,
+    `url` varchar(2048) NOT NULL,
+    `events` JSON,
+    `active` boolean DEFAULT true,
+    `secret` text,
+    PRIMARY KEY (`id`),
+    INDEX `idx_webhooks_deleted_at` (`deleted_at`),
+    INDEX `idx_webhooks_user_id` (`user_id`)
+);
+
+CREATE TABLE `webhook_deliveries` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `webhook_id` bigint unsigned NOT NULL,
+    `user_id` varchar(255) NOT NULL,
+    `event_id` varchar(36),
+    `event_type` varchar(50),
+    `analysis_id` bigint unsigned,
+    `payload` mediumtext,
+    `status` varchar(20),
+    `attempts` bigint DEFAULT 0,
+    `next_attempt_at` datetime(3) NULL,
+    `delivered_at` datetime(3) NULL,
+    `attempt_log` JSON,
+    PRIMARY KEY (`id`),
+    INDEX `idx_webhook_deliveries_webhook_id` (`webhook_id`),
+    INDEX `idx_webhook_deliveries_user_id` (`user_id`),
+    INDEX `idx_webhook_deliveries_event_id` (`event_id`),
+    INDEX `idx_webhook_deliveries_analysis_id` (`analysis_id`),
+    INDEX `idx_webhook_deliveries_status` (`status`)
+);
+
+CREATE TABLE `notification_channels` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `user_id` varchar(255) NOT NULL,
+    `name` varchar(100) NOT NULL,
+    `type` varchar(20) NOT NULL,
+    `target` text,
+    `last_sent_at` datetime(3) NULL,
+    `last_error` varchar(1024),
+    PRIMARY KEY (`id`),
+    INDEX `idx_notification_channels_deleted_at` (`deleted_at`),
+    INDEX `idx_notification_channels_user_id` (`user_id`)
+);
+
+CREATE TABLE `notification_rules` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `user_id` varchar(255) NOT NULL,
+    `name` varchar(100) NOT NULL,
+    `channel_id` bigint unsigned NOT NULL,
+    `triggers` JSON,
+    `url_pattern` varchar(2048),
+    `subject_template` varchar(512),
+    `body_template` text,
+    `active` boolean DEFAULT true,
+    PRIMARY KEY (`id`),
+    INDEX `idx_notification_rules_deleted_at` (`deleted_at`),
+    INDEX `idx_notification_rules_user_id` (`user_id`),
+    INDEX `idx_notification_rules_channel_id` (`channel_id`)
+);
+
+CREATE TABLE `api_tokens` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `user_id` varchar(255) NOT NULL,
+    `name` varchar(100) NOT NULL,
+    `prefix` varchar(16),
+    `token_hash` varchar(64) NOT NULL,
+    `last_used_at` datetime(3) NULL,
+    `expires_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_api_tokens_deleted_at` (`deleted_at`),
+    INDEX `idx_api_tokens_user_id` (`user_id`),
+    UNIQUE INDEX `idx_api_tokens_token_hash` (`token_hash`)
+);
@@ -0,0 +1,5 @@
+-- Fails while several users have an analysis of the same URL, delete all but one of them first.
+
+ALTER TABLE `url_analyses`
+    DROP INDEX `idx_url_analyses_user_url`,
+    ADD CONSTRAINT `uni_url_analyses_url` UNIQUE (`url`);
@@ -0,0 +1,5 @@
+-- Every user has analyses of their own, the same URL may be submitted by several users.
+
+ALTER TABLE `url_analyses`
+    DROP INDEX `uni_url_analyses_url`,
+    ADD UNIQUE INDEX `idx_url_analyses_user_url` (`user_id`, `url`);
@@ -0,0 +1,4 @@
+ALTER TABLE `url_analyses`
+    DROP INDEX `idx_url_analyses_lease_expires_at`,
+    DROP COLUMN `lease_expires_at`,
+    DROP COLUMN `lease_owner`;
@@ -0,0 +1,7 @@
+-- Running analyses are leased by the server process crawling them, so that a starting replica only
+-- re-queues the analyses of processes that are gone.
+
+ALTER TABLE `url_analyses`
+    ADD COLUMN `lease_owner` varchar(64),
+    ADD COLUMN `lease_expires_at` datetime(3) NULL,
+    ADD INDEX `idx_url_analyses_lease_expires_at` (`lease_expires_at`);
@@ -0,0 +1,5 @@
+ALTER TABLE `notification_channels`
+    DROP INDEX `idx_notification_channels_confirmation_token_hash`,
+    DROP COLUMN `confirmation_sent_at`,
+    DROP COLUMN `confirmation_token_hash`,
+    DROP COLUMN `confirmed_at`;
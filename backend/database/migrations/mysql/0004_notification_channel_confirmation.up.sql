@@ -0,0 +1,8 @@
+-- Email notification channels are confirmed by their recipient before anything is sent to them. Email
+-- channels created before stay unconfirmed until their owner sends the confirmation email again.
+
+ALTER TABLE `notification_channels`
+    ADD COLUMN `confirmed_at` datetime(3) NULL,
+    ADD COLUMN `confirmation_token_hash` varchar(64),
+    ADD COLUMN `confirmation_sent_at` datetime(3) NULL,
+    ADD INDEX `idx_notification_channels_confirmation_token_hash` (`confirmation_token_hash`);
@@ -0,0 +1,202 @@
+-- The schema AutoMigrate created before versioned migrations. Databases created by it are marked as
+-- migrated to this version with "migrate baseline".
+
+CREATE TABLE "url_analyses" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "url" varchar(255) NOT NULL,
+    "status" varchar(20) DEFAULT 'queued',
+    "lane" varchar(20) DEFAULT 'interactive',
+    "user_id" varchar(255),
+    "crawl_profile_id" bigint,
+    "html_version" varchar(50),
+    "page_title" varchar(512),
+    "h1_count" bigint DEFAULT 0,
+    "h2_count" bigint DEFAULT 0,
+    "h3_count" bigint DEFAULT 0,
+    "h4_count" bigint DEFAULT 0,
+    "h5_count" bigint DEFAULT 0,
+    "h6_count" bigint DEFAULT 0,
+    "internal_link_count" bigint DEFAULT 0,
+    "external_link_count" bigint DEFAULT 0,
+    "inaccessible_link_count" bigint DEFAULT 0,
+    "broken_links" JSONB,
+    "has_login_form" boolean DEFAULT false,
+    "login_detection" JSONB,
+    "frames" JSONB,
+    "checked_link_count" bigint DEFAULT 0,
+    "partial_reasons" JSONB,
+    "attempts" bigint DEFAULT 0,
+    "last_error" text,
+    "next_retry_at" timestamptz,
+    "attempt_history" JSONB,
+    "error_category" varchar(50),
+    "response" JSONB,
+    "security" JSONB,
+    "word_count" bigint DEFAULT 0,
+    "content" JSONB,
+    "main_content" BYTEA,
+    "snapshot_id" bigint,
+    "reprocessed_at" timestamptz,
+    "content_hash" varchar(64),
+    "structure_hash" varchar(64),
+    "content_changed_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "uni_url_analyses_url" UNIQUE ("url")
+);
+CREATE INDEX "idx_url_analyses_crawl_profile_id" ON "url_analyses" ("crawl_profile_id");
+CREATE INDEX "idx_url_analyses_user_id" ON "url_analyses" ("user_id");
+CREATE INDEX "idx_url_analyses_deleted_at" ON "url_analyses" ("deleted_at");
+
+CREATE TABLE "crawl_profiles" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "user_id" varchar(255) NOT NULL,
+    "name" varchar(100) NOT NULL,
+    "site" varchar(255),
+    "user_agent" varchar(512),
+    "accept_language" varchar(100),
+    "extra_headers" JSONB,
+    "use_proxy_pool" boolean DEFAULT false,
+    "credentials" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_crawl_profiles_site" ON "crawl_profiles" ("site");
+CREATE INDEX "idx_crawl_profiles_user_id" ON "crawl_profiles" ("user_id");
+CREATE INDEX "idx_crawl_profiles_deleted_at" ON "crawl_profiles" ("deleted_at");
+
+CREATE TABLE "crawl_log_entries" (
+    "id" bigserial,
+    "url_analysis_id" bigint NOT NULL,
+    "request_id" varchar(128),
+    "level" varchar(10),
+    "message" text,
+    "fields" JSONB,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_crawl_log_entries_url_analysis_id" ON "crawl_log_entries" ("url_analysis_id");
+
+CREATE TABLE "snapshots" (
+    "id" bigserial,
+    "url_analysis_id" bigint NOT NULL,
+    "attempt" bigint,
+    "url" text,
+    "blob_key" varchar(512) NOT NULL,
+    "size" bigint,
+    "records" bigint,
+    "resources" bigint,
+    "truncated" boolean,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_snapshots_url_analysis_id" ON "snapshots" ("url_analysis_id");
+
+CREATE TABLE "content_versions" (
+    "id" bigserial,
+    "url_analysis_id" bigint NOT NULL,
+    "attempt" bigint,
+    "text_hash" varchar(64),
+    "structure_hash" varchar(64),
+    "text" BYTEA,
+    "headings" JSONB,
+    "links" JSONB,
+    "diff" JSONB,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_content_versions_url_analysis_id" ON "content_versions" ("url_analysis_id");
+
+CREATE TABLE "webhooks" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "user_id" varchar(255) NOT NULL,
+    "url" varchar(2048) NOT NULL,
+    "events" JSONB,
+    "active" boolean DEFAULT true,
+    "secret" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_webhooks_user_id" ON "webhooks" ("user_id");
+CREATE INDEX "idx_webhooks_deleted_at" ON "webhooks" ("deleted_at");
+
+CREATE TABLE "webhook_deliveries" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "webhook_id" bigint NOT NULL,
+    "user_id" varchar(255) NOT NULL,
+    "event_id" varchar(36),
+    "event_type" varchar(50),
+    "analysis_id" bigint,
+    "payload" text,
+    "status" varchar(20),
+    "attempts" bigint DEFAULT 0,
+    "next_attempt_at" timestamptz,
+    "delivered_at" timestamptz,
+    "attempt_log" JSONB,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_webhook_deliveries_status" ON "webhook_deliveries" ("status");
+CREATE INDEX "idx_webhook_deliveries_analysis_id" ON "webhook_deliveries" ("analysis_id");
+CREATE INDEX "idx_webhook_deliveries_event_id" ON "webhook_deliveries" ("event_id");
+CREATE INDEX "idx_webhook_deliveries_user_id" ON "webhook_deliveries" ("user_id");
+CREATE INDEX "idx_webhook_deliveries_webhook_id" ON "webhook_deliveries" ("webhook_id");
+
+CREATE TABLE "notification_channels" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "user_id" varchar(255) NOT NULL,
+    "name" varchar(100) NOT NULL,
+    "type" varchar(20) NOT NULL,
+    "target" text,
+    "last_sent_at" timestamptz,
+    "last_error" varchar(1024),
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_notification_channels_user_id" ON "notification_channels" ("user_id");
+CREATE INDEX "idx_notification_channels_deleted_at" ON "notification_channels" ("deleted_at");
+
+CREATE TABLE "notification_rules" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "user_id" varchar(255) NOT NULL,
+    "name" varchar(100) NOT NULL,
+    "channel_id" bigint NOT NULL,
+    "triggers" JSONB,
+    "url_pattern" varchar(2048),
+    "subject_template" varchar(512),
+    "body_template" text,
+    "active" boolean DEFAULT true,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_notification_rules_channel_id" ON "notification_rules" ("channel_id");
+CREATE INDEX "idx_notification_rules_user_id" ON "notification_rules" ("user_id");
+CREATE INDEX "idx_notification_rules_deleted_at" ON "notification_rules" ("deleted_at");
+
+CREATE TABLE "api_tokens" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "user_id" varchar(255) NOT NULL,
+    "name" varchar(100) NOT NULL,
+    "prefix" varchar(16),
+    "token_hash" varchar(64) NOT NULL,
+    "last_used_at" timestamptz,
+    "expires_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_api_tokens_token_hash" ON "api_tokens" ("token_hash");
+CREATE INDEX "idx_api_tokens_user_id" ON "api_tokens" ("user_id");
+CREATE INDEX "idx_api_tokens_deleted_at" ON "api_tokens" ("deleted_at");
@@ -0,0 +1,4 @@
+-- Fails while several users have an analysis of the same URL, delete all but one of them first.
+
+DROP INDEX "idx_url_analyses_user_url";
+ALTER TABLE "url_analyses" ADD CONSTRAINT "uni_url_analyses_url" UNIQUE ("url");
@@ -0,0 +1,4 @@
+-- Every user has analyses of their own, the same URL may be submitted by several users.
+
+ALTER TABLE "url_analyses" DROP CONSTRAINT "uni_url_analyses_url";
+CREATE UNIQUE INDEX "idx_url_analyses_user_url" ON "url_analyses" ("user_id","url");
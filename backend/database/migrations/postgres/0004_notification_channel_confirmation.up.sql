@@ -0,0 +1,7 @@
+-- Email notification channels are confirmed by their recipient before anything is sent to them. Email
+-- channels created before stay unconfirmed until their owner sends the confirmation email again.
+
+ALTER TABLE "notification_channels" ADD COLUMN "confirmed_at" timestamptz;
+ALTER TABLE "notification_channels" ADD COLUMN "confirmation_token_hash" varchar(64);
+ALTER TABLE "notification_channels" ADD COLUMN "confirmation_sent_at" timestamptz;
+CREATE INDEX "idx_notification_channels_confirmation_token_hash" ON "notification_channels" ("confirmation_token_hash");
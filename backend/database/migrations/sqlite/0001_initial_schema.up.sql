@@ -0,0 +1,192 @@
+-- The schema AutoMigrate created before versioned migrations. Databases created by it are marked as
+-- migrated to this version with "migrate baseline".
+
+CREATE TABLE `url_analyses` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `url` text NOT NULL,
+    `status` text DEFAULT 'queued',
+    `lane` text DEFAULT 'interactive',
+    `user_id` text,
+    `crawl_profile_id` integer,
+    `html_version` text,
+    `page_title` varchar(512),
+    `h1_count` integer DEFAULT 0,
+    `h2_count` integer DEFAULT 0,
+    `h3_count` integer DEFAULT 0,
+    `h4_count` integer DEFAULT 0,
+    `h5_count` integer DEFAULT 0,
+    `h6_count` integer DEFAULT 0,
+    `internal_link_count` integer DEFAULT 0,
+    `external_link_count` integer DEFAULT 0,
+    `inaccessible_link_count` integer DEFAULT 0,
+    `broken_links` JSON,
+    `has_login_form` numeric DEFAULT false,
+    `login_detection` JSON,
+    `frames` JSON,
+    `checked_link_count` integer DEFAULT 0,
+    `partial_reasons` JSON,
+    `attempts` integer DEFAULT 0,
+    `last_error` text,
+    `next_retry_at` datetime,
+    `attempt_history` JSON,
+    `error_category` text,
+    `response` JSON,
+    `security` JSON,
+    `word_count` integer DEFAULT 0,
+    `content` JSON,
+    `main_content` BLOB,
+    `snapshot_id` integer,
+    `reprocessed_at` datetime,
+    `content_hash` text,
+    `structure_hash` text,
+    `content_changed_at` datetime,
+    CONSTRAINT `uni_url_analyses_url` UNIQUE (`url`)
+);
+CREATE INDEX `idx_url_analyses_crawl_profile_id` ON `url_analyses` (`crawl_profile_id`);
+CREATE INDEX `idx_url_analyses_user_id` ON `url_analyses` (`user_id`);
+CREATE INDEX `idx_url_analyses_deleted_at` ON `url_analyses` (`deleted_at`);
+
+CREATE TABLE `crawl_profiles` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `user_id` text NOT NULL,
+    `name` text NOT NULL,
+    `site` text,
+    `user_agent` text,
+    `accept_language` text,
+    `extra_headers` JSON,
+    `use_proxy_pool` numeric DEFAULT false,
+    `credentials` text
+);
+CREATE INDEX `idx_crawl_profiles_site` ON `crawl_profiles` (`site`);
+CREATE INDEX `idx_crawl_profiles_user_id` ON `crawl_profiles` (`user_id`);
+CREATE INDEX `idx_crawl_profiles_deleted_at` ON `crawl_profiles` (`deleted_at`);
+
+CREATE TABLE `crawl_log_entries` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `url_analysis_id` integer NOT NULL,
+    `request_id` text,
+    `level` text,
+    `message` text,
+    `fields` JSON,
+    `created_at` datetime
+);
+CREATE INDEX `idx_crawl_log_entries_url_analysis_id` ON `crawl_log_entries` (`url_analysis_id`);
+
+CREATE TABLE `snapshots` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `url_analysis_id` integer NOT NULL,
+    `attempt` integer,
+    `url` text,
+    `blob_key` text NOT NULL,
+    `size` integer,
+    `records` integer,
+    `resources` integer,
+    `truncated` numeric,
+    `created_at` datetime
+);
+CREATE INDEX `idx_snapshots_url_analysis_id` ON `snapshots` (`url_analysis_id`);
+
+CREATE TABLE `content_versions` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `url_analysis_id` integer NOT NULL,
+    `attempt` integer,
+    `text_hash` text,
+    `structure_hash` text,
+    `text` BLOB,
+    `headings` JSON,
+    `links` JSON,
+    `diff` JSON,
+    `created_at` datetime
+);
+CREATE INDEX `idx_content_versions_url_analysis_id` ON `content_versions` (`url_analysis_id`);
+
+CREATE TABLE `webhooks` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `user_id` text NOT NULL,
+    `url` text NOT NULL,
+    `events` JSON,
+    `active` numeric DEFAULT true,
+    `secret` text
+);
+CREATE INDEX `idx_webhooks_user_id` ON `webhooks` (`user_id`);
+CREATE INDEX `idx_webhooks_deleted_at` ON `webhooks` (`deleted_at`);
+
+CREATE TABLE `webhook_deliveries` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `webhook_id` integer NOT NULL,
+    `user_id` text NOT NULL,
+    `event_id` text,
+    `event_type` text,
+    `analysis_id` integer,
+    `payload` text,
+    `status` text,
+    `attempts` integer DEFAULT 0,
+    `next_attempt_at` datetime,
+    `delivered_at` datetime,
+    `attempt_log` JSON
+);
+CREATE INDEX `idx_webhook_deliveries_status` ON `webhook_deliveries` (`status`);
+CREATE INDEX `idx_webhook_deliveries_analysis_id` ON `webhook_deliveries` (`analysis_id`);
+CREATE INDEX `idx_webhook_deliveries_event_id` ON `webhook_deliveries` (`event_id`);
+CREATE INDEX `idx_webhook_deliveries_user_id` ON `webhook_deliveries` (`user_id`);
+CREATE INDEX `idx_webhook_deliveries_webhook_id` ON `webhook_deliveries` (`webhook_id`);
+
+CREATE TABLE `notification_channels` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `user_id` text NOT NULL,
+    `name` text NOT NULL,
+    `type` text NOT NULL,
+    `target` text,
+    `last_sent_at` datetime,
+    `last_error` text
+);
+CREATE INDEX `idx_notification_channels_user_id` ON `notification_channels` (`user_id`);
+CREATE INDEX `idx_notification_channels_deleted_at` ON `notification_channels` (`deleted_at`);
+
+CREATE TABLE `notification_rules` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `user_id` text NOT NULL,
+    `name` text NOT NULL,
+    `channel_id` integer NOT NULL,
+    `triggers` JSON,
+    `url_pattern` text,
+    `subject_template` text,
+    `body_template` text,
+    `active` numeric DEFAULT true
+);
+CREATE INDEX `idx_notification_rules_channel_id` ON `notification_rules` (`channel_id`);
+CREATE INDEX `idx_notification_rules_user_id` ON `notification_rules` (`user_id`);
+CREATE INDEX `idx_notification_rules_deleted_at` ON `notification_rules` (`deleted_at`);
+
+CREATE TABLE `api_tokens` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `user_id` text NOT NULL,
+    `name` text NOT NULL,
+    `prefix` text,
+    `token_hash` text NOT NULL,
+    `last_used_at` datetime,
+    `expires_at` datetime
+);
+CREATE UNIQUE INDEX `idx_api_tokens_token_hash` ON `api_tokens` (`token_hash`);
+CREATE INDEX `idx_api_tokens_user_id` ON `api_tokens` (`user_id`);
+CREATE INDEX `idx_api_tokens_deleted_at` ON `api_tokens` (`deleted_at`);
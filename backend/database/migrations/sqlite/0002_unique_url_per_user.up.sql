@@ -0,0 +1,53 @@
+-- Every user has analyses of their own, the same URL may be submitted by several users.
+-- SQLite can't drop a constraint, the table is copied to a new one without it.
+
+CREATE TABLE `url_analyses_new` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `url` text NOT NULL,
+    `status` text DEFAULT 'queued',
+    `lane` text DEFAULT 'interactive',
+    `user_id` text,
+    `crawl_profile_id` integer,
+    `html_version` text,
+    `page_title` varchar(512),
+    `h1_count` integer DEFAULT 0,
+    `h2_count` integer DEFAULT 0,
+    `h3_count` integer DEFAULT 0,
+    `h4_count` integer DEFAULT 0,
+    `h5_count` integer DEFAULT 0,
+    `h6_count` integer DEFAULT 0,
+    `internal_link_count` integer DEFAULT 0,
+    `external_link_count` integer DEFAULT 0,
+    `inaccessible_link_count` integer DEFAULT 0,
+    `broken_links` JSON,
+    `has_login_form` numeric DEFAULT false,
+    `login_detection` JSON,
+    `frames` JSON,
+    `checked_link_count` integer DEFAULT 0,
+    `partial_reasons` JSON,
+    `attempts` integer DEFAULT 0,
+    `last_error` text,
+    `next_retry_at` datetime,
+    `attempt_history` JSON,
+    `error_category` text,
+    `response` JSON,
+    `security` JSON,
+    `word_count` integer DEFAULT 0,
+    `content` JSON,
+    `main_content` BLOB,
+    `snapshot_id` integer,
+    `reprocessed_at` datetime,
+    `content_hash` text,
+    `structure_hash` text,
+    `content_changed_at` datetime
+);
+INSERT INTO `url_analyses_new` SELECT * FROM `url_analyses`;
+DROP TABLE `url_analyses`;
+ALTER TABLE `url_analyses_new` RENAME TO `url_analyses`;
+CREATE INDEX `idx_url_analyses_crawl_profile_id` ON `url_analyses` (`crawl_profile_id`);
+CREATE INDEX `idx_url_analyses_user_id` ON `url_analyses` (`user_id`);
+CREATE INDEX `idx_url_analyses_deleted_at` ON `url_analyses` (`deleted_at`);
+CREATE UNIQUE INDEX `idx_url_analyses_user_url` ON `url_analyses` (`user_id`,`url`);
@@ -0,0 +1,3 @@
+DROP INDEX `idx_url_analyses_lease_expires_at`;
+ALTER TABLE `url_analyses` DROP COLUMN `lease_expires_at`;
+ALTER TABLE `url_analyses` DROP COLUMN `lease_owner`;
@@ -0,0 +1,6 @@
+-- Running analyses are leased by the server process crawling them, so that a starting replica only
+-- re-queues the analyses of processes that are gone.
+
+ALTER TABLE `url_analyses` ADD COLUMN `lease_owner` text;
+ALTER TABLE `url_analyses` ADD COLUMN `lease_expires_at` datetime;
+CREATE INDEX `idx_url_analyses_lease_expires_at` ON `url_analyses` (`lease_expires_at`);
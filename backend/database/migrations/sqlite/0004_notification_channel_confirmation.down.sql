@@ -0,0 +1,4 @@
+DROP INDEX `idx_notification_channels_confirmation_token_hash`;
+ALTER TABLE `notification_channels` DROP COLUMN `confirmation_sent_at`;
+ALTER TABLE `notification_channels` DROP COLUMN `confirmation_token_hash`;
+ALTER TABLE `notification_channels` DROP COLUMN `confirmed_at`;
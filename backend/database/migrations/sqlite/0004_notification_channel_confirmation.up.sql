@@ -0,0 +1,7 @@
+-- Email notification channels are confirmed by their recipient before anything is sent to them. Email
+-- channels created before stay unconfirmed until their owner sends the confirmation email again.
+
+ALTER TABLE `notification_channels` ADD COLUMN `confirmed_at` datetime;
+ALTER TABLE `notification_channels` ADD COLUMN `confirmation_token_hash` text;
+ALTER TABLE `notification_channels` ADD COLUMN `confirmation_sent_at` datetime;
+CREATE INDEX `idx_notification_channels_confirmation_token_hash` ON `notification_channels` (`confirmation_token_hash`);
@@ -0,0 +1,227 @@
+// Package gate checks analyses against quality thresholds, to fail a deploy pipeline on a site with broken
+// links or pages without a title. Reports are written as JUnit XML and SARIF for CI systems.
+package gate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	netURL "net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"web-scraper/analyser"
+)
+
+// rules of the gate, the ids of SARIF results and the names of JUnit test cases
+const (
+	RuleCrawlFailed  = "crawl-failed"
+	RuleIncomplete   = "incomplete"
+	RuleBrokenLinks  = "broken-links"
+	RuleMissingTitle = "missing-title"
+	RuleMissingH1    = "missing-h1"
+	RuleHTMLVersion  = "html-version"
+)
+
+// Rules are all rules with their description, in the order pages are checked
+var Rules = []struct{ ID, Description string }{
+	{RuleCrawlFailed, "The page could be fetched and analysed"},
+	{RuleIncomplete, "The analysis finished within its budgets"},
+	{RuleBrokenLinks, "The page has no more broken links than allowed"},
+	{RuleMissingTitle, "The page has a title"},
+	{RuleMissingH1, "The page has an h1 heading"},
+	{RuleHTMLVersion, "The page uses an allowed HTML version"},
+}
+
+// Thresholds are what a page has to meet to pass
+type Thresholds struct {
+	// MaxBrokenLinks is how many broken links a page may have, negative allows any number
+	MaxBrokenLinks int
+	RequireTitle   bool
+	RequireH1      bool
+	// HTMLVersions are the versions pages may use, e.g. "HTML5". Empty allows any.
+	HTMLVersions []string
+	// AllowPartial passes pages whose analysis ran out of budget when the rest of their checks pass
+	AllowPartial bool
+}
+
+// Violation is a threshold a page missed
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	// Target is what the violation is about, the broken link or the page itself
+	Target string `json:"target"`
+}
+
+// PageReport is the analysis of a page with the thresholds it missed
+type PageReport struct {
+	URL        string
+	Result     *analyser.Result
+	Violations []Violation
+	Duration   time.Duration
+}
+
+// Checked reports whether rule was evaluated for the page, the checks of a page that couldn't be analysed are skipped
+func (p PageReport) Checked(rule string, thresholds Thresholds) bool {
+	if rule == RuleCrawlFailed {
+		return true
+	}
+	if p.Result.Err != nil {
+		return false
+	}
+	switch rule {
+	case RuleIncomplete:
+		return !thresholds.AllowPartial
+	case RuleBrokenLinks:
+		return thresholds.MaxBrokenLinks >= 0
+	case RuleMissingTitle:
+		return thresholds.RequireTitle
+	case RuleMissingH1:
+		return thresholds.RequireH1
+	case RuleHTMLVersion:
+		return len(thresholds.HTMLVersions) > 0
+	}
+	return false
+}
+
+// Report is the outcome of a gate run
+type Report struct {
+	Thresholds Thresholds
+	Pages      []PageReport
+	StartedAt  time.Time
+	Duration   time.Duration
+}
+
+// Violations is the number of violations of all pages
+func (r Report) Violations() int {
+	var count int
+	for _, page := range r.Pages {
+		count += len(page.Violations)
+	}
+	return count
+}
+
+// Passed reports whether every page met the thresholds
+func (r Report) Passed() bool {
+	return r.Violations() == 0
+}
+
+// Evaluate returns the thresholds result misses
+func Evaluate(result *analyser.Result, thresholds Thresholds) []Violation {
+	page := result.URL
+	if result.Err != nil {
+		return []Violation{{Rule: RuleCrawlFailed, Target: page, Message: fmt.Sprintf("analysis failed (%s): %v", result.ErrorCategory, result.Err)}}
+	}
+
+	var violations []Violation
+	if result.Status == "partial" && !thresholds.AllowPartial {
+		violations = append(violations, Violation{Rule: RuleIncomplete, Target: page, Message: "analysis incomplete: " + strings.Join(result.PartialReasons, "; ")})
+	}
+	if thresholds.MaxBrokenLinks >= 0 && len(result.BrokenLinks) > thresholds.MaxBrokenLinks {
+		// every broken link is reported, CI annotations then point at each of them
+		for _, link := range result.BrokenLinks {
+			reason := link.ErrorMessage
+			if link.StatusCode != 0 {
+				reason = fmt.Sprintf("%d %s", link.StatusCode, http.StatusText(link.StatusCode))
+			}
+			message := fmt.Sprintf("broken link %s (%s), %d of at most %d", link.URL, reason, len(result.BrokenLinks), thresholds.MaxBrokenLinks)
+			if link.Frame != "" {
+				message += ", found in iframe " + link.Frame
+			}
+			violations = append(violations, Violation{Rule: RuleBrokenLinks, Target: link.URL, Message: message})
+		}
+	}
+	if thresholds.RequireTitle && strings.TrimSpace(result.Title) == "" {
+		violations = append(violations, Violation{Rule: RuleMissingTitle, Target: page, Message: "the page has no title"})
+	}
+	if thresholds.RequireH1 && result.Headings[0] == 0 {
+		violations = append(violations, Violation{Rule: RuleMissingH1, Target: page, Message: "the page has no h1 heading"})
+	}
+	if len(thresholds.HTMLVersions) > 0 && !slices.ContainsFunc(thresholds.HTMLVersions, func(version string) bool {
+		return strings.EqualFold(version, result.HTMLVersion)
+	}) {
+		violations = append(violations, Violation{Rule: RuleHTMLVersion, Target: page,
+			Message: fmt.Sprintf("the page uses %s, allowed are %s", result.HTMLVersion, strings.Join(thresholds.HTMLVersions, ", "))})
+	}
+	return violations
+}
+
+// Options configure a gate run
+type Options struct {
+	Thresholds Thresholds
+	Analyser   analyser.Options
+	// Crawl also checks the pages the start URLs link to on their host, breadth first up to MaxPages pages
+	Crawl    bool
+	MaxPages int
+	// OnPage is called with the report of every page once it is checked, optional
+	OnPage func(PageReport)
+}
+
+// links with these extensions aren't followed by a crawl, they aren't pages
+var skippedExtensions = []string{".pdf", ".zip", ".gz", ".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".ico",
+	".css", ".js", ".json", ".xml", ".txt", ".mp3", ".mp4", ".webm", ".woff", ".woff2"}
+
+// Run analyses urls one after the other and checks them against the thresholds. Cancelling ctx stops it,
+// the pages checked so far are reported with the cause of the cancellation.
+func Run(ctx context.Context, urls []string, opts Options) (Report, error) {
+	report := Report{Thresholds: opts.Thresholds, StartedAt: time.Now()}
+
+	queue := slices.Clone(urls)
+	seen := map[string]bool{}
+	for _, u := range urls {
+		seen[u] = true
+	}
+	// hosts a crawl stays on, those of the start URLs
+	hosts := map[string]bool{}
+	for _, u := range urls {
+		if parsed, err := netURL.Parse(u); err == nil {
+			hosts[parsed.Host] = true
+		}
+	}
+
+	for len(queue) > 0 {
+		if opts.Crawl && opts.MaxPages > 0 && len(report.Pages) >= opts.MaxPages {
+			break
+		}
+		pageURL := queue[0]
+		queue = queue[1:]
+
+		startedAt := time.Now()
+		result, err := analyser.Analyse(ctx, pageURL, opts.Analyser)
+		if ctx.Err() != nil {
+			report.Duration = time.Since(report.StartedAt)
+			return report, err
+		}
+		page := PageReport{URL: pageURL, Result: result, Violations: Evaluate(result, opts.Thresholds), Duration: time.Since(startedAt)}
+		report.Pages = append(report.Pages, page)
+		if opts.OnPage != nil {
+			opts.OnPage(page)
+		}
+		report.Duration = time.Since(report.StartedAt)
+
+		if !opts.Crawl || result.Err != nil {
+			continue
+		}
+		for _, link := range analyser.UniqueLinks(result.Links) {
+			if next, ok := crawlTarget(link, hosts); ok && !seen[next] {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return report, nil
+}
+
+// crawlTarget returns the page link points to when a crawl follows it: http(s) on one of hosts, not a file
+func crawlTarget(link string, hosts map[string]bool) (string, bool) {
+	u, err := netURL.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !hosts[u.Host] {
+		return "", false
+	}
+	if slices.Contains(skippedExtensions, strings.ToLower(path.Ext(u.Path))) {
+		return "", false
+	}
+	u.Fragment = ""
+	return u.String(), true
+}
@@ -0,0 +1,231 @@
+package gate
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+	"web-scraper/analyser"
+	"web-scraper/models"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// testReport is a gate run over a passing page, a page missing several thresholds and one that couldn't be analysed
+func testReport() Report {
+	thresholds := Thresholds{MaxBrokenLinks: 1, RequireTitle: true, RequireH1: true, HTMLVersions: []string{"HTML5"}}
+	results := []*analyser.Result{
+		{
+			URL: "https://example.com/", Status: "done", StatusCode: 200,
+			HTMLVersion: "HTML5", Title: "Home", Headings: [6]int{1, 2},
+			BrokenLinks: []models.BrokenLink{{URL: "https://example.com/old", StatusCode: 404}},
+		},
+		{
+			URL: "https://example.com/shop?page=2&sort=price", Status: "partial", StatusCode: 200,
+			PartialReasons: []string{"link limit reached, the first 2 of 4 links were checked"},
+			HTMLVersion:    "HTML4.01",
+			BrokenLinks: []models.BrokenLink{
+				{URL: "https://example.com/cart", StatusCode: 500},
+				{URL: "https://cdn.example.net/widget", ErrorMessage: "dial tcp: connection refused", Frame: "https://example.com/frame"},
+			},
+		},
+		{
+			URL: "https://example.com/gone", Status: "errored", StatusCode: 404,
+			Err: errors.New("HTTP Error 404 - Not Found"), ErrorCategory: analyser.ErrorCategoryHTTPClient,
+		},
+	}
+
+	report := Report{
+		Thresholds: thresholds,
+		StartedAt:  time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC),
+		Duration:   3500 * time.Millisecond,
+	}
+	for i, result := range results {
+		report.Pages = append(report.Pages, PageReport{
+			URL:        result.URL,
+			Result:     result,
+			Violations: Evaluate(result, thresholds),
+			Duration:   time.Duration(i+1) * 250 * time.Millisecond,
+		})
+	}
+	return report
+}
+
+// checkGolden compares got with testdata/name, go test -update rewrites it
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run go test ./gate -update to create it", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file, run go test ./gate -update if the change is intended\ngot:\n%s", name, got)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	report := testReport()
+
+	if got := report.Pages[0].Violations; len(got) != 0 {
+		t.Errorf("violations of the passing page: %+v", got)
+	}
+
+	var rules []string
+	for _, violation := range report.Pages[1].Violations {
+		rules = append(rules, violation.Rule)
+	}
+	want := []string{RuleIncomplete, RuleBrokenLinks, RuleBrokenLinks, RuleMissingTitle, RuleMissingH1, RuleHTMLVersion}
+	if !slices.Equal(rules, want) {
+		t.Errorf("violations %v, want %v", rules, want)
+	}
+	if target := report.Pages[1].Violations[2].Target; target != "https://cdn.example.net/widget" {
+		t.Errorf("broken link violation targets %s, want the link", target)
+	}
+
+	if got := report.Pages[2].Violations; len(got) != 1 || got[0].Rule != RuleCrawlFailed {
+		t.Errorf("violations of the failed page: %+v, want only %s", got, RuleCrawlFailed)
+	}
+
+	if report.Violations() != 7 || report.Passed() {
+		t.Errorf("%d violations, passed %v, want 7 and failed", report.Violations(), report.Passed())
+	}
+	passing := Report{Pages: report.Pages[:1]}
+	if !passing.Passed() {
+		t.Error("report of the passing page failed")
+	}
+}
+
+func TestEvaluateThresholds(t *testing.T) {
+	result := &analyser.Result{
+		URL: "https://example.com/", Status: "partial", HTMLVersion: "html5",
+		BrokenLinks: []models.BrokenLink{{URL: "https://example.com/a", StatusCode: 404}, {URL: "https://example.com/b", StatusCode: 404}},
+	}
+
+	tests := []struct {
+		name       string
+		thresholds Thresholds
+		want       int
+	}{
+		{"broken links within the limit", Thresholds{MaxBrokenLinks: 2, AllowPartial: true}, 0},
+		{"one broken link too many", Thresholds{MaxBrokenLinks: 1, AllowPartial: true}, 2},
+		{"any number of broken links", Thresholds{MaxBrokenLinks: -1, AllowPartial: true}, 0},
+		{"partial analysis", Thresholds{MaxBrokenLinks: -1}, 1},
+		{"HTML version matched without case", Thresholds{MaxBrokenLinks: -1, AllowPartial: true, HTMLVersions: []string{"HTML5"}}, 0},
+		{"title and h1", Thresholds{MaxBrokenLinks: -1, AllowPartial: true, RequireTitle: true, RequireH1: true}, 2},
+	}
+	for _, tt := range tests {
+		if got := Evaluate(result, tt.thresholds); len(got) != tt.want {
+			t.Errorf("%s: %d violations %+v, want %d", tt.name, len(got), got, tt.want)
+		}
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	report := testReport()
+	var out bytes.Buffer
+	if err := WriteJUnit(&out, report); err != nil {
+		t.Fatalf("WriteJUnit: %v", err)
+	}
+	checkGolden(t, "report.junit.xml", out.Bytes())
+
+	// the counts of every suite add up to those of its test cases, CI systems rely on them
+	var suites junitTestSuites
+	if err := xml.Unmarshal(out.Bytes(), &suites); err != nil {
+		t.Fatalf("invalid XML: %v", err)
+	}
+	if len(suites.Suites) != len(report.Pages) {
+		t.Fatalf("%d test suites, want one per page", len(suites.Suites))
+	}
+	var tests, failures, skipped int
+	for i, suite := range suites.Suites {
+		if suite.Name != report.Pages[i].URL || len(suite.Cases) != len(Rules) || suite.Tests != len(Rules) {
+			t.Errorf("suite %q with %d cases, want %s with one per rule", suite.Name, len(suite.Cases), report.Pages[i].URL)
+		}
+		var caseFailures, caseSkipped int
+		for j, testCase := range suite.Cases {
+			if testCase.Name != Rules[j].ID {
+				t.Errorf("case %d of %s is %s, want %s", j, suite.Name, testCase.Name, Rules[j].ID)
+			}
+			if testCase.Failure != nil && testCase.Skipped != nil {
+				t.Errorf("case %s of %s failed and was skipped", testCase.Name, suite.Name)
+			}
+			if testCase.Failure != nil {
+				caseFailures++
+			}
+			if testCase.Skipped != nil {
+				caseSkipped++
+			}
+		}
+		if suite.Failures != caseFailures || suite.Skipped != caseSkipped {
+			t.Errorf("suite %s counts %d failures and %d skipped, its cases %d and %d", suite.Name, suite.Failures, suite.Skipped, caseFailures, caseSkipped)
+		}
+		tests, failures, skipped = tests+suite.Tests, failures+suite.Failures, skipped+suite.Skipped
+	}
+	if suites.Tests != tests || suites.Failures != failures || suites.Skipped != skipped {
+		t.Errorf("testsuites counts %d/%d/%d, the suites %d/%d/%d", suites.Tests, suites.Failures, suites.Skipped, tests, failures, skipped)
+	}
+	// the failed page fails its crawl case only, the other checks couldn't run
+	if failed := suites.Suites[2]; failed.Failures != 1 || failed.Skipped != len(Rules)-1 {
+		t.Errorf("failed page has %d failures and %d skipped, want 1 and %d", failed.Failures, failed.Skipped, len(Rules)-1)
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	report := testReport()
+	var out bytes.Buffer
+	if err := WriteSARIF(&out, report); err != nil {
+		t.Fatalf("WriteSARIF: %v", err)
+	}
+	checkGolden(t, "report.sarif.json", out.Bytes())
+
+	var log sarifLog
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if log.Version != "2.1.0" || log.Schema != sarifSchema || len(log.Runs) != 1 {
+		t.Fatalf("SARIF %s with schema %s and %d runs, want 2.1.0 with a single run", log.Version, log.Schema, len(log.Runs))
+	}
+	run := log.Runs[0]
+	ruleIDs := map[string]bool{}
+	for _, rule := range run.Tool.Driver.Rules {
+		ruleIDs[rule.ID] = true
+	}
+	if len(ruleIDs) != len(Rules) {
+		t.Errorf("%d rules in the driver, want %d", len(ruleIDs), len(Rules))
+	}
+	if len(run.Results) != report.Violations() {
+		t.Errorf("%d results, want one per violation (%d)", len(run.Results), report.Violations())
+	}
+	for _, result := range run.Results {
+		if !ruleIDs[result.RuleID] || result.Level != "error" || result.Message.Text == "" ||
+			len(result.Locations) != 1 || result.Locations[0].PhysicalLocation.ArtifactLocation.URI == "" {
+			t.Errorf("result %+v, want an error of a known rule located at its page", result)
+		}
+	}
+
+	// a passing run has an empty list of results, not null
+	out.Reset()
+	if err := WriteSARIF(&out, Report{Pages: report.Pages[:1]}); err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		Runs []struct {
+			Results json.RawMessage `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &raw); err != nil || string(raw.Runs[0].Results) != "[]" {
+		t.Errorf("results of a passing run = %s, %v, want []", raw.Runs[0].Results, err)
+	}
+}
@@ -0,0 +1,101 @@
+package gate
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes report as JUnit XML: a test suite per page with a test case per rule.
+// Checks of a page that couldn't be analysed and rules the thresholds turn off are skipped.
+func WriteJUnit(w io.Writer, report Report) error {
+	suites := junitTestSuites{Name: "url-analyser gate", Time: seconds(report.Duration.Seconds())}
+	for _, page := range report.Pages {
+		suite := junitTestSuite{
+			Name:      page.URL,
+			Time:      seconds(page.Duration.Seconds()),
+			Timestamp: report.StartedAt.UTC().Format("2006-01-02T15:04:05"),
+		}
+		for _, rule := range Rules {
+			testCase := junitTestCase{Name: rule.ID, ClassName: page.URL, Time: "0"}
+			if rule.ID == RuleCrawlFailed {
+				testCase.Time = suite.Time
+			}
+
+			var messages []string
+			for _, violation := range page.Violations {
+				if violation.Rule == rule.ID {
+					messages = append(messages, violation.Message)
+				}
+			}
+			switch {
+			case len(messages) > 0:
+				testCase.Failure = &junitFailure{Message: messages[0], Type: rule.ID, Text: strings.Join(messages, "\n")}
+				if len(messages) > 1 {
+					testCase.Failure.Message = fmt.Sprintf("%d %s violations", len(messages), rule.ID)
+				}
+				suite.Failures++
+			case !page.Checked(rule.ID, report.Thresholds):
+				testCase.Skipped = &struct{}{}
+				suite.Skipped++
+			}
+			suite.Cases = append(suite.Cases, testCase)
+			suite.Tests++
+		}
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(s float64) string {
+	return fmt.Sprintf("%.3f", s)
+}
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"web-scraper/config"
+)
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// Init installs the default slog logger configured by LOG_LEVEL (debug, info, warn, error, default info)
+// and LOG_FORMAT ("json" or "text", default text). Output of the standard log package goes through it too.
+func Init() {
+	opts := &slog.HandlerOptions{Level: parseLevel(config.GetEnv("LOG_LEVEL"))}
+
+	var handler slog.Handler
+	if strings.EqualFold(config.GetEnv("LOG_FORMAT"), "json") {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+func parseLevel(value string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// WithLogger returns a context carrying logger, picked up by FromContext further down the call chain
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the logger of ctx with its correlation fields, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// WithRequestID returns a context carrying the ID of the API request it belongs to
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestID returns the API request ID of ctx, empty outside of a request
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
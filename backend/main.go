@@ -2,55 +2,67 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	"web-scraper/blobstore"
+	"web-scraper/config"
+	"web-scraper/database"
+	"web-scraper/logging"
 	authMiddleware "web-scraper/middlewares"
 	"web-scraper/models"
+	"web-scraper/netguard"
 	"web-scraper/services"
+	"web-scraper/tracing"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
-	"gorm.io/driver/mysql"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
-func ConnectMySql() *gorm.DB {
-	err := godotenv.Load()
+// ConnectDB connects to the database selected by DB_DRIVER. It exits when the schema is outdated, unless
+// DB_MIGRATE_ON_START applies the pending migrations or DB_ALLOW_OUTDATED_SCHEMA lets the server start anyway.
+func ConnectDB() *gorm.DB {
+	opts := database.OptionsFromEnv()
+	db, err := database.Open(opts)
 	if err != nil {
-		log.Println("Failed loading env variables. No .env file found")
+		slog.Error("Failed to connect to DB", "driver", opts.Driver, "error", err)
+		os.Exit(1)
 	}
 
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbName := os.Getenv("DB_NAME")
-
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", dbUser, dbPassword, dbHost, dbPort, dbName)
-
-	database, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
-
-	if err != nil {
-		log.Fatalf("Failed to connect to DB")
+	// running migrations on every replica at boot is meant for single instances, e.g. local SQLite
+	if config.GetEnvBool("DB_MIGRATE_ON_START", false) {
+		applied, err := database.MigrateUp(db, 0)
+		if err != nil {
+			slog.Error("Failed to migrate db", "error", err)
+			os.Exit(1)
+		}
+		for _, migration := range applied {
+			slog.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+		}
 	}
 
-	err = database.AutoMigrate(&models.URLAnalysis{})
-
-	if err != nil {
-		log.Fatalf("Failed to auto migrate db %v", err)
+	if err := database.CheckSchema(db); err != nil {
+		if !config.GetEnvBool("DB_ALLOW_OUTDATED_SCHEMA", false) {
+			slog.Error("Refusing to start, set DB_ALLOW_OUTDATED_SCHEMA=true to start anyway", "error", err)
+			os.Exit(1)
+		}
+		slog.Warn("Starting with an outdated database schema", "error", err)
 	}
 
-	log.Println("Database is successfully connected")
-
-	return database
+	slog.Info("Database is successfully connected", "driver", opts.Driver)
 
+	return db
 }
 
 func DBMiddlewareCtx(db *gorm.DB) gin.HandlerFunc {
@@ -62,6 +74,86 @@ func DBMiddlewareCtx(db *gorm.DB) gin.HandlerFunc {
 
 type AddURLInput struct {
 	URL string `json:"url" binding:"required,url"`
+	// optional crawl profile for pages behind a login, must belong to the caller
+	ProfileID *uint `json:"profileId"`
+	// priority lane, interactive when empty
+	Lane string `json:"lane" binding:"omitempty,oneof=interactive scheduled bulk"`
+}
+
+// checkProfileOwner reports whether the crawl profile exists and belongs to userID
+func checkProfileOwner(db *gorm.DB, userID string, profileID uint) (bool, error) {
+	var count int64
+	if err := db.Model(&models.CrawlProfile{}).Where("id = ? AND user_id = ?", profileID, userID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// findUserAnalysis loads the columns, all when none are given, of the analysis with the id of the request path,
+// making sure it belongs to the caller
+func findUserAnalysis(c *gin.Context, db *gorm.DB, columns ...string) (models.URLAnalysis, bool) {
+	var urlAnalysis models.URLAnalysis
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL ID format"})
+		return urlAnalysis, false
+	}
+
+	query := db.Where("user_id = ?", c.GetString("UserID"))
+	if len(columns) > 0 {
+		query = query.Select(columns)
+	}
+	if err := query.First(&urlAnalysis, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "URL analysis not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch URL: " + err.Error()})
+		}
+		return urlAnalysis, false
+	}
+
+	return urlAnalysis, true
+}
+
+// errAnalysisRunning is returned by saveQueuedAnalysis for an analysis a worker is crawling, queueing it again
+// would have a second worker crawl it at the same time
+var errAnalysisRunning = errors.New("the URL is being analysed, wait for the analysis to finish or cancel it")
+
+// saveQueuedAnalysis creates the analysis of a URL submitted by urlAnalysis.UserID, or resets their existing
+// one to queued for the new profile and lane. Running analyses are left alone with errAnalysisRunning.
+func saveQueuedAnalysis(db *gorm.DB, urlAnalysis *models.URLAnalysis) error {
+	created := db.Clauses(clause.OnConflict{DoNothing: true}).Create(urlAnalysis)
+	if created.Error != nil || created.RowsAffected > 0 {
+		return created.Error
+	}
+
+	// the user submitted the URL before
+	reset := db.Model(&models.URLAnalysis{}).
+		Where("user_id = ? AND url = ? AND status <> ?", urlAnalysis.UserID, urlAnalysis.URL, "running").
+		Updates(map[string]interface{}{
+			"status":           "queued",
+			"crawl_profile_id": urlAnalysis.CrawlProfileID,
+			"lane":             urlAnalysis.Lane,
+			// a new submission starts over with its retries
+			"attempts":        0,
+			"next_retry_at":   nil,
+			"attempt_history": nil,
+			"updated_at":      time.Now(),
+		})
+	if reset.Error != nil {
+		return reset.Error
+	}
+	if reset.RowsAffected == 0 {
+		return errAnalysisRunning
+	}
+
+	var existing models.URLAnalysis
+	if err := db.Select("id", "url", "status", "lane").Where("user_id = ? AND url = ?", urlAnalysis.UserID, urlAnalysis.URL).First(&existing).Error; err != nil {
+		return err
+	}
+	urlAnalysis.ID, urlAnalysis.Status, urlAnalysis.Lane = existing.ID, existing.Status, existing.Lane
+	return nil
 }
 
 func AddURL(c *gin.Context) {
@@ -88,29 +180,50 @@ func AddURL(c *gin.Context) {
 		return
 	}
 
-	urlAnalysis := models.URLAnalysis{URL: input.URL, Status: "queued"}
+	if err := netguard.Default().ValidateURL(c.Request.Context(), input.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URL is not allowed: " + err.Error()})
+		return
+	}
 
-	result := db.Clauses(clause.OnConflict{
-		Columns: []clause.Column{{Name: "url"}},
-		DoUpdates: clause.Assignments(map[string]interface{}{
-			"status":     "queued",
-			"updated_at": gorm.Expr("NOW()"),
-		}),
-	}).Create(&urlAnalysis)
+	userID := c.GetString("UserID")
 
-	if result.Error != nil {
-		//todo: error for duplicate url creation
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add URL: " + result.Error.Error()})
+	if input.ProfileID != nil {
+		owned, err := checkProfileOwner(db, userID, *input.ProfileID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check crawl profile: " + err.Error()})
+			return
+		}
+		if !owned {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Crawl profile not found"})
+			return
+		}
+	}
+
+	lane, _ := services.ParseLane(input.Lane)
+
+	urlAnalysis := models.URLAnalysis{URL: input.URL, Status: "queued", UserID: userID, CrawlProfileID: input.ProfileID, Lane: string(lane)}
+
+	if err := saveQueuedAnalysis(db, &urlAnalysis); err != nil {
+		if errors.Is(err, errAnalysisRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": "URL is being analysed, wait for the analysis to finish or cancel it"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add URL: " + err.Error()})
 		return
 	}
 
-	services.EnqueueURL(urlAnalysis.ID)
+	if err := services.EnqueueURL(c.Request.Context(), urlAnalysis.ID, userID, lane); err != nil {
+		// the analysis stays queued and is picked up after the restart
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server is shutting down, the URL will be analysed after the restart", "id": urlAnalysis.ID})
+		return
+	}
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Url has been added",
 		"id":      urlAnalysis.ID,
 		"url":     urlAnalysis.URL,
 		"status":  urlAnalysis.Status,
+		"lane":    urlAnalysis.Lane,
 	})
 }
 
@@ -125,7 +238,8 @@ func GetAllURLs(c *gin.Context) {
 
 	urls := []models.URLAnalysis{}
 
-	if err := db.Find(&urls).Error; err != nil {
+	// the main content can be large, it is only served by the detail endpoint
+	if err := db.Omit("main_content").Where("user_id = ?", c.GetString("UserID")).Find(&urls).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch urls " + err.Error()})
 		return
 	}
@@ -154,7 +268,7 @@ func GetUrlByID(c *gin.Context) {
 
 	urlAnalysis := models.URLAnalysis{}
 
-	result := db.First(&urlAnalysis, id)
+	result := db.Where("user_id = ?", c.GetString("UserID")).First(&urlAnalysis, id)
 
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
@@ -169,6 +283,45 @@ func GetUrlByID(c *gin.Context) {
 	c.JSON(http.StatusOK, urlAnalysis)
 }
 
+// GetUrlLogs returns the crawl log of the last run of an analysis
+func GetUrlLogs(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL ID format"})
+		return
+	}
+
+	urlAnalysis := models.URLAnalysis{}
+
+	result := db.Select("id", "status").Where("user_id = ?", c.GetString("UserID")).First(&urlAnalysis, id)
+
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "URL analysis not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch URL: " + result.Error.Error()})
+		}
+		return
+	}
+
+	logs := []models.CrawlLogEntry{}
+	if err := db.Where("url_analysis_id = ?", urlAnalysis.ID).Order("id").Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch crawl logs " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": urlAnalysis.ID, "status": urlAnalysis.Status, "logs": logs})
+}
+
 func CancelUrl(c *gin.Context) {
 	dbInstance, exists := c.Get("db")
 
@@ -187,44 +340,45 @@ func CancelUrl(c *gin.Context) {
 		return
 	}
 
+	logger := logging.FromContext(c.Request.Context())
+
 	var urlAnalysis models.URLAnalysis
-	result := db.First(&urlAnalysis, id)
+	result := db.Where("user_id = ?", c.GetString("UserID")).First(&urlAnalysis, id)
 
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "URL analysis not found"})
 		} else {
-			log.Printf("Error [CancelURL]: Failed to fetch URL %d for cancel: %v", id, result.Error)
+			logger.Error("Failed to fetch URL analysis for cancel", "analysis_id", id, "error", result.Error)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch URL for cancel: " + result.Error.Error()})
 		}
 		return
 	}
 
 	// Check if it's already in a final state
-	if urlAnalysis.Status == "done" || urlAnalysis.Status == "error" || urlAnalysis.Status == "cancelled" {
+	if urlAnalysis.Status == "done" || urlAnalysis.Status == "partial" || urlAnalysis.Status == "error" || urlAnalysis.Status == "errored" || urlAnalysis.Status == "cancelled" {
 		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("URL analysis is already %s. Cannot cancel.", urlAnalysis.Status)})
 		return
 	}
 
 	updateResult := db.Model(&urlAnalysis).Updates(map[string]interface{}{
 		"status":     "cancelled",
-		"updated_at": gorm.Expr("NOW()"),
+		"updated_at": time.Now(),
 	})
 
 	if updateResult.Error != nil {
-		log.Printf("Error [CancelURL]: Failed to cancel URL analysis %d: %v", id, updateResult.Error)
+		logger.Error("Failed to cancel URL analysis", "analysis_id", id, "error", updateResult.Error)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel URL analysis: " + updateResult.Error.Error()})
 		return
 	}
 
-	if cancel, ok := services.RunningCrawlContexts.Load(urlAnalysis.ID); ok {
-		// We found a cancel function for this running job
-		cancel.(context.CancelFunc)()
-		services.RunningCrawlContexts.Delete(urlAnalysis.ID)
-		log.Printf("Triggered cancellation for running URLAnalysis ID: %d", urlAnalysis.ID)
+	if services.CancelAnalysis(urlAnalysis.ID) {
+		logger.Info("Triggered cancellation of running analysis", "analysis_id", urlAnalysis.ID)
 	} else {
 		// Job was likely queued or paused, not actively running at the moment
-		log.Printf("URLAnalysis ID: %d was not actively running, only status updated to 'cancelled'.", urlAnalysis.ID)
+		logger.Info("Analysis was not actively running, only status updated to cancelled", "analysis_id", urlAnalysis.ID)
+		urlAnalysis.Status = "cancelled"
+		services.PublishAnalysisCancelled(&urlAnalysis)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "URL analysis cancelled successfully", "id": urlAnalysis.ID, "status": "cancelled"})
@@ -232,19 +386,51 @@ func CancelUrl(c *gin.Context) {
 }
 
 func main() {
-	db := ConnectMySql()
+	config.LoadEnv()
+	logging.Init()
 
-	r := gin.Default()
-	r.Use(gin.Logger())
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
+	db := ConnectDB()
+
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		slog.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("Failed to flush traces", "error", err)
+		}
+	}()
+
+	snapshotStore, err := blobstore.New()
+	if err != nil {
+		slog.Error("Failed to set up the blob store", "error", err)
+		os.Exit(1)
+	}
+	services.SetSnapshotStore(snapshotStore)
+	services.EnableContentChangeWebhook()
+
+	// gin's text access log is replaced by the structured one of LogRequests
+	r := gin.New()
 	r.Use(gin.Recovery())
 
 	r.RedirectTrailingSlash = false
 
+	r.Use(authMiddleware.RecordRequestMetrics())
+	r.Use(otelgin.Middleware(tracing.ServiceName()))
+	r.Use(authMiddleware.RequestID())
+	r.Use(authMiddleware.LogRequests())
+
 	// allow cors for frontend
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Request-ID"},
+		ExposeHeaders:    []string{"X-Request-ID"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -252,8 +438,20 @@ func main() {
 	// so we don't need pass db or store it as global variable
 	r.Use(DBMiddlewareCtx(db))
 
+	// subscribed before the workers start, so no event of a resumed analysis is missed
+	if err := services.EnableWebhooks(db); err != nil {
+		slog.Error("Failed to resume webhook deliveries", "error", err)
+	}
+
+	services.EnableNotifications(db)
+
 	// to be able to process more than one URL
-	services.StartWorkers(db)
+	services.StartWorkers(services.NewGormRepository(db))
+
+	// analyses left behind by a previous process, e.g. killed during a deploy
+	if err := services.RequeueInterrupted(db); err != nil {
+		slog.Error("Failed to re-queue interrupted analyses", "error", err)
+	}
 
 	r.GET("/health", func(c *gin.Context) {
 
@@ -268,7 +466,8 @@ func main() {
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"status": "down", "db_error": "Internal type assertion error for DB"})
-			log.Fatalf("Value in context for key 'db' was not of type *gorm.DB")
+			slog.Error("Value in context for key 'db' was not of type *gorm.DB")
+			os.Exit(1)
 			return
 		}
 
@@ -281,23 +480,146 @@ func main() {
 
 	})
 
+	// scraped by prometheus, protected with a bearer token when METRICS_TOKEN is set
+	r.GET("/metrics", authMiddleware.EnsureMetricsToken(), gin.WrapH(promhttp.Handler()))
+
 	r.GET("/ping", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "pong",
 		})
 	})
 
-	urlGroup := r.Group("/urls")
 	// Add authenticaion middleware using auth0
-	urlGroup.Use(authMiddleware.EnsureAuthenitcation())
+	ensureAuthentication := authMiddleware.EnsureAuthenitcation()
+
+	urlGroup := r.Group("/urls")
+	urlGroup.Use(ensureAuthentication)
 	{
 		urlGroup.POST("", AddURL)
+		urlGroup.POST("/bulk", AddURLs)
+		urlGroup.POST("/reprocess", ReprocessUrls)
 		urlGroup.GET("", GetAllURLs)
 		urlGroup.GET("/:id", GetUrlByID)
+		urlGroup.GET("/:id/logs", GetUrlLogs)
+		urlGroup.GET("/:id/snapshots", GetUrlSnapshots)
+		urlGroup.GET("/:id/snapshots/:snapshotId", DownloadUrlSnapshot)
+		urlGroup.POST("/:id/reprocess", ReprocessUrl)
+		urlGroup.GET("/:id/versions", GetUrlVersions)
+		urlGroup.GET("/:id/diff", GetUrlDiff)
+		urlGroup.POST("/:id/cancel", CancelUrl)
+	}
+
+	profileGroup := r.Group("/profiles")
+	profileGroup.Use(ensureAuthentication)
+	{
+		profileGroup.POST("", CreateCrawlProfile)
+		profileGroup.GET("", GetCrawlProfiles)
+		profileGroup.GET("/:id", GetCrawlProfile)
+		profileGroup.PUT("/:id", UpdateCrawlProfile)
+		profileGroup.DELETE("/:id", DeleteCrawlProfile)
+	}
+
+	webhookGroup := r.Group("/webhooks")
+	webhookGroup.Use(ensureAuthentication)
+	{
+		webhookGroup.POST("", CreateWebhook)
+		webhookGroup.GET("", GetWebhooks)
+		webhookGroup.GET("/dead-letters", GetDeadLetters)
+		webhookGroup.GET("/:id", GetWebhook)
+		webhookGroup.PUT("/:id", UpdateWebhook)
+		webhookGroup.DELETE("/:id", DeleteWebhook)
+		webhookGroup.POST("/:id/ping", PingWebhook)
+		webhookGroup.GET("/:id/deliveries", GetWebhookDeliveries)
+		webhookGroup.POST("/:id/deliveries/:deliveryId/redeliver", RedeliverWebhook)
+	}
+
+	// opened by recipients of email channels, who don't have to be users
+	r.GET("/notifications/confirm", ShowNotificationConfirmation)
+	r.POST("/notifications/confirm", ConfirmNotificationChannel)
+
+	notificationGroup := r.Group("/notifications")
+	notificationGroup.Use(ensureAuthentication)
+	{
+		notificationGroup.POST("/channels", CreateNotificationChannel)
+		notificationGroup.GET("/channels", GetNotificationChannels)
+		notificationGroup.PUT("/channels/:id", UpdateNotificationChannel)
+		notificationGroup.DELETE("/channels/:id", DeleteNotificationChannel)
+		notificationGroup.POST("/channels/:id/test", TestNotificationChannel)
+		notificationGroup.POST("/rules", CreateNotificationRule)
+		notificationGroup.GET("/rules", GetNotificationRules)
+		notificationGroup.PUT("/rules/:id", UpdateNotificationRule)
+		notificationGroup.DELETE("/rules/:id", DeleteNotificationRule)
+	}
+
+	// managed from a login session only, a leaked API token can't mint or revoke tokens
+	tokenGroup := r.Group("/tokens")
+	tokenGroup.Use(ensureAuthentication, authMiddleware.EnsureSession())
+	{
+		tokenGroup.POST("", CreateAPIToken)
+		tokenGroup.GET("", GetAPITokens)
+		tokenGroup.DELETE("/:id", DeleteAPIToken)
+	}
+
+	adminGroup := r.Group("/admin")
+	adminGroup.Use(ensureAuthentication, authMiddleware.EnsureAdmin())
+	{
+		adminGroup.GET("/workers", GetWorkerPool)
+		adminGroup.PUT("/workers", UpdateWorkerPool)
+		adminGroup.GET("/proxies", GetProxyPool)
 	}
 
-	if err := r.Run(); err != nil {
-		log.Fatalf("Failed to start the server")
+	srv := &http.Server{
+		Addr:    serverAddr(),
+		Handler: r,
 	}
 
+	go func() {
+		slog.Info("Listening", "addr", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Failed to start the server", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	stopCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-stopCtx.Done()
+	stop() // a second signal kills the process right away
+
+	shutdown(srv, db)
+}
+
+// serverAddr is the listen address, PORT or 8080 like gin's Run
+func serverAddr() string {
+	if port := config.GetEnv("PORT"); port != "" {
+		return ":" + port
+	}
+	return ":8080"
+}
+
+// shutdown stops the API, then the workers: running crawls get SHUTDOWN_GRACE_PERIOD (default 20s) to finish
+// and are interrupted and re-queued after that. The database pool is closed last.
+func shutdown(srv *http.Server, db *gorm.DB) {
+	gracePeriod := config.GetEnvDuration("SHUTDOWN_GRACE_PERIOD", 20*time.Second)
+	slog.Info("Shutting down", "grace_period", gracePeriod)
+
+	httpCtx, cancelHTTP := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelHTTP()
+	if err := srv.Shutdown(httpCtx); err != nil {
+		slog.Error("Failed to stop the HTTP server gracefully", "error", err)
+	}
+
+	// interrupted crawls still have to save their re-queued status
+	workersCtx, cancelWorkers := context.WithTimeout(context.Background(), gracePeriod+10*time.Second)
+	defer cancelWorkers()
+	if err := services.StopWorkers(workersCtx, gracePeriod); err != nil {
+		slog.Error("Failed to stop workers", "error", err)
+	}
+
+	if sqlDB, err := db.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			slog.Error("Failed to close the database pool", "error", err)
+		}
+	}
+	slog.Info("Shutdown complete")
 }
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "url_analyser"
+
+var (
+	// WorkersTotal is the configured size of the worker pool
+	WorkersTotal = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "workers_total",
+		Help:      "Number of analysis workers in the pool.",
+	})
+
+	ActiveWorkers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "workers_active",
+		Help:      "Number of workers currently processing an analysis.",
+	})
+
+	// LastJobFinished lets alerts fire when the queue is not empty but nothing finished for a while
+	LastJobFinished = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_job_finished_timestamp_seconds",
+		Help:      "Unix time the last analysis finished.",
+	})
+
+	QueuedJobs = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queued_jobs",
+		Help:      "Number of analyses waiting for a worker by priority lane.",
+	}, []string{"lane"})
+
+	CrawlDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "crawl_duration_seconds",
+		Help:      "Duration of an analysis from start to final save, by final status.",
+		Buckets:   []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"status"})
+
+	// HTTPResponses counts outbound responses, source is "crawl" for colly requests and "link_check" for checkLinks
+	HTTPResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbound_http_responses_total",
+		Help:      "Outbound HTTP responses by source and status code, code is \"error\" when no response was received.",
+	}, []string{"source", "code"})
+
+	LinkChecks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "link_checks_total",
+		Help:      "Links checked by result (ok, broken, blocked, error).",
+	}, []string{"result"})
+
+	Cancellations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cancellations_total",
+		Help:      "Cancelled analyses by the stage they were in (queued, running).",
+	}, []string{"stage"})
+
+	RetriesScheduled = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retries_scheduled_total",
+		Help:      "Failed analyses scheduled for an automatic retry.",
+	})
+
+	Reprocessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reprocessed_total",
+		Help:      "Analyses run again on their stored snapshot, by result (done, failed).",
+	}, []string{"result"})
+
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_delivery_attempts_total",
+		Help:      "Webhook delivery attempts by result (delivered, retrying, dead).",
+	}, []string{"result"})
+
+	Notifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_total",
+		Help:      "Notifications by channel type and result (sent, failed).",
+	}, []string{"channel", "result"})
+
+	DBSaveFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_save_failures_total",
+		Help:      "Failed database writes of the workers by operation.",
+	}, []string{"operation"})
+
+	RequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "API requests by method, route and status code.",
+	}, []string{"method", "route", "code"})
+
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "API request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// queueDepth reads the depth of the current worker pool, set by RegisterQueueDepth
+var queueDepth atomic.Pointer[func() float64]
+
+// the gauge is registered once, restarting the worker pool only swaps the function it reads
+var _ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "queue_depth",
+	Help:      "Number of analyses waiting in the queue.",
+}, func() float64 {
+	if depth := queueDepth.Load(); depth != nil {
+		return (*depth)()
+	}
+	return 0
+})
+
+// RegisterQueueDepth exposes the number of analyses waiting for a worker, read from depth at scrape time.
+// It replaces the function of a previous call.
+func RegisterQueueDepth(depth func() float64) {
+	queueDepth.Store(&depth)
+}
@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+	"web-scraper/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EnsureAdmin only lets through users listed in ADMIN_USER_IDS, a comma separated list of Auth0 subjects.
+// It has to run after EnsureAuthenitcation.
+func EnsureAdmin() gin.HandlerFunc {
+	admins := map[string]bool{}
+	for _, id := range strings.Split(config.GetEnv("ADMIN_USER_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			admins[id] = true
+		}
+	}
+
+	return func(ctx *gin.Context) {
+		if !admins[ctx.GetString("UserID")] {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			return
+		}
+		ctx.Next()
+	}
+}
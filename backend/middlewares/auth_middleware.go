@@ -2,17 +2,22 @@ package middlewares
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"os"
 	"time"
 	"web-scraper/config"
+	"web-scraper/logging"
+	"web-scraper/services"
 
 	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
 	"github.com/auth0/go-jwt-middleware/v2/jwks"
 	"github.com/auth0/go-jwt-middleware/v2/validator"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type CustomClaims struct {
@@ -44,7 +49,8 @@ func EnsureAuthenitcation() gin.HandlerFunc {
 	)
 
 	if err != nil {
-		log.Fatalf("Failed to set up JWT validator: %v", err)
+		slog.Error("Failed to set up JWT validator", "error", err)
+		os.Exit(1)
 	}
 
 	return func(ctx *gin.Context) {
@@ -55,10 +61,15 @@ func EnsureAuthenitcation() gin.HandlerFunc {
 			return
 		}
 
+		if services.IsAPIToken(token) {
+			authenticateAPIToken(ctx, token)
+			return
+		}
+
 		validatedClaims, err := jwtValidator.ValidateToken(context.Background(), token)
 
 		if err != nil {
-			log.Printf("JWT Validation Error: %v", err)
+			logging.FromContext(ctx.Request.Context()).Warn("JWT validation failed", "error", err)
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: Invalid token"})
 			return
 		}
@@ -66,15 +77,60 @@ func EnsureAuthenitcation() gin.HandlerFunc {
 		claims, ok := validatedClaims.(*validator.ValidatedClaims)
 
 		if !ok {
-			log.Println("WARNING: ValidatedClaims not found in context, but JWT check succeeded.")
+			logging.FromContext(ctx.Request.Context()).Warn("ValidatedClaims not found in context, but JWT check succeeded")
 			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Authentication context error"})
 			return
 		}
 
-		ctx.Set("UserID", claims.RegisteredClaims.Subject)
+		setUser(ctx, claims.RegisteredClaims.Subject)
 		ctx.Set("userClaims", claims)
 
 		ctx.Next()
 
 	}
 }
+
+// authenticateAPIToken lets a request carrying an API token through as the owner of the token
+func authenticateAPIToken(ctx *gin.Context, token string) {
+	dbInstance, exists := ctx.Get("db")
+	if !exists {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	apiToken, err := services.AuthenticateAPIToken(dbInstance.(*gorm.DB), token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAPIToken) {
+			logging.FromContext(ctx.Request.Context()).Warn("API token rejected")
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: Invalid token"})
+		} else {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check API token: " + err.Error()})
+		}
+		return
+	}
+
+	setUser(ctx, apiToken.UserID)
+	ctx.Set("apiTokenID", apiToken.ID)
+
+	ctx.Next()
+}
+
+// EnsureSession rejects requests authenticated with an API token, only Auth0 sessions get through.
+// It has to run after EnsureAuthenitcation.
+func EnsureSession() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if _, viaAPIToken := ctx.Get("apiTokenID"); viaAPIToken {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API tokens can't be used here, sign in instead"})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// setUser makes userID the caller of the request, also in its logs
+func setUser(ctx *gin.Context, userID string) {
+	ctx.Set("UserID", userID)
+
+	logger := logging.FromContext(ctx.Request.Context()).With("user_id", userID)
+	ctx.Request = ctx.Request.WithContext(logging.WithLogger(ctx.Request.Context(), logger))
+}
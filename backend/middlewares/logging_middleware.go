@@ -0,0 +1,81 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+	"web-scraper/logging"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// RequestID tags every request with an ID, taken from X-Request-ID when the caller sends a sane one.
+// The ID is echoed in the response and carried by the request logger.
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		ctx.Set("RequestID", requestID)
+		ctx.Header(requestIDHeader, requestID)
+
+		logger := slog.Default().With("request_id", requestID)
+		if spanContext := trace.SpanContextFromContext(ctx.Request.Context()); spanContext.HasTraceID() {
+			logger = logger.With("trace_id", spanContext.TraceID().String())
+		}
+
+		reqCtx := logging.WithRequestID(ctx.Request.Context(), requestID)
+		ctx.Request = ctx.Request.WithContext(logging.WithLogger(reqCtx, logger))
+
+		ctx.Next()
+	}
+}
+
+// LogRequests writes one structured access log line per request, replacing the gin text logger
+func LogRequests() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+
+		ctx.Next()
+
+		level := slog.LevelInfo
+		if ctx.Writer.Status() >= 500 {
+			level = slog.LevelError
+		}
+		logging.FromContext(ctx.Request.Context()).Log(ctx.Request.Context(), level, "request handled",
+			"method", ctx.Request.Method,
+			"path", ctx.Request.URL.Path,
+			"route", ctx.FullPath(),
+			"status", ctx.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", ctx.ClientIP(),
+		)
+	}
+}
+
+// validRequestID accepts up to 128 characters of letters, digits, '-', '_' and '.', anything else could forge log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
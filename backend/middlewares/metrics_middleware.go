@@ -0,0 +1,55 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+	"web-scraper/config"
+	"web-scraper/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RecordRequestMetrics counts API requests and their latency per route template, e.g. "/urls/:id"
+func RecordRequestMetrics() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched" // keeps 404 scans from creating a series per path
+		}
+
+		method := ctx.Request.Method
+		metrics.RequestsTotal.WithLabelValues(method, route, strconv.Itoa(ctx.Writer.Status())).Inc()
+		metrics.RequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// EnsureMetricsToken requires "Authorization: Bearer <METRICS_TOKEN>". Without METRICS_TOKEN the metrics are
+// only served with METRICS_PUBLIC=true, e.g. when the port is only reachable from the internal network.
+func EnsureMetricsToken() gin.HandlerFunc {
+	token := config.GetEnv("METRICS_TOKEN")
+	public := config.GetEnvBool("METRICS_PUBLIC", false)
+
+	return func(ctx *gin.Context) {
+		if token == "" {
+			if public {
+				ctx.Next()
+				return
+			}
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Metrics are disabled, set METRICS_TOKEN or METRICS_PUBLIC=true"})
+			return
+		}
+
+		expected := "Bearer " + token
+		if subtle.ConstantTimeCompare([]byte(ctx.GetHeader("Authorization")), []byte(expected)) != 1 {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+	"web-scraper/database"
+
+	"gorm.io/gorm"
+)
+
+const migrateUsage = `Usage: app migrate <command>
+
+  up [<version>]        apply pending migrations, up to version when given
+  down [<steps>]        revert the last applied migration, or the last steps
+  status                list migrations and when they were applied
+  baseline [<version>]  mark migrations up to version (default 1) as applied without running them,
+                        once for databases created by AutoMigrate
+`
+
+// runMigrate runs the migrate command against the database selected by DB_DRIVER and returns the exit code
+func runMigrate(args []string) int {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	command := args[0]
+	if command != "up" && command != "down" && command != "status" && command != "baseline" {
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\n\n%s", command, migrateUsage)
+		return 2
+	}
+	number := 0
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			fmt.Fprintf(os.Stderr, "%q isn't a positive number\n\n%s", args[1], migrateUsage)
+			return 2
+		}
+		number = n
+	}
+
+	opts := database.OptionsFromEnv()
+	db, err := database.Open(opts)
+	if err != nil {
+		slog.Error("Failed to connect to DB", "driver", opts.Driver, "error", err)
+		return 1
+	}
+
+	var done []database.Migration
+	switch command {
+	case "up":
+		done, err = database.MigrateUp(db, number)
+		printMigrations("Applied", done)
+	case "down":
+		if number == 0 {
+			number = 1
+		}
+		done, err = database.MigrateDown(db, number)
+		printMigrations("Reverted", done)
+	case "baseline":
+		if number == 0 {
+			number = 1
+		}
+		done, err = database.Baseline(db, number)
+		printMigrations("Baselined", done)
+	case "status":
+		err = printMigrationStatus(db)
+	}
+	if err != nil {
+		slog.Error("Migration failed", "command", command, "error", err)
+		return 1
+	}
+	if len(done) == 0 && command != "status" {
+		fmt.Println("Nothing to do")
+	}
+	return 0
+}
+
+func printMigrations(verb string, migrations []database.Migration) {
+	for _, migration := range migrations {
+		fmt.Printf("%s %04d_%s\n", verb, migration.Version, migration.Name)
+	}
+}
+
+// printMigrationStatus prints every migration with when it was applied, or pending
+func printMigrationStatus(db *gorm.DB) error {
+	status, err := database.Status(db)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, migration := range status {
+		applied := "pending"
+		if migration.AppliedAt != nil {
+			applied = migration.AppliedAt.Local().Format(time.DateTime)
+		}
+		if migration.Unknown {
+			applied += " (not part of this build)"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", migration.Version, migration.Name, applied)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIToken lets scripts and the command-line client call the API as a user, it is sent as a bearer token
+// in place of an Auth0 access token. Only its hash is stored.
+type APIToken struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deletedAt,omitempty"` // For soft delete
+
+	UserID string `gorm:"size:255;index;not null" json:"userId"`
+	Name   string `gorm:"size:100;not null" json:"name"`
+	// Prefix is the start of the token, enough to tell tokens apart
+	Prefix string `gorm:"size:16" json:"prefix"`
+	// hex SHA-256 of the token
+	TokenHash string `gorm:"size:64;uniqueIndex;not null" json:"-"`
+
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	// nil for tokens that don't expire
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
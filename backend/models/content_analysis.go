@@ -0,0 +1,115 @@
+package models
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ContentAnalysis describes the visible text of the analysed page
+type ContentAnalysis struct {
+	WordCount     int `json:"wordCount"`
+	SentenceCount int `json:"sentenceCount"`
+	// TextHTMLRatio is the share of the HTML that is visible text, in percent
+	TextHTMLRatio float64 `json:"textHtmlRatio"`
+	// Language is the language detected from the text as an ISO 639-1 code, empty when undetermined
+	Language           string  `json:"language"`
+	LanguageConfidence float64 `json:"languageConfidence"`
+	// HTMLLang is the lang attribute of the html element, LanguageMatches compares its primary subtag with Language
+	HTMLLang        string `json:"htmlLang"`
+	LanguageMatches bool   `json:"languageMatches"`
+	// Readability is only computed for English text, the formulas are calibrated for it
+	Readability *Readability `json:"readability"`
+	TopKeywords []Keyword    `json:"topKeywords"`
+}
+
+// Readability holds the Flesch scores of a text
+type Readability struct {
+	// FleschReadingEase runs from about 0 (very difficult) to 100 (very easy)
+	FleschReadingEase float64 `json:"fleschReadingEase"`
+	// FleschKincaidGrade is the US school grade needed to understand the text
+	FleschKincaidGrade float64 `json:"fleschKincaidGrade"`
+}
+
+// Keyword is a frequent word of the page text, stop words excluded
+type Keyword struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+// Value implements the driver.Valuer interface for database saving
+func (ca ContentAnalysis) Value() (driver.Value, error) {
+	return json.Marshal(ca)
+}
+
+// Scan implements the sql.Scanner interface for database loading
+func (ca *ContentAnalysis) Scan(value interface{}) error {
+	if value == nil {
+		*ca = ContentAnalysis{}
+		return nil
+	}
+	return scanJSON(value, ca)
+}
+
+// GormDBDataType implements the migrator.GormDataTypeInterface for the column type of each database
+func (ca ContentAnalysis) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDataType(db)
+}
+
+// CompressedText is a text stored gzip compressed
+type CompressedText string
+
+// Value implements the driver.Valuer interface for database saving
+func (ct CompressedText) Value() (driver.Value, error) {
+	if ct == "" {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(zw, string(ct)); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Scan implements the sql.Scanner interface for database loading
+func (ct *CompressedText) Scan(value interface{}) error {
+	var compressed []byte
+	switch v := value.(type) {
+	case nil:
+		*ct = ""
+		return nil
+	case []byte:
+		compressed = v
+	case string:
+		compressed = []byte(v)
+	default:
+		return errors.New("unsupported type for compressed text scanning")
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	text, err := io.ReadAll(zr)
+	if err != nil {
+		return err
+	}
+	*ct = CompressedText(text)
+	return nil
+}
+
+// GormDBDataType implements the migrator.GormDataTypeInterface for the column type of each database
+func (ct CompressedText) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return blobDataType(db)
+}
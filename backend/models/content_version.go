@@ -0,0 +1,61 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ContentVersion is a distinct state of the content of an analysed page. A run only adds a version when
+// the normalised text or the structure (headings and links) differ from the previous version.
+type ContentVersion struct {
+	ID            uint `gorm:"primarykey" json:"id"`
+	URLAnalysisID uint `gorm:"index;not null" json:"urlAnalysisId"`
+	Attempt       int  `json:"attempt"`
+	// sha256 of the normalised visible text, and of the headings and links
+	TextHash      string         `gorm:"size:64" json:"textHash"`
+	StructureHash string         `gorm:"size:64" json:"structureHash"`
+	Text          CompressedText `json:"-"`
+	Headings      StringList     `gorm:"type:json" json:"headings"`
+	Links         StringList     `gorm:"type:json" json:"links"`
+	// Diff compares the version with the one before it, empty for the first version
+	Diff      ContentDiff `gorm:"type:json" json:"diff"`
+	CreatedAt time.Time   `json:"createdAt"`
+}
+
+// ContentDiff describes what changed between two content versions
+type ContentDiff struct {
+	FromVersionID    *uint `json:"fromVersionId"`
+	TextChanged      bool  `json:"textChanged"`
+	StructureChanged bool  `json:"structureChanged"`
+	LinesAdded       int   `json:"linesAdded"`
+	LinesRemoved     int   `json:"linesRemoved"`
+	// TextDiff is a unified diff of the visible text, one line per block element
+	TextDiff        string   `json:"textDiff"`
+	HeadingsAdded   []string `json:"headingsAdded"`
+	HeadingsRemoved []string `json:"headingsRemoved"`
+	LinksAdded      []string `json:"linksAdded"`
+	LinksRemoved    []string `json:"linksRemoved"`
+}
+
+// Value implements the driver.Valuer interface for database saving
+func (cd ContentDiff) Value() (driver.Value, error) {
+	return json.Marshal(cd)
+}
+
+// Scan implements the sql.Scanner interface for database loading
+func (cd *ContentDiff) Scan(value interface{}) error {
+	if value == nil {
+		*cd = ContentDiff{}
+		return nil
+	}
+	return scanJSON(value, cd)
+}
+
+// GormDBDataType implements the migrator.GormDataTypeInterface for the column type of each database
+func (cd ContentDiff) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDataType(db)
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// CrawlAttempt is the outcome of one run of an analysis
+type CrawlAttempt struct {
+	Attempt       int       `json:"attempt"`
+	StartedAt     time.Time `json:"startedAt"`
+	FinishedAt    time.Time `json:"finishedAt"`
+	Status        string    `json:"status"`
+	StatusCode    int       `json:"statusCode,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	ErrorCategory string    `json:"errorCategory,omitempty"`
+	// Retryable is set for failures classified as transient
+	Retryable bool `json:"retryable,omitempty"`
+	// SnapshotID is the archived raw crawl of this run, when archiving is on
+	SnapshotID *uint `json:"snapshotId,omitempty"`
+	// ContentHash is the hash of the normalised text the run found
+	ContentHash string `json:"contentHash,omitempty"`
+}
+
+// CrawlAttempts is the attempt history of an analysis, stored as a JSON column
+type CrawlAttempts []CrawlAttempt
+
+// Value implements the driver.Valuer interface for database saving
+func (ca CrawlAttempts) Value() (driver.Value, error) {
+	if ca == nil {
+		return nil, nil
+	}
+	return json.Marshal(ca)
+}
+
+// Scan implements the sql.Scanner interface for database loading
+func (ca *CrawlAttempts) Scan(value interface{}) error {
+	if value == nil {
+		*ca = CrawlAttempts{}
+		return nil
+	}
+	return scanJSON(value, ca)
+}
+
+// GormDBDataType implements the migrator.GormDataTypeInterface for the column type of each database
+func (ca CrawlAttempts) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDataType(db)
+}
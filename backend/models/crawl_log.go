@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// CrawlLogEntry is one log line of an analysis run, kept so users can see why a crawl failed.
+// Entries are replaced every time the analysis runs again.
+type CrawlLogEntry struct {
+	ID            uint      `gorm:"primarykey" json:"id"`
+	URLAnalysisID uint      `gorm:"index;not null" json:"urlAnalysisId"`
+	RequestID     string    `gorm:"size:128" json:"requestId,omitempty"`
+	Level         string    `gorm:"size:10" json:"level"`
+	Message       string    `gorm:"type:text" json:"message"`
+	Fields        StringMap `gorm:"type:json" json:"fields,omitempty"`
+	CreatedAt     time.Time `json:"time"`
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+	"web-scraper/secrets"
+
+	"gorm.io/gorm"
+)
+
+// CrawlProfile holds what the crawler needs to fetch pages behind a login.
+// A profile is used when an analysis references it, or when the analysed host matches Site.
+type CrawlProfile struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deletedAt,omitempty"` // For soft delete
+
+	UserID string `gorm:"size:255;index;not null" json:"userId"`
+	Name   string `gorm:"size:100;not null" json:"name"`
+	// Site is the host the profile applies to, subdomains included e.g. "example.com" also matches "www.example.com"
+	Site string `gorm:"size:255;index" json:"site"`
+
+	// crawler identity, sent with every request of the crawl whatever the host
+	UserAgent      string    `gorm:"size:512" json:"userAgent"`
+	AcceptLanguage string    `gorm:"size:100" json:"acceptLanguage"`
+	ExtraHeaders   StringMap `gorm:"type:json" json:"extraHeaders"`
+	// route the crawl through a proxy of the CRAWL_PROXY_POOL
+	UseProxyPool bool `gorm:"default:false" json:"useProxyPool"`
+
+	// encrypted at rest, never serialised in API responses
+	Credentials CrawlCredentials `gorm:"type:text" json:"-"`
+}
+
+// CrawlCredentials are the secrets of a crawl profile, all of them optional
+type CrawlCredentials struct {
+	Headers   map[string]string `json:"headers,omitempty"`
+	Cookies   []ProfileCookie   `json:"cookies,omitempty"`
+	BasicAuth *BasicAuth        `json:"basicAuth,omitempty"`
+	FormLogin *FormLogin        `json:"formLogin,omitempty"`
+}
+
+type ProfileCookie struct {
+	Name  string `json:"name" binding:"required"`
+	Value string `json:"value"`
+	Path  string `json:"path,omitempty"`
+}
+
+type BasicAuth struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password"`
+}
+
+// FormLogin is a scripted login step run before the page is crawled. The login page is fetched,
+// hidden inputs of the form (e.g. CSRF tokens) are kept and Fields are posted to the form action.
+type FormLogin struct {
+	PageURL string `json:"pageUrl" binding:"required,url"`
+	// defaults to the first form with a password input
+	FormSelector string            `json:"formSelector,omitempty"`
+	Fields       map[string]string `json:"fields" binding:"required"`
+}
+
+func (cc CrawlCredentials) IsEmpty() bool {
+	return len(cc.Headers) == 0 && len(cc.Cookies) == 0 && cc.BasicAuth == nil && cc.FormLogin == nil
+}
+
+// Value implements the driver.Valuer interface, credentials are stored encrypted
+func (cc CrawlCredentials) Value() (driver.Value, error) {
+	if cc.IsEmpty() {
+		return nil, nil // identity only profiles don't need the secrets key
+	}
+	plaintext, err := json.Marshal(cc)
+	if err != nil {
+		return nil, err
+	}
+	return secrets.Encrypt(plaintext)
+}
+
+// Scan implements the sql.Scanner interface, credentials are decrypted on load
+func (cc *CrawlCredentials) Scan(value interface{}) error {
+	if value == nil {
+		*cc = CrawlCredentials{}
+		return nil
+	}
+
+	var ciphertext string
+	switch v := value.(type) {
+	case []byte:
+		ciphertext = string(v)
+	case string:
+		ciphertext = v
+	default:
+		return errors.New("unsupported type for CrawlCredentials scanning")
+	}
+
+	plaintext, err := secrets.Decrypt(ciphertext)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plaintext, cc)
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"web-scraper/secrets"
+)
+
+// EncryptedString is a secret stored encrypted with CRAWL_SECRETS_KEY, e.g. a webhook signing secret
+type EncryptedString string
+
+// Value implements the driver.Valuer interface, the string is stored encrypted
+func (es EncryptedString) Value() (driver.Value, error) {
+	return secrets.Encrypt([]byte(es))
+}
+
+// Scan implements the sql.Scanner interface, the string is decrypted on load
+func (es *EncryptedString) Scan(value interface{}) error {
+	if value == nil {
+		*es = ""
+		return nil
+	}
+
+	var ciphertext string
+	switch v := value.(type) {
+	case []byte:
+		ciphertext = string(v)
+	case string:
+		ciphertext = v
+	default:
+		return errors.New("unsupported type for EncryptedString scanning")
+	}
+
+	plaintext, err := secrets.Decrypt(ciphertext)
+	if err != nil {
+		return err
+	}
+	*es = EncryptedString(plaintext)
+	return nil
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// FrameAnalysis holds the analysis of a document loaded through an iframe of the crawled page
+type FrameAnalysis struct {
+	URL               string `json:"url"`
+	ParentURL         string `json:"parentUrl"`
+	Depth             int    `json:"depth"`
+	CrossOrigin       bool   `json:"crossOrigin"`
+	PageTitle         string `json:"pageTitle"`
+	H1Count           int    `json:"h1Count"`
+	H2Count           int    `json:"h2Count"`
+	H3Count           int    `json:"h3Count"`
+	H4Count           int    `json:"h4Count"`
+	H5Count           int    `json:"h5Count"`
+	H6Count           int    `json:"h6Count"`
+	InternalLinkCount int    `json:"internalLinkCount"`
+	ExternalLinkCount int    `json:"externalLinkCount"`
+	HasLoginForm      bool   `json:"hasLoginForm"`
+	LoginType         string `json:"loginType,omitempty"`
+	ErrorMessage      string `json:"err_message,omitempty"`
+}
+
+type FrameAnalyses []FrameAnalysis
+
+// Value implements the driver.Valuer interface for database saving
+func (fa FrameAnalyses) Value() (driver.Value, error) {
+	if fa == nil {
+		return nil, nil
+	}
+	return json.Marshal(fa)
+}
+
+// Scan implements the sql.Scanner interface for database loading
+func (fa *FrameAnalyses) Scan(value interface{}) error {
+	if value == nil {
+		*fa = FrameAnalyses{}
+		return nil
+	}
+	return scanJSON(value, fa)
+}
+
+// GormDBDataType implements the migrator.GormDataTypeInterface for the column type of each database
+func (fa FrameAnalyses) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDataType(db)
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// scanJSON decodes a JSON column value loaded from the database into dest
+func scanJSON(value interface{}, dest interface{}) error {
+	var byteSlice []byte
+	switch v := value.(type) {
+	case []byte:
+		byteSlice = v
+	case string:
+		byteSlice = []byte(v)
+	default:
+		return errors.New("unsupported type for JSON column scanning")
+	}
+	return json.Unmarshal(byteSlice, dest)
+}
+
+// jsonDataType is the column type of JSON values in the database of db, it turns the type:json of the
+// model tags into jsonb on PostgreSQL
+func jsonDataType(db *gorm.DB) string {
+	if db.Dialector.Name() == "postgres" {
+		return "JSONB"
+	}
+	return "JSON"
+}
+
+// blobDataType is the column type of binary values up to 16MB in the database of db
+func blobDataType(db *gorm.DB) string {
+	switch db.Dialector.Name() {
+	case "mysql":
+		return "MEDIUMBLOB"
+	case "postgres":
+		return "BYTEA"
+	}
+	return "BLOB"
+}
+
+// LongText is a text column holding up to 16MB on MySQL, where TEXT stops at 64KB
+type LongText string
+
+// GormDBDataType implements the migrator.GormDataTypeInterface for the column type of each database
+func (LongText) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	if db.Dialector.Name() == "mysql" {
+		return "MEDIUMTEXT"
+	}
+	return "TEXT"
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// LoginEvidence is a single signal that contributed to a login detection
+type LoginEvidence struct {
+	Signal string `json:"signal"`
+	Detail string `json:"detail"`
+	Score  int    `json:"score"`
+	// Frame is the iframe URL the signal was found in, empty for the crawled page itself
+	Frame string `json:"frame,omitempty"`
+}
+
+// LoginDetection is the scored result of looking for login and authentication forms on a page
+type LoginDetection struct {
+	Detected bool            `json:"detected"`
+	Type     string          `json:"type"` // password, identifier-first, sso, webauthn or none
+	Score    int             `json:"score"`
+	Evidence []LoginEvidence `json:"evidence"`
+}
+
+// Value implements the driver.Valuer interface for database saving
+func (ld LoginDetection) Value() (driver.Value, error) {
+	return json.Marshal(ld)
+}
+
+// Scan implements the sql.Scanner interface for database loading
+func (ld *LoginDetection) Scan(value interface{}) error {
+	if value == nil {
+		*ld = LoginDetection{}
+		return nil
+	}
+	return scanJSON(value, ld)
+}
+
+// GormDBDataType implements the migrator.GormDataTypeInterface for the column type of each database
+func (ld LoginDetection) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDataType(db)
+}
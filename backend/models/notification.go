@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// NotificationChannel is where a user's notifications go: an email address, or a Slack compatible or
+// Microsoft Teams incoming webhook
+type NotificationChannel struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deletedAt,omitempty"` // For soft delete
+
+	UserID string `gorm:"size:255;index;not null" json:"userId"`
+	Name   string `gorm:"size:100;not null" json:"name"`
+	// Type is "email", "slack" or "teams"
+	Type string `gorm:"size:20;not null" json:"type"`
+	// Target is the recipient address of email channels or the incoming webhook URL of chat channels,
+	// encrypted at rest as chat webhook URLs are credentials
+	Target EncryptedString `gorm:"type:text" json:"-"`
+
+	// email channels only receive notifications once the recipient followed the link of the confirmation
+	// email, ConfirmedAt is nil until then. Only the hash of the link token is stored.
+	ConfirmedAt           *time.Time `json:"confirmedAt"`
+	ConfirmationTokenHash string     `gorm:"size:64;index" json:"-"`
+	ConfirmationSentAt    *time.Time `json:"-"`
+
+	// outcome of the last notification sent, for spotting broken channels
+	LastSentAt *time.Time `json:"lastSentAt"`
+	LastError  string     `gorm:"size:1024" json:"lastError"`
+}
+
+// NotificationRule sends a message to a channel when one of its triggers fires for an analysis of the user
+type NotificationRule struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deletedAt,omitempty"` // For soft delete
+
+	UserID    string `gorm:"size:255;index;not null" json:"userId"`
+	Name      string `gorm:"size:100;not null" json:"name"`
+	ChannelID uint   `gorm:"index;not null" json:"channelId"`
+	// Triggers are the conditions notified about, e.g. "brokenlinks.gained"
+	Triggers StringList `gorm:"type:json" json:"triggers"`
+	// URLPattern limits the rule to analysed URLs containing it, every analysis of the user matches when empty
+	URLPattern string `gorm:"size:2048" json:"urlPattern"`
+	// text/template overrides of the default subject and body of the trigger
+	SubjectTemplate string `gorm:"size:512" json:"subjectTemplate"`
+	BodyTemplate    string `gorm:"type:text" json:"bodyTemplate"`
+	Active          bool   `gorm:"default:true" json:"active"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ResponseMetadata describes how the analysed page answered, redirects included
+type ResponseMetadata struct {
+	StatusCode int `json:"statusCode"`
+	// FinalURL is the URL the page was served from after following redirects
+	FinalURL  string     `json:"finalUrl"`
+	Redirects []Redirect `json:"redirects"`
+	// Headers holds the response headers of interest (content type, caching, server, security headers)
+	Headers StringMap `json:"headers"`
+	// BodySize is the number of body bytes read, ContentLength what the server announced (-1 when unknown)
+	BodySize      int64          `json:"bodySize"`
+	ContentLength int64          `json:"contentLength"`
+	Timing        ResponseTiming `json:"timing"`
+}
+
+// Redirect is one hop of the redirect chain
+type Redirect struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"statusCode"`
+	Location   string `json:"location"`
+}
+
+// ResponseTiming breaks down the request of the final page in milliseconds, phases of a reused
+// connection are 0. Total runs from the first request of the redirect chain to the end of the body.
+type ResponseTiming struct {
+	DNSMs     float64 `json:"dnsMs"`
+	ConnectMs float64 `json:"connectMs"`
+	TLSMs     float64 `json:"tlsMs"`
+	TTFBMs    float64 `json:"ttfbMs"`
+	TotalMs   float64 `json:"totalMs"`
+}
+
+// Value implements the driver.Valuer interface for database saving
+func (rm ResponseMetadata) Value() (driver.Value, error) {
+	return json.Marshal(rm)
+}
+
+// Scan implements the sql.Scanner interface for database loading
+func (rm *ResponseMetadata) Scan(value interface{}) error {
+	if value == nil {
+		*rm = ResponseMetadata{}
+		return nil
+	}
+	return scanJSON(value, rm)
+}
+
+// GormDBDataType implements the migrator.GormDataTypeInterface for the column type of each database
+func (rm ResponseMetadata) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDataType(db)
+}
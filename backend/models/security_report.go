@@ -0,0 +1,83 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// SecurityReport is the security posture of the analysed page: its security headers, cookie flags,
+// TLS connection and mixed content, with the problems found summed up in Findings
+type SecurityReport struct {
+	Headers []SecurityHeader `json:"headers"`
+	Cookies []CookieFlags    `json:"cookies"`
+	// TLS is nil when the page was served over plain http
+	TLS          *TLSDetails       `json:"tls"`
+	MixedContent []MixedContent    `json:"mixedContent"`
+	Findings     []SecurityFinding `json:"findings"`
+}
+
+// SecurityHeader is one of the checked response headers, Value is empty when it is missing
+type SecurityHeader struct {
+	Name    string `json:"name"`
+	Present bool   `json:"present"`
+	Value   string `json:"value"`
+}
+
+// CookieFlags are the attributes of a cookie set by the page or one of its redirects
+type CookieFlags struct {
+	Name     string `json:"name"`
+	Secure   bool   `json:"secure"`
+	HttpOnly bool   `json:"httpOnly"`
+	SameSite string `json:"sameSite"` // Strict, Lax, None or empty when not set
+}
+
+// TLSDetails describes the connection the page was served over and its leaf certificate
+type TLSDetails struct {
+	Version         string    `json:"version"`
+	CipherSuite     string    `json:"cipherSuite"`
+	Subject         string    `json:"subject"`
+	Issuer          string    `json:"issuer"`
+	NotAfter        time.Time `json:"notAfter"`
+	DaysUntilExpiry int       `json:"daysUntilExpiry"`
+	DNSNames        []string  `json:"dnsNames"`
+	// HostnameMatch tells whether the certificate is valid for the host of the final URL
+	HostnameMatch bool `json:"hostnameMatch"`
+}
+
+// MixedContent is a resource loaded over http by a page served over https. Active content
+// (scripts, stylesheets, frames) is blocked by browsers, passive content (images, media) is not.
+type MixedContent struct {
+	URL     string `json:"url"`
+	Element string `json:"element"`
+	Active  bool   `json:"active"`
+}
+
+// SecurityFinding is a problem found by the security checks
+type SecurityFinding struct {
+	Check    string `json:"check"`    // e.g. "hsts", "cookie-secure", "certificate-expiry"
+	Severity string `json:"severity"` // high, medium, low or info
+	Message  string `json:"message"`
+}
+
+// Value implements the driver.Valuer interface for database saving
+func (sr SecurityReport) Value() (driver.Value, error) {
+	return json.Marshal(sr)
+}
+
+// Scan implements the sql.Scanner interface for database loading
+func (sr *SecurityReport) Scan(value interface{}) error {
+	if value == nil {
+		*sr = SecurityReport{}
+		return nil
+	}
+	return scanJSON(value, sr)
+}
+
+// GormDBDataType implements the migrator.GormDataTypeInterface for the column type of each database
+func (sr SecurityReport) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDataType(db)
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Snapshot is the raw capture of an analysis run: the HTTP exchanges of the page fetch, redirects
+// included, and optionally its resources, stored as a WARC file in the blob store
+type Snapshot struct {
+	ID            uint   `gorm:"primarykey" json:"id"`
+	URLAnalysisID uint   `gorm:"index;not null" json:"urlAnalysisId"`
+	Attempt       int    `json:"attempt"`
+	URL           string `gorm:"type:text" json:"url"`
+	// BlobKey is where the WARC file is kept, e.g. "snapshots/12/20250101T101010Z.warc.gz"
+	BlobKey   string    `gorm:"size:512;not null" json:"-"`
+	Size      int64     `json:"size"`
+	Records   int       `json:"records"`
+	Resources int       `json:"resources"`
+	Truncated bool      `json:"truncated"`
+	CreatedAt time.Time `json:"createdAt"`
+}
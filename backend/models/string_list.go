@@ -0,0 +1,34 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// StringList is a []string stored as a JSON column
+type StringList []string
+
+// Value implements the driver.Valuer interface for database saving
+func (sl StringList) Value() (driver.Value, error) {
+	if sl == nil {
+		return nil, nil
+	}
+	return json.Marshal(sl)
+}
+
+// Scan implements the sql.Scanner interface for database loading
+func (sl *StringList) Scan(value interface{}) error {
+	if value == nil {
+		*sl = StringList{}
+		return nil
+	}
+	return scanJSON(value, sl)
+}
+
+// GormDBDataType implements the migrator.GormDataTypeInterface for the column type of each database
+func (sl StringList) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDataType(db)
+}
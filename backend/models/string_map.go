@@ -0,0 +1,34 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// StringMap is a map[string]string stored as a JSON column
+type StringMap map[string]string
+
+// Value implements the driver.Valuer interface for database saving
+func (sm StringMap) Value() (driver.Value, error) {
+	if sm == nil {
+		return nil, nil
+	}
+	return json.Marshal(sm)
+}
+
+// Scan implements the sql.Scanner interface for database loading
+func (sm *StringMap) Scan(value interface{}) error {
+	if value == nil {
+		*sm = StringMap{}
+		return nil
+	}
+	return scanJSON(value, sm)
+}
+
+// GormDBDataType implements the migrator.GormDataTypeInterface for the column type of each database
+func (sm StringMap) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDataType(db)
+}
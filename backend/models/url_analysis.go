@@ -3,10 +3,10 @@ package models
 import (
 	"database/sql/driver"
 	"encoding/json"
-	"errors"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
 type BrokenLinks []BrokenLink
@@ -25,16 +25,12 @@ func (bl *BrokenLinks) Scan(value interface{}) error {
 		*bl = BrokenLinks{} // Ensure it's an empty slice, not nil, when DB value is NULL
 		return nil
 	}
-	var byteSlice []byte
-	switch v := value.(type) {
-	case []byte:
-		byteSlice = v
-	case string:
-		byteSlice = []byte(v)
-	default:
-		return errors.New("unsupported type for BrokenLinks scanning")
-	}
-	return json.Unmarshal(byteSlice, bl) // Unmarshal from JSON bytes
+	return scanJSON(value, bl)
+}
+
+// GormDBDataType implements the migrator.GormDataTypeInterface for the column type of each database
+func (bl BrokenLinks) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDataType(db)
 }
 
 type URLAnalysis struct {
@@ -43,8 +39,16 @@ type URLAnalysis struct {
 	UpdatedAt time.Time      `json:"updatedAt"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deletedAt,omitempty"` // For soft delete
 
-	URL    string `gorm:"unique;not null;size:255" json:"url"`
+	// unique per user, every user has analyses of their own
+	URL    string `gorm:"uniqueIndex:idx_url_analyses_user_url,priority:2;not null;size:255" json:"url"`
 	Status string `gorm:"default:'queued';size:20" json:"status"`
+	// priority lane of the last submission: interactive, bulk or scheduled
+	Lane string `gorm:"default:'interactive';size:20" json:"lane"`
+
+	// user the analysis belongs to, their crawl profiles are the ones considered for it
+	UserID string `gorm:"size:255;index;uniqueIndex:idx_url_analyses_user_url,priority:1" json:"userId"`
+	// explicit crawl profile, when nil a profile of the user matching the host is used if any
+	CrawlProfileID *uint `gorm:"index" json:"crawlProfileId"`
 
 	// crawler data
 	HTMLVersion           string      `gorm:"size:50" json:"htmlVersion"`
@@ -60,10 +64,58 @@ type URLAnalysis struct {
 	InaccessibleLinkCount int         `gorm:"default:0" json:"inaccessibleLinkCount"`
 	BrokenLinks           BrokenLinks `gorm:"type:json" json:"brokenLinks"`
 	HasLoginForm          bool        `gorm:"default:false" json:"hasLoginForm"`
+	// what kind of login was found and why, HasLoginForm mirrors LoginDetection.Detected
+	LoginDetection LoginDetection `gorm:"type:json" json:"loginDetection"`
+
+	// analysis of documents embedded through iframes, only filled when iframe crawling is enabled
+	Frames FrameAnalyses `gorm:"type:json" json:"frames"`
+
+	// links actually checked, lower than the links found when a crawl budget ran out
+	CheckedLinkCount int `gorm:"default:0" json:"checkedLinkCount"`
+	// why a "partial" analysis is incomplete, e.g. the link check budget ran out
+	PartialReasons StringList `gorm:"type:json" json:"partialReasons"`
+
+	// retries: runs since the last submission, the error of the last failed run and when the next retry is due
+	Attempts       int           `gorm:"default:0" json:"attempts"`
+	LastError      string        `gorm:"type:text" json:"lastError"`
+	NextRetryAt    *time.Time    `json:"nextRetryAt"`
+	AttemptHistory CrawlAttempts `gorm:"type:json" json:"attemptHistory"`
+
+	// why the last run failed, one of the crawl error categories such as "dns" or "http_4xx", empty on success
+	ErrorCategory string `gorm:"size:50" json:"errorCategory"`
+	// status, final URL, redirect chain, headers of interest, size and timing of the page response
+	Response ResponseMetadata `gorm:"type:json" json:"response"`
+
+	// security headers, cookie flags, TLS details and mixed content of the page, with the findings
+	Security SecurityReport `gorm:"type:json" json:"security"`
+
+	// visible text of the page: word count, language, readability, text to HTML ratio and keywords
+	WordCount int             `gorm:"default:0" json:"wordCount"`
+	Content   ContentAnalysis `gorm:"type:json" json:"content"`
+	// MainContent is the extracted main text, only kept with CRAWL_STORE_CONTENT and left out of the list API
+	MainContent CompressedText `json:"mainContent,omitempty"`
+
+	// SnapshotID is the newest archived raw crawl, see Snapshot
+	SnapshotID *uint `json:"snapshotId"`
+	// ReprocessedAt is when the page analysis last ran again on the snapshot, without refetching
+	ReprocessedAt *time.Time `json:"reprocessedAt"`
+
+	// hashes of the normalised text and of the headings and links of the last crawl, see ContentVersion
+	ContentHash   string `gorm:"size:64" json:"contentHash"`
+	StructureHash string `gorm:"size:64" json:"structureHash"`
+	// ContentChangedAt is when a crawl last found the content different from the previous version
+	ContentChangedAt *time.Time `json:"contentChangedAt"`
+
+	// lease of a running analysis: the server process crawling it, which renews it until LeaseExpiresAt.
+	// Running analyses whose lease expired were left behind by a process that is gone.
+	LeaseOwner     string     `gorm:"size:64" json:"-"`
+	LeaseExpiresAt *time.Time `gorm:"index" json:"-"`
 }
 
 type BrokenLink struct {
 	URL          string `json:"url"`
 	StatusCode   int    `json:"status"`
 	ErrorMessage string `json:"err_message,omitempty"`
+	// Frame is the iframe URL the link was found in, empty for links of the crawled page itself
+	Frame string `json:"frame,omitempty"`
 }
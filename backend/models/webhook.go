@@ -0,0 +1,103 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Webhook is a subscription of a user to analysis events, every matching event is posted to URL
+// signed with Secret
+type Webhook struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deletedAt,omitempty"` // For soft delete
+
+	UserID string `gorm:"size:255;index;not null" json:"userId"`
+	URL    string `gorm:"size:2048;not null" json:"url"`
+	// Events are the event types delivered, e.g. "analysis.completed"
+	Events StringList `gorm:"type:json" json:"events"`
+	Active bool       `gorm:"default:true" json:"active"`
+
+	// encrypted at rest, only returned when the webhook is created
+	Secret EncryptedString `gorm:"type:text" json:"-"`
+}
+
+// Subscribed reports whether the webhook delivers events of type eventType
+func (w Webhook) Subscribed(eventType string) bool {
+	for _, event := range w.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// delivery statuses, dead deliveries ran out of attempts and form the dead letter list
+const (
+	DeliveryPending   = "pending"
+	DeliveryRetrying  = "retrying"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookDelivery is an event sent, or still to be sent, to a webhook with the log of its attempts
+type WebhookDelivery struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	WebhookID  uint   `gorm:"index;not null" json:"webhookId"`
+	UserID     string `gorm:"size:255;index;not null" json:"userId"`
+	EventID    string `gorm:"size:36;index" json:"eventId"`
+	EventType  string `gorm:"size:50" json:"eventType"`
+	AnalysisID uint   `gorm:"index" json:"analysisId"`
+	// Payload is the JSON body posted, the same for every attempt
+	Payload LongText `json:"payload"`
+
+	Status        string           `gorm:"size:20;index" json:"status"`
+	Attempts      int              `gorm:"default:0" json:"attempts"`
+	NextAttemptAt *time.Time       `json:"nextAttemptAt"`
+	DeliveredAt   *time.Time       `json:"deliveredAt"`
+	AttemptLog    DeliveryAttempts `gorm:"type:json" json:"attemptLog"`
+}
+
+// DeliveryAttempt is the outcome of one POST of a delivery
+type DeliveryAttempt struct {
+	Attempt    int       `json:"attempt"`
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+	// the start of the response body, for debugging rejected deliveries
+	Response string `json:"response,omitempty"`
+}
+
+// DeliveryAttempts is the attempt log of a delivery, stored as a JSON column
+type DeliveryAttempts []DeliveryAttempt
+
+// Value implements the driver.Valuer interface for database saving
+func (da DeliveryAttempts) Value() (driver.Value, error) {
+	if da == nil {
+		return nil, nil
+	}
+	return json.Marshal(da)
+}
+
+// Scan implements the sql.Scanner interface for database loading
+func (da *DeliveryAttempts) Scan(value interface{}) error {
+	if value == nil {
+		*da = nil
+		return nil
+	}
+	return scanJSON(value, da)
+}
+
+// GormDBDataType implements the migrator.GormDataTypeInterface for the column type of each database
+func (da DeliveryAttempts) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDataType(db)
+}
@@ -0,0 +1,302 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	netURL "net/url"
+	"strings"
+	"sync"
+	"web-scraper/config"
+)
+
+// ErrBlockedDestination is returned for requests to hosts the policy doesn't allow
+var ErrBlockedDestination = errors.New("destination is not allowed")
+
+// ranges never reachable by user submitted URLs on top of the loopback, private and link-local checks of net.IP
+var blockedNets = mustParseCIDRs(
+	"0.0.0.0/8",      // "this" network
+	"100.64.0.0/10",  // carrier-grade NAT
+	"192.0.0.0/24",   // IETF protocol assignments
+	"198.18.0.0/15",  // benchmarking
+	"240.0.0.0/4",    // reserved, broadcast included
+	"64:ff9b::/96",   // NAT64, can embed any IPv4 address
+	"64:ff9b:1::/48", // local-use NAT64
+	"2002::/16",      // 6to4, can embed any IPv4 address
+	"100::/64",       // discard
+	"2001:db8::/32",  // documentation
+	"fec0::/10",      // deprecated site-local
+)
+
+// hostRule matches a hostname, "*.example.com" matches subdomains only. An empty port matches any port.
+type hostRule struct {
+	host     string
+	port     string
+	wildcard bool
+}
+
+func (r hostRule) matches(host, port string) bool {
+	if r.port != "" && r.port != port {
+		return false
+	}
+	if r.wildcard {
+		return strings.HasSuffix(host, "."+r.host)
+	}
+	return host == r.host
+}
+
+// Policy decides which destinations outbound crawler requests may reach.
+// Deny rules win over allow rules, allowed hosts skip the address checks so trusted test hosts keep working.
+type Policy struct {
+	disabled   bool
+	allowHosts []hostRule
+	allowNets  []*net.IPNet
+	denyHosts  []hostRule
+	denyNets   []*net.IPNet
+	// resolves hostnames, net.DefaultResolver unless a test answers itself
+	lookupIPAddr func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+var (
+	defaultPolicy     *Policy
+	defaultPolicyOnce sync.Once
+)
+
+// Default returns the policy configured by SSRF_PROTECTION (default true), SSRF_ALLOW_HOSTS and SSRF_DENY_HOSTS.
+// The lists are comma separated hostnames ("localhost", "*.internal.example.com"), host:port pairs, IPs or CIDRs.
+func Default() *Policy {
+	defaultPolicyOnce.Do(func() {
+		defaultPolicy = NewPolicy(config.GetEnv("SSRF_ALLOW_HOSTS"), config.GetEnv("SSRF_DENY_HOSTS"))
+		defaultPolicy.disabled = !config.GetEnvBool("SSRF_PROTECTION", true)
+		if defaultPolicy.disabled {
+			slog.Warn("SSRF protection is disabled, user submitted URLs can reach internal addresses")
+		}
+	})
+	return defaultPolicy
+}
+
+// Enabled reports whether the policy checks destinations at all, SSRF_PROTECTION=false turns it off
+func (p *Policy) Enabled() bool {
+	return !p.disabled
+}
+
+// NewPolicy builds a policy from comma separated allow and deny lists
+func NewPolicy(allow, deny string) *Policy {
+	p := &Policy{lookupIPAddr: net.DefaultResolver.LookupIPAddr}
+	p.allowHosts, p.allowNets = parseRules(allow)
+	p.denyHosts, p.denyNets = parseRules(deny)
+	return p
+}
+
+func parseRules(list string) ([]hostRule, []*net.IPNet) {
+	var hosts []hostRule
+	var nets []*net.IPNet
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipNet)
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			nets = append(nets, singleIPNet(ip))
+			continue
+		}
+
+		rule := hostRule{host: entry}
+		if host, port, err := net.SplitHostPort(entry); err == nil {
+			rule.host, rule.port = host, port
+		}
+		if strings.HasPrefix(rule.host, "*.") {
+			rule.host, rule.wildcard = strings.TrimPrefix(rule.host, "*."), true
+		}
+		hosts = append(hosts, rule)
+	}
+
+	return hosts, nets
+}
+
+// checkHost applies the hostname rules. trusted means the host is explicitly allowed and its addresses aren't checked.
+func (p *Policy) checkHost(host, port string) (trusted bool, err error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, rule := range p.denyHosts {
+		if rule.matches(host, port) {
+			return false, fmt.Errorf("%w: host %s is denied", ErrBlockedDestination, host)
+		}
+	}
+	for _, rule := range p.allowHosts {
+		if rule.matches(host, port) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CheckIP returns an error for loopback, private, link-local and other internal addresses unless they are allowed
+func (p *Policy) CheckIP(ip net.IP) error {
+	if p.disabled {
+		return nil
+	}
+
+	for _, ipNet := range p.denyNets {
+		if ipNet.Contains(ip) {
+			return fmt.Errorf("%w: address %s is denied", ErrBlockedDestination, ip)
+		}
+	}
+	for _, ipNet := range p.allowNets {
+		if ipNet.Contains(ip) {
+			return nil
+		}
+	}
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s is an internal address", ErrBlockedDestination, ip)
+	}
+	for _, ipNet := range blockedNets {
+		if ipNet.Contains(ip) {
+			return fmt.Errorf("%w: %s is a reserved address", ErrBlockedDestination, ip)
+		}
+	}
+	return nil
+}
+
+// CheckURL validates a URL before it is fetched: http(s) only, host not denied and every resolved address allowed.
+// A host that doesn't resolve fails the check, the lookup error is wrapped so callers can still tell DNS failures apart.
+func (p *Policy) CheckURL(ctx context.Context, u *netURL.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q is not supported", ErrBlockedDestination, u.Scheme)
+	}
+	if p.disabled {
+		return nil
+	}
+
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+
+	trusted, err := p.checkHost(host, port)
+	if err != nil || trusted {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return p.CheckIP(ip)
+	}
+
+	addrs, err := p.lookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%s: %w", host, err)
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("%w: no addresses found for %s", ErrBlockedDestination, host)
+	}
+	for _, addr := range addrs {
+		if err := p.CheckIP(addr.IP); err != nil {
+			return fmt.Errorf("%s: %w", host, err)
+		}
+	}
+	return nil
+}
+
+// ValidateURL parses raw and runs CheckURL on it
+func (p *Policy) ValidateURL(ctx context.Context, raw string) error {
+	u, err := netURL.Parse(raw)
+	if err != nil {
+		return err
+	}
+	return p.CheckURL(ctx, u)
+}
+
+// DialContext wraps dialer so connections only go to allowed addresses. The host is resolved once and the
+// checked address is dialled directly, a DNS answer changing between check and connect (rebinding) can't slip through.
+func (p *Policy) DialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if p.disabled {
+			return dialer.DialContext(ctx, network, address)
+		}
+
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+
+		trusted, err := p.checkHost(host, port)
+		if err != nil {
+			return nil, err
+		}
+		if trusted {
+			return dialer.DialContext(ctx, network, address)
+		}
+
+		addrs, err := p.lookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+		for _, addr := range addrs {
+			if err := p.CheckIP(addr.IP); err != nil {
+				lastErr = err
+				continue
+			}
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr.IP.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no addresses found for %s", host)
+		}
+		return nil, lastErr
+	}
+}
+
+// guardedTransport checks every request, redirects included since each hop is a separate round trip
+type guardedTransport struct {
+	policy *Policy
+	next   http.RoundTripper
+}
+
+func (t *guardedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.policy.CheckURL(req.Context(), req.URL); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+// Transport wraps next so requests to disallowed destinations fail before anything is sent.
+// Requests going through a proxy are only checked here, the dialer sees the proxy address. The proxy resolves the
+// host again, so only proxies refusing internal destinations themselves may be used.
+func (p *Policy) Transport(next http.RoundTripper) http.RoundTripper {
+	return &guardedTransport{policy: p, next: next}
+}
+
+func singleIPNet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
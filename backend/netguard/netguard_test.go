@@ -0,0 +1,308 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	netURL "net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// resolveTo answers lookups from answers, other hosts don't exist
+func resolveTo(answers map[string][]string) func(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		ips, ok := answers[host]
+		if !ok {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		addrs := make([]net.IPAddr, len(ips))
+		for i, ip := range ips {
+			addrs[i] = net.IPAddr{IP: net.ParseIP(ip)}
+		}
+		return addrs, nil
+	}
+}
+
+// rebinding answers the first lookup of every host with first and all later ones with then, the way a
+// DNS rebinding attacker passes the check with a public address and connects to an internal one
+func rebinding(first, then string) func(ctx context.Context, host string) ([]net.IPAddr, error) {
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	return func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		ip := then
+		if !seen[host] {
+			ip = first
+		}
+		seen[host] = true
+		return []net.IPAddr{{IP: net.ParseIP(ip)}}, nil
+	}
+}
+
+func TestCheckIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		allow   string
+		deny    string
+		ip      string
+		blocked bool
+	}{
+		{name: "public IPv4", ip: "93.184.216.34"},
+		{name: "public IPv6", ip: "2606:2800:220:1:248:1893:25c8:1946"},
+		{name: "loopback", ip: "127.0.0.1", blocked: true},
+		{name: "loopback range", ip: "127.10.0.1", blocked: true},
+		{name: "IPv6 loopback", ip: "::1", blocked: true},
+		{name: "RFC1918 10/8", ip: "10.1.2.3", blocked: true},
+		{name: "RFC1918 172.16/12", ip: "172.16.0.1", blocked: true},
+		{name: "RFC1918 192.168/16", ip: "192.168.1.1", blocked: true},
+		{name: "unique local IPv6", ip: "fc00::1", blocked: true},
+		{name: "link-local", ip: "169.254.1.1", blocked: true},
+		{name: "cloud metadata", ip: "169.254.169.254", blocked: true},
+		{name: "IPv6 link-local", ip: "fe80::1", blocked: true},
+		{name: "unspecified", ip: "0.0.0.0", blocked: true},
+		{name: "IPv6 unspecified", ip: "::", blocked: true},
+		{name: "multicast", ip: "224.0.0.1", blocked: true},
+		{name: "carrier-grade NAT", ip: "100.64.0.1", blocked: true},
+		{name: "broadcast", ip: "255.255.255.255", blocked: true},
+		{name: "IPv4-mapped loopback", ip: "::ffff:127.0.0.1", blocked: true},
+		{name: "IPv4-mapped private", ip: "::ffff:10.0.0.1", blocked: true},
+		{name: "IPv4-mapped metadata", ip: "::ffff:169.254.169.254", blocked: true},
+		{name: "IPv4-mapped public", ip: "::ffff:93.184.216.34"},
+		{name: "NAT64 loopback", ip: "64:ff9b::7f00:1", blocked: true},
+		{name: "NAT64 metadata", ip: "64:ff9b::a9fe:a9fe", blocked: true},
+		{name: "local-use NAT64", ip: "64:ff9b:1::a00:1", blocked: true},
+		{name: "6to4 loopback", ip: "2002:7f00:1::1", blocked: true},
+		{name: "6to4 metadata", ip: "2002:a9fe:a9fe::1", blocked: true},
+
+		{name: "allowed range", allow: "10.0.0.0/8", ip: "10.0.0.6"},
+		{name: "allowed address", allow: "169.254.169.254", ip: "169.254.169.254"},
+		{name: "allowed range takes IPv4-mapped addresses", allow: "10.0.0.0/8", ip: "::ffff:10.0.0.6"},
+		{name: "other addresses stay blocked", allow: "10.0.0.0/8", ip: "192.168.1.1", blocked: true},
+		{name: "deny wins over allow", allow: "10.0.0.0/8", deny: "10.0.0.5", ip: "10.0.0.5", blocked: true},
+		{name: "deny of a public range", deny: "93.184.216.0/24", ip: "93.184.216.34", blocked: true},
+		{name: "deny of an IPv4 range takes IPv4-mapped addresses", deny: "93.184.216.0/24", ip: "::ffff:93.184.216.34", blocked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			if ip == nil {
+				t.Fatalf("invalid test address %q", tt.ip)
+			}
+			err := NewPolicy(tt.allow, tt.deny).CheckIP(ip)
+			if tt.blocked && !errors.Is(err, ErrBlockedDestination) {
+				t.Errorf("CheckIP(%s) = %v, want ErrBlockedDestination", tt.ip, err)
+			}
+			if !tt.blocked && err != nil {
+				t.Errorf("CheckIP(%s) = %v, want allowed", tt.ip, err)
+			}
+		})
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	answers := map[string][]string{
+		"example.com":          {"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"},
+		"metadata.example.com": {"169.254.169.254"},
+		"mixed.example.com":    {"93.184.216.34", "10.0.0.1"},
+		"mapped.example.com":   {"::ffff:127.0.0.1"},
+		"nat64.example.com":    {"64:ff9b::a9fe:a9fe"},
+		"empty.example.com":    {},
+		"internal.test":        {"10.0.0.1"},
+		"api.internal.test":    {"10.0.0.2"},
+		"secret.internal.test": {"93.184.216.35"},
+		"localhost":            {"127.0.0.1"},
+	}
+
+	tests := []struct {
+		name    string
+		allow   string
+		deny    string
+		url     string
+		blocked bool
+		// the lookup failed, the error is a DNS error and not a blocked destination
+		dnsError bool
+	}{
+		{name: "public host", url: "https://example.com/page"},
+		{name: "public IP", url: "http://93.184.216.34/"},
+		{name: "unsupported scheme", url: "ftp://example.com/", blocked: true},
+		{name: "file scheme", url: "file:///etc/passwd", blocked: true},
+		{name: "loopback IP", url: "http://127.0.0.1:8080/", blocked: true},
+		{name: "IPv6 loopback IP", url: "http://[::1]/", blocked: true},
+		{name: "IPv4-mapped IP", url: "http://[::ffff:127.0.0.1]/", blocked: true},
+		{name: "metadata IP", url: "http://169.254.169.254/latest/meta-data/", blocked: true},
+		{name: "host resolving to metadata", url: "http://metadata.example.com/", blocked: true},
+		{name: "one internal address of several", url: "http://mixed.example.com/", blocked: true},
+		{name: "host resolving to IPv4-mapped loopback", url: "http://mapped.example.com/", blocked: true},
+		{name: "host resolving to NAT64", url: "http://nat64.example.com/", blocked: true},
+		{name: "host without addresses", url: "http://empty.example.com/", blocked: true},
+		{name: "host that doesn't resolve", url: "http://missing.example.com/", dnsError: true},
+
+		{name: "allowed host skips the address checks", allow: "localhost:8000", url: "http://localhost:8000/"},
+		{name: "allowed host on another port", allow: "localhost:8000", url: "http://localhost:9000/", blocked: true},
+		{name: "default port of the scheme", allow: "localhost:443", url: "https://localhost/"},
+		{name: "wildcard covers subdomains", allow: "*.internal.test", url: "http://api.internal.test/"},
+		{name: "wildcard doesn't cover the domain", allow: "*.internal.test", url: "http://internal.test/", blocked: true},
+		{name: "denied host wins over the allowed wildcard", allow: "*.internal.test", deny: "secret.internal.test", url: "http://secret.internal.test/", blocked: true},
+		{name: "denied host with public addresses", deny: "example.com", url: "https://EXAMPLE.com./", blocked: true},
+		{name: "allowed range", allow: "10.0.0.0/8", url: "http://internal.test/"},
+		{name: "denied host wins over the allowed range", allow: "10.0.0.0/8", deny: "internal.test", url: "http://internal.test/", blocked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := NewPolicy(tt.allow, tt.deny)
+			policy.lookupIPAddr = resolveTo(answers)
+
+			u, err := netURL.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = policy.CheckURL(t.Context(), u)
+
+			var dnsErr *net.DNSError
+			switch {
+			case tt.dnsError:
+				if !errors.As(err, &dnsErr) {
+					t.Errorf("CheckURL(%s) = %v, want the DNS error", tt.url, err)
+				}
+			case tt.blocked:
+				if !errors.Is(err, ErrBlockedDestination) {
+					t.Errorf("CheckURL(%s) = %v, want ErrBlockedDestination", tt.url, err)
+				}
+			case err != nil:
+				t.Errorf("CheckURL(%s) = %v, want allowed", tt.url, err)
+			}
+		})
+	}
+}
+
+func TestDisabledPolicy(t *testing.T) {
+	policy := NewPolicy("", "")
+	policy.disabled = true
+	policy.lookupIPAddr = resolveTo(nil)
+
+	if err := policy.ValidateURL(t.Context(), "http://127.0.0.1/"); err != nil {
+		t.Errorf("ValidateURL of a loopback URL = %v, want allowed with the protection off", err)
+	}
+	if err := policy.ValidateURL(t.Context(), "gopher://example.com/"); !errors.Is(err, ErrBlockedDestination) {
+		t.Errorf("ValidateURL of a gopher URL = %v, want ErrBlockedDestination, the scheme is always checked", err)
+	}
+}
+
+// listen accepts connections on 127.0.0.1 and counts them
+func listen(t *testing.T) (port string, accepted *atomic.Int32) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	accepted = &atomic.Int32{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			conn.Close()
+		}
+	}()
+	_, port, _ = net.SplitHostPort(listener.Addr().String())
+	return port, accepted
+}
+
+func TestDialContext(t *testing.T) {
+	port, _ := listen(t)
+
+	tests := []struct {
+		name    string
+		allow   string
+		deny    string
+		lookup  func(ctx context.Context, host string) ([]net.IPAddr, error)
+		address string
+		blocked bool
+		// any other error than a blocked destination
+		failed bool
+	}{
+		{name: "loopback IP", address: "127.0.0.1", blocked: true},
+		{name: "host resolving to loopback", lookup: resolveTo(map[string][]string{"site.test": {"127.0.0.1"}}), address: "site.test", blocked: true},
+		{name: "host resolving to IPv4-mapped loopback", lookup: resolveTo(map[string][]string{"site.test": {"::ffff:127.0.0.1"}}), address: "site.test", blocked: true},
+		{name: "host resolving to metadata", lookup: resolveTo(map[string][]string{"site.test": {"169.254.169.254"}}), address: "site.test", blocked: true},
+		{name: "host that doesn't resolve", lookup: resolveTo(nil), address: "site.test", failed: true},
+		{name: "denied host", deny: "site.test", lookup: resolveTo(map[string][]string{"site.test": {"127.0.0.1"}}), address: "site.test", blocked: true},
+		{name: "denied address wins over the allowed range", allow: "127.0.0.0/8", deny: "127.0.0.1", address: "127.0.0.1", blocked: true},
+
+		// the checked address is dialled, the resolved one of site.test is the test listener
+		{name: "allowed range", allow: "127.0.0.1", lookup: resolveTo(map[string][]string{"site.test": {"127.0.0.1"}}), address: "site.test"},
+		{name: "blocked addresses are skipped", allow: "127.0.0.1", lookup: resolveTo(map[string][]string{"site.test": {"10.0.0.1", "127.0.0.1"}}), address: "site.test"},
+		{name: "allowed host is dialled by name", allow: "localhost", address: "localhost"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := NewPolicy(tt.allow, tt.deny)
+			if tt.lookup != nil {
+				policy.lookupIPAddr = tt.lookup
+			}
+			dial := policy.DialContext(&net.Dialer{})
+
+			conn, err := dial(t.Context(), "tcp", net.JoinHostPort(tt.address, port))
+			if conn != nil {
+				conn.Close()
+			}
+			switch {
+			case tt.blocked:
+				if !errors.Is(err, ErrBlockedDestination) {
+					t.Errorf("dial %s = %v, want ErrBlockedDestination", tt.address, err)
+				}
+			case tt.failed:
+				if err == nil || errors.Is(err, ErrBlockedDestination) {
+					t.Errorf("dial %s = %v, want a lookup error", tt.address, err)
+				}
+			case err != nil:
+				t.Errorf("dial %s = %v, want connected", tt.address, err)
+			}
+		})
+	}
+}
+
+func TestDNSRebinding(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	// the URL check sees a public address, the connection would go to the internal test server
+	var lookups atomic.Int32
+	answer := rebinding("93.184.216.34", "127.0.0.1")
+	policy := NewPolicy("", "")
+	policy.lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		lookups.Add(1)
+		return answer(ctx, host)
+	}
+
+	client := &http.Client{Transport: policy.Transport(&http.Transport{DialContext: policy.DialContext(&net.Dialer{})})}
+	resp, err := client.Get("http://rebind.test:" + port + "/")
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, ErrBlockedDestination) {
+		t.Errorf("GET after rebinding = %v, want ErrBlockedDestination", err)
+	}
+	if n := lookups.Load(); n != 2 {
+		t.Errorf("%d lookups, want the one of the URL check and the one of the dialer", n)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("internal server got %d requests", n)
+	}
+}
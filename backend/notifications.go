@@ -0,0 +1,509 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	netURL "net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"web-scraper/logging"
+	"web-scraper/models"
+	"web-scraper/netguard"
+	"web-scraper/secrets"
+	"web-scraper/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type NotificationChannelInput struct {
+	Name string `json:"name" binding:"required,max=100"`
+	Type string `json:"type" binding:"required"`
+	// the recipient address of email channels, the incoming webhook URL of slack and teams channels
+	Target string `json:"target" binding:"required,max=2048"`
+}
+
+// validate checks the type and target, webhook URLs are held to the SSRF policy
+func (input NotificationChannelInput) validate(c *gin.Context) bool {
+	if !slices.Contains(services.ChannelTypes, input.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown channel type: " + input.Type, "channelTypes": services.ChannelTypes})
+		return false
+	}
+	target := strings.TrimSpace(input.Target)
+	if err := services.ValidateChannelTarget(input.Type, target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target: " + err.Error()})
+		return false
+	}
+	if input.Type != services.ChannelEmail {
+		if err := netguard.Default().ValidateURL(c.Request.Context(), target); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook URL is not allowed: " + err.Error()})
+			return false
+		}
+	}
+	return true
+}
+
+// applyTo copies everything but the owner onto channel
+func (input NotificationChannelInput) applyTo(channel *models.NotificationChannel) {
+	channel.Name = strings.TrimSpace(input.Name)
+	channel.Type = input.Type
+	channel.Target = models.EncryptedString(strings.TrimSpace(input.Target))
+}
+
+// notificationChannelResponse describes a channel, chat webhook URLs are credentials and only their host is shown
+func notificationChannelResponse(channel models.NotificationChannel) gin.H {
+	target := string(channel.Target)
+	if channel.Type != services.ChannelEmail {
+		if u, err := netURL.Parse(target); err == nil {
+			target = u.Scheme + "://" + u.Host + "/…"
+		}
+	}
+	return gin.H{
+		"id":          channel.ID,
+		"name":        channel.Name,
+		"type":        channel.Type,
+		"target":      target,
+		"confirmed":   !services.NeedsConfirmation(&channel),
+		"confirmedAt": channel.ConfirmedAt,
+		"lastSentAt":  channel.LastSentAt,
+		"lastError":   channel.LastError,
+		"createdAt":   channel.CreatedAt,
+		"updatedAt":   channel.UpdatedAt,
+	}
+}
+
+// requestChannelConfirmation sends the confirmation email of a new or retargeted email channel, a failure
+// shows as the last error of the channel rather than failing the request
+func requestChannelConfirmation(c *gin.Context, db *gorm.DB, channel *models.NotificationChannel) {
+	if err := services.SendChannelConfirmation(db, channel); err != nil {
+		logging.FromContext(c.Request.Context()).Warn("Confirmation email not sent", "channel_id", channel.ID, "error", err)
+	}
+}
+
+// findUserNotificationChannel loads the channel with the id of the request path, making sure it belongs to the caller
+func findUserNotificationChannel(c *gin.Context, db *gorm.DB) (models.NotificationChannel, bool) {
+	var channel models.NotificationChannel
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel ID format"})
+		return channel, false
+	}
+
+	result := db.Where("user_id = ?", c.GetString("UserID")).First(&channel, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notification channel not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification channel: " + result.Error.Error()})
+		}
+		return channel, false
+	}
+
+	return channel, true
+}
+
+func notificationChannelSaveError(c *gin.Context, err error) {
+	if errors.Is(err, secrets.ErrKeyNotConfigured) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Notifications are disabled: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save notification channel: " + err.Error()})
+}
+
+func CreateNotificationChannel(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	var input NotificationChannelInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !input.validate(c) {
+		return
+	}
+
+	channel := models.NotificationChannel{UserID: c.GetString("UserID")}
+	input.applyTo(&channel)
+
+	if err := db.Create(&channel).Error; err != nil {
+		notificationChannelSaveError(c, err)
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Notification channel created", "channel_id", channel.ID, "type", channel.Type)
+	requestChannelConfirmation(c, db, &channel)
+	c.JSON(http.StatusCreated, notificationChannelResponse(channel))
+}
+
+func GetNotificationChannels(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	channels := []models.NotificationChannel{}
+	if err := db.Where("user_id = ?", c.GetString("UserID")).Find(&channels).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch notification channels " + err.Error()})
+		return
+	}
+
+	response := make([]gin.H, 0, len(channels))
+	for _, channel := range channels {
+		response = append(response, notificationChannelResponse(channel))
+	}
+	c.JSON(http.StatusOK, gin.H{"channels": response, "channelTypes": services.ChannelTypes})
+}
+
+// UpdateNotificationChannel replaces the name, type and target of a channel, a new email recipient has to
+// confirm the channel again
+func UpdateNotificationChannel(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	channel, ok := findUserNotificationChannel(c, db)
+	if !ok {
+		return
+	}
+
+	var input NotificationChannelInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !input.validate(c) {
+		return
+	}
+
+	previousType, previousTarget := channel.Type, channel.Target
+	input.applyTo(&channel)
+	channel.LastError = ""
+	retargeted := channel.Type != previousType || channel.Target != previousTarget
+	if retargeted {
+		services.ResetChannelConfirmation(&channel)
+	}
+
+	if err := db.Save(&channel).Error; err != nil {
+		notificationChannelSaveError(c, err)
+		return
+	}
+	if retargeted {
+		requestChannelConfirmation(c, db, &channel)
+	}
+	c.JSON(http.StatusOK, notificationChannelResponse(channel))
+}
+
+// DeleteNotificationChannel removes a channel with the rules sending to it
+func DeleteNotificationChannel(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	channel, ok := findUserNotificationChannel(c, db)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("channel_id = ?", channel.ID).Delete(&models.NotificationRule{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&channel).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete notification channel: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Notification channel deleted", "id": channel.ID})
+}
+
+// TestNotificationChannel sends a sample message through a channel and reports whether it went out. An email
+// channel its recipient didn't confirm yet gets the confirmation email again instead.
+func TestNotificationChannel(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	channel, ok := findUserNotificationChannel(c, db)
+	if !ok {
+		return
+	}
+
+	if services.NeedsConfirmation(&channel) {
+		err := services.SendChannelConfirmation(db, &channel)
+		switch {
+		case errors.Is(err, services.ErrConfirmationRecentlySent):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "The recipient hasn't confirmed the channel yet and " + err.Error()})
+		case err != nil:
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Confirmation email failed: " + err.Error()})
+		default:
+			c.JSON(http.StatusAccepted, gin.H{"message": "The recipient hasn't confirmed the channel yet, the confirmation email was sent again", "id": channel.ID})
+		}
+		return
+	}
+
+	if err := services.SendTestNotification(db, &channel); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Test notification failed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Test notification sent", "id": channel.ID})
+}
+
+// confirmationPage is what the link of a confirmation email opens, a form confirming with a POST so
+// that link scanners of mail providers fetching the link don't confirm in place of the recipient
+var confirmationPage = template.Must(template.New("confirmation").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Confirm notifications</title></head>
+<body>
+<p>{{.Message}}</p>
+{{if .Token}}<form method="post"><input type="hidden" name="token" value="{{.Token}}"><button type="submit">Confirm</button></form>{{end}}
+</body>
+</html>
+`))
+
+func renderConfirmationPage(c *gin.Context, status int, message, token string) {
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	confirmationPage.Execute(c.Writer, gin.H{"Message": message, "Token": token})
+}
+
+// ShowNotificationConfirmation asks the recipient of an email channel to confirm it, it needs no login
+// as recipients don't have to be users
+func ShowNotificationConfirmation(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		renderConfirmationPage(c, http.StatusBadRequest, "The confirmation link is incomplete.", "")
+		return
+	}
+	renderConfirmationPage(c, http.StatusOK, "Confirm to receive notifications about web page analyses at this address.", token)
+}
+
+// ConfirmNotificationChannel confirms an email channel with the token of its confirmation link
+func ConfirmNotificationChannel(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	token := c.PostForm("token")
+	if token == "" {
+		renderConfirmationPage(c, http.StatusBadRequest, "The confirmation link is incomplete.", "")
+		return
+	}
+
+	channel, err := services.ConfirmNotificationChannel(db, token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidConfirmationToken) {
+			renderConfirmationPage(c, http.StatusNotFound, "The confirmation link is invalid, expired or was used already.", "")
+		} else {
+			renderConfirmationPage(c, http.StatusInternalServerError, "The address could not be confirmed, try again later.", "")
+		}
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Notification channel confirmed", "channel_id", channel.ID)
+	renderConfirmationPage(c, http.StatusOK, "Thanks, notifications will be sent to this address.", "")
+}
+
+type NotificationRuleInput struct {
+	Name            string   `json:"name" binding:"required,max=100"`
+	ChannelID       uint     `json:"channelId" binding:"required"`
+	Triggers        []string `json:"triggers" binding:"required,min=1"`
+	URLPattern      string   `json:"urlPattern" binding:"max=2048"`
+	SubjectTemplate string   `json:"subjectTemplate" binding:"max=512"`
+	BodyTemplate    string   `json:"bodyTemplate" binding:"max=10000"`
+	// defaults to true
+	Active *bool `json:"active"`
+}
+
+// validate checks the triggers and templates, and that the channel belongs to the caller
+func (input NotificationRuleInput) validate(c *gin.Context, db *gorm.DB) bool {
+	for _, trigger := range input.Triggers {
+		if !slices.Contains(services.NotificationTriggers, services.NotificationTrigger(trigger)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown trigger: " + trigger, "triggers": services.NotificationTriggers})
+			return false
+		}
+	}
+	if err := services.ValidateNotificationTemplates(input.SubjectTemplate, input.BodyTemplate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template: " + err.Error()})
+		return false
+	}
+
+	var count int64
+	if err := db.Model(&models.NotificationChannel{}).Where("id = ? AND user_id = ?", input.ChannelID, c.GetString("UserID")).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification channel: " + err.Error()})
+		return false
+	}
+	if count == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Notification channel not found"})
+		return false
+	}
+	return true
+}
+
+// applyTo copies everything but the owner onto rule
+func (input NotificationRuleInput) applyTo(rule *models.NotificationRule) {
+	rule.Name = strings.TrimSpace(input.Name)
+	rule.ChannelID = input.ChannelID
+	rule.Triggers = models.StringList{}
+	for _, trigger := range input.Triggers {
+		if !slices.Contains(rule.Triggers, trigger) {
+			rule.Triggers = append(rule.Triggers, trigger)
+		}
+	}
+	rule.URLPattern = strings.TrimSpace(input.URLPattern)
+	rule.SubjectTemplate = input.SubjectTemplate
+	rule.BodyTemplate = input.BodyTemplate
+	rule.Active = input.Active == nil || *input.Active
+}
+
+// findUserNotificationRule loads the rule with the id of the request path, making sure it belongs to the caller
+func findUserNotificationRule(c *gin.Context, db *gorm.DB) (models.NotificationRule, bool) {
+	var rule models.NotificationRule
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID format"})
+		return rule, false
+	}
+
+	result := db.Where("user_id = ?", c.GetString("UserID")).First(&rule, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notification rule not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification rule: " + result.Error.Error()})
+		}
+		return rule, false
+	}
+
+	return rule, true
+}
+
+func CreateNotificationRule(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	var input NotificationRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !input.validate(c, db) {
+		return
+	}
+
+	rule := models.NotificationRule{UserID: c.GetString("UserID")}
+	input.applyTo(&rule)
+
+	if err := db.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save notification rule: " + err.Error()})
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Notification rule created", "rule_id", rule.ID, "channel_id", rule.ChannelID, "triggers", rule.Triggers)
+	c.JSON(http.StatusCreated, rule)
+}
+
+func GetNotificationRules(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	rules := []models.NotificationRule{}
+	if err := db.Where("user_id = ?", c.GetString("UserID")).Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch notification rules " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": rules, "triggers": services.NotificationTriggers})
+}
+
+// UpdateNotificationRule replaces all settings of a rule
+func UpdateNotificationRule(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	rule, ok := findUserNotificationRule(c, db)
+	if !ok {
+		return
+	}
+
+	var input NotificationRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !input.validate(c, db) {
+		return
+	}
+
+	input.applyTo(&rule)
+
+	if err := db.Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save notification rule: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func DeleteNotificationRule(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	rule, ok := findUserNotificationRule(c, db)
+	if !ok {
+		return
+	}
+
+	if err := db.Delete(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete notification rule: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Notification rule deleted", "id": rule.ID})
+}
@@ -0,0 +1,79 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"web-scraper/config"
+)
+
+var ErrKeyNotConfigured = errors.New("CRAWL_SECRETS_KEY is not configured")
+
+// key returns the AES-256 key from CRAWL_SECRETS_KEY, a base64 encoded 32 byte value
+// e.g. generated with `openssl rand -base64 32`
+func key() ([]byte, error) {
+	encoded := config.GetEnv("CRAWL_SECRETS_KEY")
+	if encoded == "" {
+		return nil, ErrKeyNotConfigured
+	}
+
+	k, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("CRAWL_SECRETS_KEY is not valid base64: %w", err)
+	}
+	if len(k) != 32 {
+		return nil, fmt.Errorf("CRAWL_SECRETS_KEY must decode to 32 bytes, got %d", len(k))
+	}
+	return k, nil
+}
+
+func newGCM() (cipher.AEAD, error) {
+	k, err := key()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt seals plaintext with AES-GCM and returns base64(nonce | ciphertext)
+func Encrypt(plaintext []byte) (string, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt
+func Decrypt(ciphertext string) ([]byte, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted value is not valid base64: %w", err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+
+	nonce, data := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, data, nil)
+}
@@ -1,46 +1,36 @@
 package main
 
 import (
-	"fmt"
 	"log"
-	"os"
 	"time"
 
+	"web-scraper/database"
 	"web-scraper/models"
 
 	"github.com/joho/godotenv"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
-func connectMySql() *gorm.DB {
+func connectDB() *gorm.DB {
 	err := godotenv.Load()
 	if err != nil {
 		log.Println("Failed loading env variables. No .env file found")
 	}
 
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbName := os.Getenv("DB_NAME")
-
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", dbUser, dbPassword, dbHost, dbPort, dbName)
-	database, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	db, err := database.Open(database.OptionsFromEnv())
 	if err != nil {
 		log.Fatalf("Failed to connect to DB: %v", err)
 	}
 
-	err = database.AutoMigrate(&models.URLAnalysis{})
-	if err != nil {
-		log.Fatalf("Failed to auto migrate db %v", err)
+	if _, err := database.MigrateUp(db, 0); err != nil {
+		log.Fatalf("Failed to migrate db %v", err)
 	}
 
-	return database
+	return db
 }
 
 func main() {
-	db := connectMySql()
+	db := connectDB()
 
 	sampleData := []models.URLAnalysis{
 		{
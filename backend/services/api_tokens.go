@@ -0,0 +1,55 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+	"web-scraper/models"
+
+	"gorm.io/gorm"
+)
+
+// every API token starts with it, which tells them apart from Auth0 access tokens
+const apiTokenPrefix = "uat_"
+
+// ErrInvalidAPIToken is returned for unknown, revoked and expired API tokens
+var ErrInvalidAPIToken = errors.New("invalid or expired API token")
+
+// IsAPIToken reports whether a bearer token is an API token rather than an Auth0 access token
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, apiTokenPrefix)
+}
+
+// NewAPIToken returns a random token and the hash it is stored and looked up by
+func NewAPIToken() (token, hash string) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	token = apiTokenPrefix + hex.EncodeToString(b)
+	return token, hashAPIToken(token)
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuthenticateAPIToken returns the stored API token matching token and records its use
+func AuthenticateAPIToken(db *gorm.DB, token string) (*models.APIToken, error) {
+	var apiToken models.APIToken
+	if err := db.Where("token_hash = ?", hashAPIToken(token)).Limit(1).Find(&apiToken).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if apiToken.ID == 0 || (apiToken.ExpiresAt != nil && apiToken.ExpiresAt.Before(now)) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	// once a minute is precise enough and spares a write per request
+	if apiToken.LastUsedAt == nil || now.Sub(*apiToken.LastUsedAt) > time.Minute {
+		db.Model(&apiToken).UpdateColumn("last_used_at", now)
+	}
+	return &apiToken, nil
+}
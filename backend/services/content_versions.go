@@ -0,0 +1,125 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"web-scraper/analyser"
+	"web-scraper/config"
+	"web-scraper/models"
+)
+
+// ContentChange is the payload of a content.changed event
+type ContentChange struct {
+	VersionID uint               `json:"versionId"`
+	Diff      models.ContentDiff `json:"diff"`
+}
+
+// contentVersionsToKeep is how many content versions an analysis keeps, CONTENT_VERSIONS_KEEP (default 10)
+func contentVersionsToKeep() int {
+	return config.GetEnvInt("CONTENT_VERSIONS_KEEP", 10)
+}
+
+// recordContentVersion adds a content version of the result of a run when its content differs from
+// the previous one. It returns the new version, nil when the content didn't change.
+func recordContentVersion(ctx context.Context, repo Repository, urlAnalysis *models.URLAnalysis, result *analyser.Result, keep int) (*models.ContentVersion, error) {
+	version := models.ContentVersion{
+		URLAnalysisID: urlAnalysis.ID,
+		Attempt:       urlAnalysis.Attempts,
+		Text:          models.CompressedText(result.Text),
+		Headings:      models.StringList(result.HeadingTexts),
+		Links:         models.StringList(analyser.UniqueLinks(result.Links)),
+		TextHash:      result.ContentHash,
+		StructureHash: result.StructureHash,
+	}
+	if version.Headings == nil {
+		version.Headings = models.StringList{}
+	}
+
+	previous, err := repo.LatestContentVersion(ctx, urlAnalysis.ID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case previous == nil:
+		// first version, nothing to compare with
+	case previous.TextHash == version.TextHash && previous.StructureHash == version.StructureHash:
+		return nil, nil
+	default:
+		version.Diff = DiffContentVersions(*previous, version)
+	}
+
+	if err := repo.AddContentVersion(ctx, &version, keep); err != nil {
+		return nil, err
+	}
+	if version.Diff.FromVersionID != nil {
+		urlAnalysis.ContentChangedAt = &version.CreatedAt
+	}
+	return &version, nil
+}
+
+// DiffContentVersions compares the text, headings and links of two versions
+func DiffContentVersions(from, to models.ContentVersion) models.ContentDiff {
+	diff := models.ContentDiff{
+		FromVersionID:    &from.ID,
+		TextChanged:      from.TextHash != to.TextHash,
+		StructureChanged: from.StructureHash != to.StructureHash,
+	}
+	diff.TextDiff, diff.LinesAdded, diff.LinesRemoved = unifiedDiff(
+		splitTextLines(string(from.Text)), splitTextLines(string(to.Text)),
+		fmt.Sprintf("attempt %d", from.Attempt), fmt.Sprintf("attempt %d", to.Attempt))
+	diff.HeadingsAdded, diff.HeadingsRemoved = setDiff(from.Headings, to.Headings)
+	diff.LinksAdded, diff.LinksRemoved = setDiff(from.Links, to.Links)
+	return diff
+}
+
+func splitTextLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// EnableContentChangeWebhook posts every content.changed event as JSON to CONTENT_CHANGE_WEBHOOK_URL when set
+func EnableContentChangeWebhook() {
+	webhookURL := config.GetEnv("CONTENT_CHANGE_WEBHOOK_URL")
+	if webhookURL == "" {
+		return
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	SubscribeEvents(func(event Event) {
+		if event.Type != EventContentChanged {
+			return
+		}
+		go func() {
+			body, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+			if err != nil {
+				slog.Error("Invalid CONTENT_CHANGE_WEBHOOK_URL", "error", err)
+				return
+			}
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := client.Do(req)
+			if err != nil {
+				slog.Warn("Content change notification failed", "analysis_id", event.AnalysisID, "error", err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				slog.Warn("Content change notification rejected", "analysis_id", event.AnalysisID, "status_code", resp.StatusCode)
+			}
+		}()
+	})
+	slog.Info("Content change notifications enabled")
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"web-scraper/models"
+)
+
+// entries beyond this are counted but not kept, a page with thousands of failing links shouldn't flood the table
+const maxCrawlLogEntries = 500
+
+// crawlLog collects the info and above records of one analysis run for the crawl log API
+type crawlLog struct {
+	mu         sync.Mutex
+	analysisID uint
+	requestID  string
+	entries    []models.CrawlLogEntry
+	dropped    int
+}
+
+func newCrawlLog(analysisID uint, requestID string) *crawlLog {
+	return &crawlLog{analysisID: analysisID, requestID: requestID}
+}
+
+// logger returns a logger writing to next as usual while recording into the crawl log
+func (l *crawlLog) logger(next *slog.Logger) *slog.Logger {
+	return slog.New(&crawlLogHandler{next: next.Handler(), log: l})
+}
+
+func (l *crawlLog) add(r slog.Record, group string) {
+	fields := models.StringMap{}
+	r.Attrs(func(a slog.Attr) bool {
+		addField(fields, group, a)
+		return true
+	})
+	if len(fields) == 0 {
+		fields = nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.entries) >= maxCrawlLogEntries {
+		l.dropped++
+		return
+	}
+	l.entries = append(l.entries, models.CrawlLogEntry{
+		URLAnalysisID: l.analysisID,
+		RequestID:     l.requestID,
+		Level:         r.Level.String(),
+		Message:       r.Message,
+		Fields:        fields,
+		CreatedAt:     r.Time,
+	})
+}
+
+func addField(fields models.StringMap, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	key := a.Key
+	if prefix != "" {
+		key = prefix + "." + key
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, nested := range a.Value.Group() {
+			addField(fields, key, nested)
+		}
+		return
+	}
+	fields[key] = a.Value.String()
+}
+
+// flush replaces the stored log of the analysis with the entries of this run
+func (l *crawlLog) flush(ctx context.Context, repo Repository) error {
+	l.mu.Lock()
+	entries := l.entries
+	if l.dropped > 0 {
+		entries = append(entries, models.CrawlLogEntry{
+			URLAnalysisID: l.analysisID,
+			RequestID:     l.requestID,
+			Level:         slog.LevelWarn.String(),
+			Message:       "crawl log truncated",
+			Fields:        models.StringMap{"dropped": strconv.Itoa(l.dropped)},
+		})
+	}
+	l.mu.Unlock()
+
+	return repo.ReplaceCrawlLog(ctx, l.analysisID, entries)
+}
+
+// crawlLogHandler tees records into a crawlLog. Fields attached with Logger.With (analysis id, url, ...)
+// are the same for the whole run and only go to the server log, entries keep the record's own fields.
+type crawlLogHandler struct {
+	next  slog.Handler
+	log   *crawlLog
+	group string
+}
+
+func (h *crawlLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo || h.next.Enabled(ctx, level)
+}
+
+func (h *crawlLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelInfo {
+		h.log.add(r, h.group)
+	}
+	if !h.next.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *crawlLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &crawlLogHandler{next: h.next.WithAttrs(attrs), log: h.log, group: h.group}
+}
+
+func (h *crawlLogHandler) WithGroup(name string) slog.Handler {
+	group := name
+	if h.group != "" {
+		group = h.group + "." + name
+	}
+	return &crawlLogHandler{next: h.next.WithGroup(name), log: h.log, group: group}
+}
@@ -2,320 +2,251 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"net"
-	"net/http"
-	netURL "net/url"
-	"strings"
-	"sync"
 	"time"
+	"web-scraper/analyser"
+	"web-scraper/logging"
+	"web-scraper/metrics"
 	"web-scraper/models"
 
-	"github.com/gocolly/colly/v2"
-	"gorm.io/gorm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// to cancel a crawl process
-var RunningCrawlContexts sync.Map
-var analysisQueue chan uint
+var tracer = otel.Tracer("web-scraper/services")
 
-const numOfWorkers = 3
+// CrawlAndAnalyseURL runs an analysis with the engine of package analyser and stores its outcome through repo:
+// the result or the error with a retry, the attempt, content version, snapshot and crawl log.
+// Cancelling ctx cancels the analysis, or re-queues it when the cause is ErrShuttingDown.
+func CrawlAndAnalyseURL(ctx context.Context, analysisID uint, repo Repository) {
+	// the database is still written to when the crawl was cancelled
+	dbCtx := context.WithoutCancel(ctx)
 
-func EnqueueURL(id uint) {
-	analysisQueue <- id
-}
-
-func StartWorkers(db *gorm.DB) {
-
-	if analysisQueue == nil {
-		analysisQueue = make(chan uint, 100)
-	}
-
-	for i := range numOfWorkers {
-		go func(workerId int) {
-			for analysisID := range analysisQueue {
-
-				ctx, cancel := context.WithCancel(context.Background())
-
-				log.Printf("Worker %d: Registered context for ID %d.", workerId, analysisID)
-				RunningCrawlContexts.Store(analysisID, cancel)
+	// everything logged from here on also ends up in the crawl log of the analysis
+	crawlLog := newCrawlLog(analysisID, logging.RequestID(ctx))
+	logger := crawlLog.logger(logging.FromContext(ctx))
 
-				CrawlAndAnalyseURL(ctx, analysisID, db)
-
-				cancel()
-				RunningCrawlContexts.Delete(analysisID)
-				log.Printf("Worker %d: Unregistered context for ID %d.", workerId, analysisID)
-			}
-
-		}(i)
+	urlAnalysis, err := repo.LoadAnalysis(dbCtx, analysisID)
+	if err != nil {
+		logger.Error("Couldn't load analysis for crawling", "error", err)
+		return
 	}
-}
 
-func CrawlAndAnalyseURL(ctx context.Context, analysisID uint, db *gorm.DB) {
-	var urlAnalysis models.URLAnalysis
+	logger = logger.With("url", urlAnalysis.URL, "user_id", urlAnalysis.UserID)
+	// the previous result, notification rules compare the new one with it
+	baseline := baselineOf(urlAnalysis)
+	ctx = logging.WithLogger(ctx, logger)
 
-	log.Println("Will crawl soon")
-
-	if err := db.First(&urlAnalysis, analysisID).Error; err != nil {
-		log.Printf("Error: couldn't find url for crawling for %d", analysisID)
-	}
+	// a crawl skipped because another worker runs it leaves that worker's log alone
+	keepLog := true
+	defer func() {
+		if !keepLog {
+			return
+		}
+		if err := crawlLog.flush(dbCtx, repo); err != nil {
+			metrics.DBSaveFailures.WithLabelValues("crawl_log").Inc()
+			logger.Error("Failed to save crawl log", "error", err)
+		}
+	}()
 
 	select {
 	case <-ctx.Done(): // Context already canceled before starting
-		log.Printf("Worker processing URLAnalysis ID: %d - URL: %s was CANCELLED before starting crawl (context done). Status set to cancelled.", analysisID, urlAnalysis.URL)
-		db.Model(&urlAnalysis).Updates(map[string]interface{}{"status": "cancelled", "updated_at": gorm.Expr("NOW()")})
+		if errors.Is(context.Cause(ctx), ErrShuttingDown) {
+			logger.Info("Crawl not started because of shutdown, left queued")
+			return
+		}
+		logger.Warn("Crawl cancelled before it started")
+		metrics.Cancellations.WithLabelValues("queued").Inc()
+		if err := repo.SetStatus(dbCtx, urlAnalysis.ID, "cancelled"); err != nil {
+			metrics.DBSaveFailures.WithLabelValues("cancel").Inc()
+			return
+		}
+		urlAnalysis.Status = "cancelled"
+		publishAnalysisEvents(urlAnalysis)
 		return
 	default: // Context not done yet, proceed
 	}
 
-	if urlAnalysis.Status == "cancelled" { // Defensive check, if DB status was cancelled externally
-		log.Printf("Worker processing URLAnalysis ID: %d - URL: %s is CANCELLED (DB status). Skipping crawl.", analysisID, urlAnalysis.URL)
+	if urlAnalysis.Status == "retrying" { // a retry timer queues it when it is due
+		keepLog = false
+		logger.Debug("Analysis is waiting for its retry, skipping crawl")
 		return
 	}
 
-	// todo: can i make sure if key is matched
-	db.Model(&urlAnalysis).Update("Status", "running")
-
-	c := colly.NewCollector(
-		colly.UserAgent("url-analyser-bot/1.0"),
-		colly.MaxDepth(1), //just vist one link
-	)
-
-	c.SetRequestTimeout(30 * time.Second)
+	if urlAnalysis.Status == "cancelled" { // Defensive check, if DB status was cancelled externally
+		logger.Warn("Analysis is cancelled, skipping crawl")
+		metrics.Cancellations.WithLabelValues("queued").Inc()
+		return
+	}
 
-	// create context aware colly client to cancel crawl requests
-	transport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
-		TLSHandshakeTimeout: 10 * time.Second,
+	// claiming the queued analysis keeps two workers from crawling it at the same time, it may have been queued
+	// twice or cancelled since it was loaded. The lease tells other processes it is crawled by a live one, see
+	// RequeueInterrupted.
+	claimed, err := repo.AcquireLease(dbCtx, urlAnalysis.ID, instanceID, time.Now().Add(leaseDuration))
+	if err != nil {
+		metrics.DBSaveFailures.WithLabelValues("status_running").Inc()
+		logger.Error("Failed to mark analysis running", "error", err)
+		return
 	}
-	httpClientColly := &http.Client{
-		Transport: transport,
-		Timeout:   30 * time.Second,
+	if !claimed {
+		keepLog = false
+		logger.Debug("Analysis isn't queued anymore, skipping crawl")
+		return
 	}
-	c.SetClient(httpClientColly)
-
-	var crawlError error
-
-	c.OnError(func(r *colly.Response, err error) {
-		urlAnalysis.Status = "errored"
-
-		crawlError = fmt.Errorf("HTTP Error %d - %s", r.StatusCode, err.Error())
-
-		log.Printf("Errored Visit onError - %v", crawlError)
-	})
-
-	// refactor to initialize it for update again other the db retains the previous value
-
-	c.OnHTML("title", func(e *colly.HTMLElement) {
-		urlAnalysis.PageTitle = e.Text
-	})
+	stopRenewing := renewLease(dbCtx, repo, urlAnalysis.ID, logger)
+	defer stopRenewing()
 
-	c.OnResponse(func(r *colly.Response) {
-		bodyString := strings.ToLower(string(r.Body))
-		bodyString = strings.TrimSpace(bodyString)
+	startedAt := time.Now()
+	logger.Info("Crawl started")
 
-		if strings.HasPrefix(bodyString, "<!doctype html>") {
-			urlAnalysis.HTMLVersion = "HTML5"
-		} else {
-			urlAnalysis.HTMLVersion = "HTML4.01"
-		}
-		// could ass XHTML etc
-	})
-
-	var h1Count, h2Count, h3Count, h4Count, h5Count, h6Count int
-	var externalLinksCount, internalLinksCount int
-	var allLinks []string
-	var hasLoginForm bool
-
-	c.OnHTML("h1", func(e *colly.HTMLElement) {
-		h1Count++
-	})
-	c.OnHTML("h2", func(e *colly.HTMLElement) {
-		h2Count++
-	})
-
-	c.OnHTML("h3", func(e *colly.HTMLElement) {
-		h3Count++
-	})
-
-	c.OnHTML("h4", func(e *colly.HTMLElement) {
-		h4Count++
-	})
-
-	c.OnHTML("h5", func(e *colly.HTMLElement) {
-		h5Count++
-	})
-
-	c.OnHTML("h6", func(e *colly.HTMLElement) {
-		h6Count++
-	})
-
-	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
-		link := e.Attr("href")
-		absoluteUrl := e.Request.AbsoluteURL(link)
-
-		if absoluteUrl == "" || strings.Contains(absoluteUrl, "#") || strings.HasPrefix(absoluteUrl, "javascript:") {
-			return
-		}
+	archive := loadArchiveOptions()
+	opts := analyser.OptionsFromEnv()
+	opts.Capture = archive.capture
 
-		parsedAbsoluteURL, err := netURL.Parse(absoluteUrl)
-		if err != nil {
-			log.Printf("parsing error for the link %v", parsedAbsoluteURL)
-		}
-
-		if parsedAbsoluteURL.Host == e.Request.URL.Host {
-			internalLinksCount++
-		} else {
-			externalLinksCount++
-		}
-		// could be a channel too to enable stream processing of links like as soon as you found one link starts processing
-		allLinks = append(allLinks, absoluteUrl)
-	})
-
-	c.OnHTML("form:has(input[type=password]), form:has(input[name=password])", func(h *colly.HTMLElement) {
-		// it could miss modern browser login where first you have to enter only email/username e.g disneyplus login form
-		hasLoginForm = true
-	})
-
-	err := c.Visit(urlAnalysis.URL)
-
-	if err != nil {
-		if crawlError == nil {
-			crawlError = fmt.Errorf("visit error %v", err)
-		}
+	var result *analyser.Result
+	if profile, err := repo.CrawlProfile(dbCtx, urlAnalysis); err != nil {
+		result = profileLoadFailure(urlAnalysis.URL, err)
 	} else {
-		log.Printf("Colly visit is completed for %s - %d", urlAnalysis.URL, analysisID)
+		opts.Profile = profile
+		// a crawl that runs out of budget isn't cancelled, it keeps what it has
+		result, _ = analyser.Analyse(ctx, urlAnalysis.URL, opts)
 	}
+	crawlError := result.Err
 
-	var brokenLinks []models.BrokenLink = []models.BrokenLink{}
-	var inaccessibleLinksCount int
-	if crawlError == nil {
-		brokenLinks, inaccessibleLinksCount = checkLinks(ctx, allLinks)
-
-	}
+	urlAnalysis.PartialReasons = models.StringList{}
+	var retryDelay time.Duration
+	// the new content version of a successful crawl, published once the analysis is saved
+	var contentChange *models.ContentVersion
 
 	select {
 	case <-ctx.Done():
-		log.Printf("Worker processing URLAnalysis ID: %d - URL: %s was CANCELLED during crawl or before final save (context done).", analysisID, urlAnalysis.URL)
+		if errors.Is(context.Cause(ctx), ErrShuttingDown) {
+			// checkpoint: results of this run are dropped and the analysis runs again after the restart
+			if err := repo.SetStatus(dbCtx, urlAnalysis.ID, "queued"); err != nil {
+				metrics.DBSaveFailures.WithLabelValues("requeue").Inc()
+				logger.Error("Failed to re-queue crawl interrupted by shutdown", "error", err)
+				return
+			}
+			metrics.Cancellations.WithLabelValues("shutdown").Inc()
+			logger.Warn("Crawl interrupted by shutdown, re-queued")
+			return
+		}
+		logger.Warn("Crawl cancelled while running")
 		urlAnalysis.Status = "cancelled"
 		urlAnalysis.PageTitle = "Crawl cancelled." // Provide a clear title for cancelled state
 		urlAnalysis.BrokenLinks = []models.BrokenLink{}
+		metrics.Cancellations.WithLabelValues("running").Inc()
 	default:
+		urlAnalysis.Attempts++
+		urlAnalysis.NextRetryAt = nil
+		result.ApplyTo(urlAnalysis)
+		attempt := models.CrawlAttempt{Attempt: urlAnalysis.Attempts, StartedAt: startedAt, StatusCode: result.StatusCode}
+
 		if crawlError != nil {
-			urlAnalysis.Status = "errored"
+			failure := analyser.Failure{Category: result.ErrorCategory, Transient: result.Retryable}
+			attempt.Error, attempt.ErrorCategory, attempt.Retryable = crawlError.Error(), failure.Category, failure.Transient
+
+			if retry := loadRetryPolicy(); retry.shouldRetry(failure, urlAnalysis.Attempts) {
+				// rate limited and unavailable pages may say when to come back
+				retryAfter := parseRetryAfter(result.Response.Headers["Retry-After"], time.Now())
+				retryDelay = retry.delayAfter(urlAnalysis.Attempts, retryAfter)
+				nextRetryAt := time.Now().Add(retryDelay)
+				urlAnalysis.Status = "retrying"
+				urlAnalysis.NextRetryAt = &nextRetryAt
+			}
 		} else {
-			urlAnalysis.Status = "done"
-			urlAnalysis.H1Count = h1Count
-			urlAnalysis.H2Count = h2Count
-			urlAnalysis.H3Count = h3Count
-			urlAnalysis.H4Count = h4Count
-			urlAnalysis.H5Count = h5Count
-			urlAnalysis.H6Count = h6Count
-			urlAnalysis.HasLoginForm = hasLoginForm
-			urlAnalysis.InternalLinkCount = internalLinksCount
-			urlAnalysis.ExternalLinkCount = externalLinksCount
-			urlAnalysis.InaccessibleLinkCount = inaccessibleLinksCount
-			urlAnalysis.BrokenLinks = brokenLinks
+			urlAnalysis.ReprocessedAt = nil
+
+			version, err := recordContentVersion(dbCtx, repo, urlAnalysis, result, contentVersionsToKeep())
+			if err != nil {
+				logger.Warn("Failed to record content version", "error", err)
+			} else if version != nil && version.Diff.FromVersionID != nil {
+				contentChange = version
+				logger.Info("Content changed", "version_id", version.ID, "lines_added", version.Diff.LinesAdded, "lines_removed", version.Diff.LinesRemoved)
+			}
+			attempt.ContentHash = urlAnalysis.ContentHash
 		}
-	}
 
-	result := db.Select("*").Save(&urlAnalysis)
-	if result.Error != nil {
-		log.Printf("failed to save entry for  %s - %d - %v", urlAnalysis.URL, analysisID, result.Error)
-	} else {
-		log.Printf("worker is finished processing for  %s - %d - %v", urlAnalysis.URL, analysisID, urlAnalysis)
+		if result.Capture != nil {
+			// stored even when the crawl ran out of budget, with what was fetched
+			archiveCtx, cancelArchive := context.WithTimeout(dbCtx, time.Minute)
+			snapshot, err := saveSnapshot(archiveCtx, repo, urlAnalysis, result.Capture, archive.keep)
+			cancelArchive()
+			if err != nil {
+				logger.Warn("Failed to archive snapshot", "error", err)
+			} else if snapshot != nil {
+				urlAnalysis.SnapshotID = &snapshot.ID
+				attempt.SnapshotID = &snapshot.ID
+				logger.Info("Archived snapshot", "snapshot_id", snapshot.ID, "records", snapshot.Records, "bytes", snapshot.Size)
+			}
+		}
+
+		attempt.Status = urlAnalysis.Status
+		attempt.FinishedAt = time.Now()
+		recordAttempt(urlAnalysis, attempt)
 	}
 
-}
+	// the lease ends with the run
+	urlAnalysis.LeaseOwner, urlAnalysis.LeaseExpiresAt = "", nil
 
-func checkLinks(ctx context.Context, links []string) ([]models.BrokenLink, int) {
+	_, saveSpan := tracer.Start(ctx, "db.Save", trace.WithAttributes(attribute.String("analysis.status", urlAnalysis.Status)))
+	saveErr := repo.SaveAnalysis(dbCtx, urlAnalysis)
+	endSpanWithError(saveSpan, saveErr)
+	saveSpan.End()
 
-	if len(links) == 0 {
-		return []models.BrokenLink{}, 0
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("analysis.status", urlAnalysis.Status))
+	metrics.CrawlDuration.WithLabelValues(urlAnalysis.Status).Observe(time.Since(startedAt).Seconds())
+	if saveErr != nil {
+		metrics.DBSaveFailures.WithLabelValues("final_save").Inc()
+		logger.Error("Failed to save analysis", "status", urlAnalysis.Status, "error", saveErr)
+		return
 	}
 
-	select {
-	case <-ctx.Done():
-		log.Printf("Context cancelled before starting link checks: %v", ctx.Err())
-		return []models.BrokenLink{}, 0
-	default:
+	finished := []any{"status", urlAnalysis.Status, "duration_ms", time.Since(startedAt).Milliseconds()}
+	if urlAnalysis.Status == "retrying" {
+		metrics.RetriesScheduled.Inc()
+		scheduleRetry(repo, urlAnalysis.ID, urlAnalysis.Attempts, retryDelay)
+		logger.Warn("Crawl failed, retry scheduled", append(finished, "error", crawlError, "attempt", urlAnalysis.Attempts, "retry_in", retryDelay.Round(time.Millisecond))...)
+	} else if crawlError != nil && urlAnalysis.Status == "errored" {
+		logger.Error("Crawl failed", append(finished, "error", crawlError)...)
+	} else {
+		if len(result.PartialReasons) > 0 {
+			finished = append(finished, "partial_reasons", result.PartialReasons)
+		}
+		logger.Info("Crawl finished", append(finished, "broken_links", len(result.BrokenLinks))...)
 	}
 
-	linksToCheck := make(chan string, len(links))
-	brokenLinksChan := make(chan models.BrokenLink, len(links))
-
-	var wg sync.WaitGroup
-
-	var linksCheckerWorkers = 20
+	saved := *urlAnalysis
+	go notifyAnalysisResult(baseline, &saved)
 
-	httpClient := &http.Client{
-		Timeout: 5 * time.Second,
+	publishAnalysisEvents(urlAnalysis)
+	if contentChange != nil {
+		publishEvent(analysisEvent(EventContentChanged, urlAnalysis, ContentChange{VersionID: contentChange.ID, Diff: contentChange.Diff}))
 	}
 
-	for range linksCheckerWorkers {
-
-		wg.Add(1)
-
-		go func() {
-			defer wg.Done()
-			for link := range linksToCheck {
-				func(currentLink string) {
-
-					select {
-					case <-ctx.Done():
-						log.Printf("Worker: Context cancelled while checking links. Skipping remaining links.")
-						return // Stop this worker goroutine
-					default:
-					}
-					resp, err := httpClient.Head(currentLink)
-
-					if err != nil {
-						brokenLinksChan <- models.BrokenLink{
-							ErrorMessage: err.Error(),
-							StatusCode:   0,
-							URL:          currentLink,
-						}
-						return
-					}
-
-					defer resp.Body.Close()
-
-					if resp.StatusCode >= 400 {
-						brokenLinksChan <- models.BrokenLink{
-							StatusCode:   resp.StatusCode,
-							ErrorMessage: http.StatusText(resp.StatusCode),
-							URL:          currentLink,
-						}
-					}
-
-				}(link)
-			}
-
-		}()
-	}
+}
 
-	for _, link := range links {
-		linksToCheck <- link
+// profileLoadFailure is the result of an analysis whose crawl profile couldn't be loaded, worth retrying
+func profileLoadFailure(rawURL string, err error) *analyser.Result {
+	return &analyser.Result{
+		URL:           rawURL,
+		Status:        "errored",
+		Err:           fmt.Errorf("failed to load crawl profile %w", err),
+		ErrorCategory: analyser.ErrorCategoryInternal,
+		Retryable:     true,
+		Frames:        []models.FrameAnalysis{},
+		BrokenLinks:   []models.BrokenLink{},
 	}
+}
 
-	close(linksToCheck)
-
-	wg.Wait()
-
-	close(brokenLinksChan)
-
-	var collectedBrokenLinks []models.BrokenLink = []models.BrokenLink{}
-	var inaccessibleLinksCount int
-	for bl := range brokenLinksChan {
-		collectedBrokenLinks = append(collectedBrokenLinks, bl)
-		inaccessibleLinksCount++
+// endSpanWithError marks span as failed when err is set
+func endSpanWithError(span trace.Span, err error) {
+	if err == nil {
+		return
 	}
-
-	return collectedBrokenLinks, inaccessibleLinksCount
-
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
 }
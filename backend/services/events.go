@@ -0,0 +1,126 @@
+package services
+
+import (
+	"sync"
+	"time"
+	"web-scraper/models"
+
+	"github.com/google/uuid"
+)
+
+// EventType names what happened to an analysis, e.g. "content.changed"
+type EventType string
+
+const (
+	EventAnalysisCompleted EventType = "analysis.completed"
+	EventAnalysisErrored   EventType = "analysis.errored"
+	EventAnalysisCancelled EventType = "analysis.cancelled"
+	EventBrokenLinksFound  EventType = "brokenlinks.found"
+	EventContentChanged    EventType = "content.changed"
+)
+
+// EventTypes are the event types that can be subscribed to
+var EventTypes = []EventType{EventAnalysisCompleted, EventAnalysisErrored, EventAnalysisCancelled, EventBrokenLinksFound, EventContentChanged}
+
+// Event is published after an analysis was saved
+type Event struct {
+	// ID is unique per event, receivers use it to drop redelivered duplicates
+	ID         string    `json:"id"`
+	Type       EventType `json:"type"`
+	AnalysisID uint      `json:"analysisId"`
+	UserID     string    `json:"-"`
+	URL        string    `json:"url"`
+	Time       time.Time `json:"time"`
+	// Data is the event specific payload, e.g. the models.ContentDiff of a content change
+	Data any `json:"data"`
+}
+
+var (
+	eventHandlersMu sync.RWMutex
+	eventHandlers   []func(Event)
+)
+
+// SubscribeEvents calls handler for every published event. Handlers run on the publishing worker,
+// slow work belongs in a goroutine of its own.
+func SubscribeEvents(handler func(Event)) {
+	eventHandlersMu.Lock()
+	defer eventHandlersMu.Unlock()
+	eventHandlers = append(eventHandlers, handler)
+}
+
+// AnalysisSummary is the payload of the analysis lifecycle events
+type AnalysisSummary struct {
+	Status         string   `json:"status"`
+	Attempts       int      `json:"attempts"`
+	PageTitle      string   `json:"pageTitle,omitempty"`
+	BrokenLinks    int      `json:"brokenLinks"`
+	PartialReasons []string `json:"partialReasons,omitempty"`
+	Error          string   `json:"error,omitempty"`
+	ErrorCategory  string   `json:"errorCategory,omitempty"`
+}
+
+// BrokenLinksFound is the payload of a brokenlinks.found event
+type BrokenLinksFound struct {
+	Count int                 `json:"count"`
+	Links []models.BrokenLink `json:"links"`
+}
+
+func analysisEvent(eventType EventType, urlAnalysis *models.URLAnalysis, data any) Event {
+	return Event{
+		Type:       eventType,
+		AnalysisID: urlAnalysis.ID,
+		UserID:     urlAnalysis.UserID,
+		URL:        urlAnalysis.URL,
+		Data:       data,
+	}
+}
+
+func analysisSummary(urlAnalysis *models.URLAnalysis) AnalysisSummary {
+	return AnalysisSummary{
+		Status:         urlAnalysis.Status,
+		Attempts:       urlAnalysis.Attempts,
+		PageTitle:      urlAnalysis.PageTitle,
+		BrokenLinks:    len(urlAnalysis.BrokenLinks),
+		PartialReasons: urlAnalysis.PartialReasons,
+		Error:          urlAnalysis.LastError,
+		ErrorCategory:  urlAnalysis.ErrorCategory,
+	}
+}
+
+// publishAnalysisEvents publishes the lifecycle events of an analysis that was just saved
+func publishAnalysisEvents(urlAnalysis *models.URLAnalysis) {
+	switch urlAnalysis.Status {
+	case "done", "partial":
+		publishEvent(analysisEvent(EventAnalysisCompleted, urlAnalysis, analysisSummary(urlAnalysis)))
+		if len(urlAnalysis.BrokenLinks) > 0 {
+			publishEvent(analysisEvent(EventBrokenLinksFound, urlAnalysis, BrokenLinksFound{Count: len(urlAnalysis.BrokenLinks), Links: urlAnalysis.BrokenLinks}))
+		}
+	case "errored":
+		publishEvent(analysisEvent(EventAnalysisErrored, urlAnalysis, analysisSummary(urlAnalysis)))
+	case "cancelled":
+		publishEvent(analysisEvent(EventAnalysisCancelled, urlAnalysis, analysisSummary(urlAnalysis)))
+	}
+}
+
+// PublishAnalysisCancelled publishes the cancellation of an analysis that wasn't running, running ones
+// publish it themselves once they stopped
+func PublishAnalysisCancelled(urlAnalysis *models.URLAnalysis) {
+	publishEvent(analysisEvent(EventAnalysisCancelled, urlAnalysis, analysisSummary(urlAnalysis)))
+}
+
+func publishEvent(event Event) {
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	eventHandlersMu.RLock()
+	handlers := eventHandlers
+	eventHandlersMu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+	"web-scraper/metrics"
+	"web-scraper/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// how long the link of a confirmation email works
+	confirmationLinkTTL = 7 * 24 * time.Hour
+	// a channel gets one confirmation email per interval at most, so an address can't be flooded with them
+	confirmationResendInterval = 10 * time.Minute
+)
+
+// ErrChannelNotConfirmed is returned for notifications to email channels their recipient didn't confirm
+var ErrChannelNotConfirmed = errors.New("the recipient hasn't confirmed the email channel yet")
+
+// ErrConfirmationRecentlySent is returned when the channel got a confirmation email within the last minutes
+var ErrConfirmationRecentlySent = errors.New("a confirmation email was sent recently, try again later")
+
+// ErrInvalidConfirmationToken is returned for unknown, used and expired confirmation links
+var ErrInvalidConfirmationToken = errors.New("invalid or expired confirmation link")
+
+// NeedsConfirmation reports whether channel waits for its recipient to confirm it, chat channels never do
+func NeedsConfirmation(channel *models.NotificationChannel) bool {
+	return channel.Type == ChannelEmail && channel.ConfirmedAt == nil
+}
+
+// ResetChannelConfirmation marks channel unconfirmed, for a new or changed recipient
+func ResetChannelConfirmation(channel *models.NotificationChannel) {
+	channel.ConfirmedAt = nil
+	channel.ConfirmationTokenHash = ""
+	channel.ConfirmationSentAt = nil
+}
+
+// SendChannelConfirmation emails a confirmation link to the recipient of an unconfirmed email channel. The
+// message is fixed, nothing the user wrote reaches an address that didn't agree to it. A failure is also
+// recorded as the last error of the channel.
+func SendChannelConfirmation(db *gorm.DB, channel *models.NotificationChannel) error {
+	if !NeedsConfirmation(channel) {
+		return nil
+	}
+
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	now := time.Now()
+
+	// claimed with a conditional update, concurrent requests don't both send. The token is stored first,
+	// the link must work once the email is out.
+	result := db.Model(&models.NotificationChannel{}).
+		Where("id = ? AND confirmed_at IS NULL", channel.ID).
+		Where(db.Where("confirmation_sent_at IS NULL").Or("confirmation_sent_at < ?", now.Add(-confirmationResendInterval))).
+		Updates(map[string]interface{}{"confirmation_token_hash": hashAPIToken(token), "confirmation_sent_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConfirmationRecentlySent
+	}
+	channel.ConfirmationTokenHash = hashAPIToken(token)
+	channel.ConfirmationSentAt = &now
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifierTimeout)
+	defer cancel()
+
+	body := fmt.Sprintf(`Notifications about web page analyses of Talaash were requested for this address.
+To receive them, confirm the address within %d days:
+
+%s/notifications/confirm?token=%s
+
+If you didn't expect this email, ignore it and nothing else will be sent.`, int(confirmationLinkTTL.Hours()/24), apiURL(), token)
+
+	err := sendEmail(ctx, loadSMTPOptions(), string(channel.Target), "Confirm notifications to this address", body)
+	updates := map[string]interface{}{"last_error": ""}
+	if err != nil {
+		metrics.Notifications.WithLabelValues(channel.Type, "failed").Inc()
+		updates["last_error"] = truncateUTF8("confirmation email: "+err.Error(), 1024)
+		// nothing reached the recipient, the owner may try again right away
+		updates["confirmation_sent_at"] = nil
+		channel.ConfirmationSentAt = nil
+	}
+	channel.LastError = updates["last_error"].(string)
+	if saveErr := db.Model(channel).Updates(updates).Error; saveErr != nil {
+		metrics.DBSaveFailures.WithLabelValues("notification_channel").Inc()
+	}
+	return err
+}
+
+// ConfirmNotificationChannel confirms the email channel the token of a confirmation link was sent for
+func ConfirmNotificationChannel(db *gorm.DB, token string) (*models.NotificationChannel, error) {
+	hash := hashAPIToken(token)
+
+	var channel models.NotificationChannel
+	if err := db.Where("confirmation_token_hash = ? AND confirmed_at IS NULL", hash).Limit(1).Find(&channel).Error; err != nil {
+		return nil, err
+	}
+	if channel.ID == 0 || channel.ConfirmationSentAt == nil || time.Since(*channel.ConfirmationSentAt) > confirmationLinkTTL {
+		return nil, ErrInvalidConfirmationToken
+	}
+
+	now := time.Now()
+	result := db.Model(&models.NotificationChannel{}).Where("id = ? AND confirmation_token_hash = ?", channel.ID, hash).Updates(map[string]interface{}{
+		"confirmed_at":            now,
+		"confirmation_token_hash": "",
+		"last_error":              "",
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	// confirmed by a concurrent request, or retargeted meanwhile
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidConfirmationToken
+	}
+	channel.ConfirmedAt = &now
+	channel.ConfirmationTokenHash = ""
+	return &channel, nil
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+	"web-scraper/config"
+	"web-scraper/metrics"
+	"web-scraper/models"
+
+	"gorm.io/gorm"
+)
+
+// NotificationTrigger is a condition of an analysis result notification rules can fire on
+type NotificationTrigger string
+
+const (
+	TriggerAnalysisCompleted NotificationTrigger = "analysis.completed"
+	TriggerCrawlFailed       NotificationTrigger = "crawl.failed"
+	TriggerBrokenLinksGained NotificationTrigger = "brokenlinks.gained"
+	TriggerTitleLost         NotificationTrigger = "title.lost"
+)
+
+// NotificationTriggers are the triggers rules can subscribe to
+var NotificationTriggers = []NotificationTrigger{TriggerAnalysisCompleted, TriggerCrawlFailed, TriggerBrokenLinksGained, TriggerTitleLost}
+
+// the default messages of every trigger, rules may override them
+var defaultNotificationTemplates = map[NotificationTrigger]struct{ subject, body string }{
+	TriggerAnalysisCompleted: {
+		subject: "Analysis finished: {{.URL}}",
+		body: `The analysis of {{.URL}} finished with status {{.Status}}.
+Title: {{if .Title}}{{.Title}}{{else}}(none){{end}}
+Broken links: {{.BrokenLinkCount}}
+{{.Link}}`,
+	},
+	TriggerCrawlFailed: {
+		subject: "Crawl failed: {{.URL}}",
+		body: `{{.URL}} could not be crawled after {{.Attempts}} attempt(s).
+Error{{if .ErrorCategory}} ({{.ErrorCategory}}){{end}}: {{.Error}}
+{{.Link}}`,
+	},
+	TriggerBrokenLinksGained: {
+		subject: "{{len .NewBrokenLinks}} new broken link(s) on {{.URL}}",
+		body: `{{.URL}} has {{len .NewBrokenLinks}} broken link(s) it didn't have before, {{.BrokenLinkCount}} in total (was {{.PreviousBrokenLinkCount}}).
+{{range .NewBrokenLinks}}- {{.URL}} ({{if .StatusCode}}{{.StatusCode}}{{else}}{{.ErrorMessage}}{{end}})
+{{end}}{{.Link}}`,
+	},
+	TriggerTitleLost: {
+		subject: "Page title lost: {{.URL}}",
+		body: `{{.URL}} no longer has a title, it was "{{.PreviousTitle}}".
+{{.Link}}`,
+	},
+}
+
+// NotificationData is what notification templates are rendered with
+type NotificationData struct {
+	Trigger    NotificationTrigger
+	AnalysisID uint
+	URL        string
+	// Link opens the analysis in the frontend, APP_URL
+	Link                    string
+	Status                  string
+	Attempts                int
+	Title                   string
+	PreviousTitle           string
+	BrokenLinkCount         int
+	PreviousBrokenLinkCount int
+	// NewBrokenLinks are the broken links the previous run didn't find
+	NewBrokenLinks []models.BrokenLink
+	Error          string
+	ErrorCategory  string
+	Time           time.Time
+}
+
+// appURL is where the frontend is served, APP_URL (default http://localhost:5173)
+func appURL() string {
+	if url := config.GetEnv("APP_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return "http://localhost:5173"
+}
+
+// apiURL is where this API is reached from outside, API_URL (default http://localhost:8080). Confirmation
+// links of email channels point to it.
+func apiURL() string {
+	if url := config.GetEnv("API_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return "http://localhost:8080"
+}
+
+// notificationBaseline is what a run is compared with to find regressions, the result of the previous
+// successful run. It is taken before the run changes the analysis.
+type notificationBaseline struct {
+	// false for analyses without a successful run yet
+	succeeded   bool
+	title       string
+	brokenLinks []models.BrokenLink
+}
+
+func baselineOf(urlAnalysis *models.URLAnalysis) notificationBaseline {
+	history := urlAnalysis.AttemptHistory
+	if len(history) == 0 {
+		return notificationBaseline{}
+	}
+	if status := history[len(history)-1].Status; status != "done" && status != "partial" {
+		return notificationBaseline{}
+	}
+	return notificationBaseline{succeeded: true, title: urlAnalysis.PageTitle, brokenLinks: urlAnalysis.BrokenLinks}
+}
+
+// firedTriggers returns the triggers of a saved run with the data to render their messages
+func firedTriggers(baseline notificationBaseline, urlAnalysis *models.URLAnalysis, now time.Time) ([]NotificationTrigger, NotificationData) {
+	data := NotificationData{
+		AnalysisID:              urlAnalysis.ID,
+		URL:                     urlAnalysis.URL,
+		Link:                    fmt.Sprintf("%s/urls/%d", appURL(), urlAnalysis.ID),
+		Status:                  urlAnalysis.Status,
+		Attempts:                urlAnalysis.Attempts,
+		Title:                   strings.TrimSpace(urlAnalysis.PageTitle),
+		PreviousTitle:           strings.TrimSpace(baseline.title),
+		BrokenLinkCount:         len(urlAnalysis.BrokenLinks),
+		PreviousBrokenLinkCount: len(baseline.brokenLinks),
+		NewBrokenLinks:          []models.BrokenLink{},
+		Error:                   urlAnalysis.LastError,
+		ErrorCategory:           urlAnalysis.ErrorCategory,
+		Time:                    now,
+	}
+
+	var fired []NotificationTrigger
+	switch urlAnalysis.Status {
+	case "errored":
+		fired = append(fired, TriggerCrawlFailed)
+	case "done", "partial":
+		fired = append(fired, TriggerAnalysisCompleted)
+
+		known := map[string]bool{}
+		for _, link := range baseline.brokenLinks {
+			known[link.URL] = true
+		}
+		for _, link := range urlAnalysis.BrokenLinks {
+			if !known[link.URL] {
+				data.NewBrokenLinks = append(data.NewBrokenLinks, link)
+			}
+		}
+		if len(data.NewBrokenLinks) > 0 {
+			fired = append(fired, TriggerBrokenLinksGained)
+		}
+		if baseline.succeeded && data.PreviousTitle != "" && data.Title == "" {
+			fired = append(fired, TriggerTitleLost)
+		}
+	}
+	return fired, data
+}
+
+// renderNotification renders the subject and body of a rule, its own templates replace the defaults of the trigger
+func renderNotification(rule models.NotificationRule, data NotificationData) (string, string, error) {
+	defaults := defaultNotificationTemplates[data.Trigger]
+	subjectTemplate, bodyTemplate := defaults.subject, defaults.body
+	if rule.SubjectTemplate != "" {
+		subjectTemplate = rule.SubjectTemplate
+	}
+	if rule.BodyTemplate != "" {
+		bodyTemplate = rule.BodyTemplate
+	}
+
+	subject, err := executeTemplate("subject", subjectTemplate, data)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := executeTemplate("body", bodyTemplate, data)
+	if err != nil {
+		return "", "", err
+	}
+	// a subject is a single line, also in email headers
+	return strings.Join(strings.Fields(subject), " "), strings.TrimSpace(body), nil
+}
+
+func executeTemplate(name, text string, data NotificationData) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// ValidateNotificationTemplates renders custom templates with sample data, so mistakes show when a rule
+// is saved rather than when it fires
+func ValidateNotificationTemplates(subject, body string) error {
+	sample := NotificationData{
+		Trigger:        TriggerBrokenLinksGained,
+		URL:            "https://example.com",
+		Link:           "/urls/1",
+		Status:         "done",
+		NewBrokenLinks: []models.BrokenLink{{URL: "https://example.com/missing", StatusCode: 404}},
+		Time:           time.Now(),
+	}
+	_, _, err := renderNotification(models.NotificationRule{SubjectTemplate: subject, BodyTemplate: body}, sample)
+	return err
+}
+
+// the database notification rules and channels are read from, set by EnableNotifications
+var notificationsDB *gorm.DB
+
+// EnableNotifications sends the messages of the notification rules of users once their analyses finish
+func EnableNotifications(db *gorm.DB) {
+	notificationsDB = db
+}
+
+// notifyAnalysisResult evaluates the notification rules of the user after a run was saved and sends the
+// messages of the ones that fired
+func notifyAnalysisResult(baseline notificationBaseline, urlAnalysis *models.URLAnalysis) {
+	db := notificationsDB
+	if db == nil {
+		return
+	}
+	fired, data := firedTriggers(baseline, urlAnalysis, time.Now())
+	if len(fired) == 0 || urlAnalysis.UserID == "" {
+		return
+	}
+
+	var rules []models.NotificationRule
+	if err := db.Where("user_id = ? AND active = ?", urlAnalysis.UserID, true).Find(&rules).Error; err != nil {
+		slog.Error("Failed to load notification rules", "analysis_id", urlAnalysis.ID, "error", err)
+		return
+	}
+
+	for _, rule := range rules {
+		if rule.URLPattern != "" && !strings.Contains(urlAnalysis.URL, rule.URLPattern) {
+			continue
+		}
+		for _, trigger := range fired {
+			if !slices.Contains(rule.Triggers, string(trigger)) {
+				continue
+			}
+			data.Trigger = trigger
+			if err := sendRuleNotification(db, rule, data); err != nil {
+				slog.Warn("Notification not sent", "rule_id", rule.ID, "channel_id", rule.ChannelID, "trigger", trigger, "analysis_id", urlAnalysis.ID, "error", err)
+			}
+		}
+	}
+}
+
+func sendRuleNotification(db *gorm.DB, rule models.NotificationRule, data NotificationData) error {
+	var channel models.NotificationChannel
+	if err := db.Where("user_id = ?", rule.UserID).First(&channel, rule.ChannelID).Error; err != nil {
+		return fmt.Errorf("failed to load channel: %w", err)
+	}
+	subject, body, err := renderNotification(rule, data)
+	if err != nil {
+		return fmt.Errorf("failed to render template: %w", err)
+	}
+	return deliverNotification(db, &channel, subject, body)
+}
+
+// SendTestNotification sends a sample message to channel, the error tells why the channel doesn't work
+func SendTestNotification(db *gorm.DB, channel *models.NotificationChannel) error {
+	return deliverNotification(db, channel, "Test notification", "Notifications of this channel are working.")
+}
+
+// deliverNotification sends a message to channel and records the outcome on it, unconfirmed email channels
+// get nothing
+func deliverNotification(db *gorm.DB, channel *models.NotificationChannel, subject, body string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notifierTimeout)
+	defer cancel()
+
+	var err error
+	if NeedsConfirmation(channel) {
+		err = ErrChannelNotConfirmed
+	} else {
+		err = sendNotification(ctx, channel, subject, body)
+	}
+	now := time.Now()
+	updates := map[string]interface{}{"last_error": ""}
+	if err != nil {
+		metrics.Notifications.WithLabelValues(channel.Type, "failed").Inc()
+		updates["last_error"] = truncateUTF8(err.Error(), 1024)
+	} else {
+		metrics.Notifications.WithLabelValues(channel.Type, "sent").Inc()
+		updates["last_sent_at"] = now
+	}
+	if saveErr := db.Model(channel).Updates(updates).Error; saveErr != nil {
+		metrics.DBSaveFailures.WithLabelValues("notification_channel").Inc()
+	}
+	return err
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"web-scraper/config"
+	"web-scraper/models"
+	"web-scraper/netguard"
+)
+
+// notification channel types
+const (
+	ChannelEmail = "email"
+	ChannelSlack = "slack"
+	ChannelTeams = "teams"
+)
+
+// ChannelTypes are the supported notification channel types
+var ChannelTypes = []string{ChannelEmail, ChannelSlack, ChannelTeams}
+
+var errUnknownChannelType = errors.New("unknown notification channel type")
+
+// how long sending a single notification may take
+const notifierTimeout = 15 * time.Second
+
+// the client chat messages are posted with, created on first use
+var chatClient = sync.OnceValue(func() *http.Client {
+	return guardedHTTPClient(netguard.Default(), notifierTimeout)
+})
+
+// smtpOptions is the mail server email notifications are sent through
+type smtpOptions struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	// "starttls" upgrades the connection and fails when the server doesn't offer it, "tls" connects with
+	// TLS (port 465), "none" never encrypts
+	tls string
+}
+
+// loadSMTPOptions reads SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM
+// and SMTP_TLS (default starttls)
+func loadSMTPOptions() smtpOptions {
+	opts := smtpOptions{
+		host:     config.GetEnv("SMTP_HOST"),
+		port:     config.GetEnvInt("SMTP_PORT", 587),
+		username: config.GetEnv("SMTP_USERNAME"),
+		password: config.GetEnv("SMTP_PASSWORD"),
+		from:     config.GetEnv("SMTP_FROM"),
+		tls:      strings.ToLower(config.GetEnv("SMTP_TLS")),
+	}
+	if opts.tls == "" {
+		opts.tls = "starttls"
+	}
+	return opts
+}
+
+// ValidateChannelTarget checks the target suits the channel type: a single email address for email channels,
+// as every recipient confirms the channel on its own, an http(s) URL for chat channels
+func ValidateChannelTarget(channelType, target string) error {
+	switch channelType {
+	case ChannelEmail:
+		_, err := mail.ParseAddress(target)
+		return err
+	case ChannelSlack, ChannelTeams:
+		if !strings.HasPrefix(target, "https://") && !strings.HasPrefix(target, "http://") {
+			return fmt.Errorf("%s channels need the URL of an incoming webhook", channelType)
+		}
+		return nil
+	default:
+		return errUnknownChannelType
+	}
+}
+
+// sendNotification sends a message to the target of channel
+func sendNotification(ctx context.Context, channel *models.NotificationChannel, subject, body string) error {
+	target := string(channel.Target)
+	switch channel.Type {
+	case ChannelEmail:
+		return sendEmail(ctx, loadSMTPOptions(), target, subject, body)
+	case ChannelSlack:
+		// the text field is understood by Slack and the Slack compatible Mattermost and Rocket.Chat
+		return postChatMessage(ctx, target, map[string]any{"text": "*" + subject + "*\n" + body})
+	case ChannelTeams:
+		return postChatMessage(ctx, target, map[string]any{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  subject,
+			"title":    subject,
+			// Teams renders the text as markdown, where single line breaks are dropped
+			"text": strings.ReplaceAll(body, "\n", "  \n"),
+		})
+	default:
+		return errUnknownChannelType
+	}
+}
+
+// postChatMessage posts message as JSON to an incoming webhook of a chat service
+func postChatMessage(ctx context.Context, webhookURL string, message map[string]any) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := chatClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		answer, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("webhook answered %d %s", resp.StatusCode, strings.TrimSpace(string(answer)))
+	}
+	return nil
+}
+
+// sendEmail sends a plain text email to the comma separated recipients
+func sendEmail(ctx context.Context, opts smtpOptions, recipients, subject, body string) error {
+	if opts.host == "" || opts.from == "" {
+		return errors.New("email notifications need SMTP_HOST and SMTP_FROM")
+	}
+	to, err := mail.ParseAddressList(recipients)
+	if err != nil {
+		return fmt.Errorf("invalid recipients: %w", err)
+	}
+	from, err := mail.ParseAddress(opts.from)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP_FROM: %w", err)
+	}
+
+	addr := net.JoinHostPort(opts.host, strconv.Itoa(opts.port))
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	if opts.tls == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: opts.host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, opts.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if opts.tls == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("the SMTP server doesn't offer STARTTLS, set SMTP_TLS=none to send unencrypted")
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: opts.host}); err != nil {
+			return err
+		}
+	}
+	if opts.username != "" {
+		// PlainAuth refuses to send the password over an unencrypted connection, except to localhost
+		if err := client.Auth(smtp.PlainAuth("", opts.username, opts.password, opts.host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient.Address); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(emailMessage(from, to, subject, body, time.Now())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// emailMessage builds a UTF-8 plain text message, quoted-printable encoded
+func emailMessage(from *mail.Address, to []*mail.Address, subject, body string, date time.Time) []byte {
+	recipients := make([]string, len(to))
+	for i, address := range to {
+		recipients[i] = address.String()
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&msg)
+	qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	qp.Close()
+	msg.WriteString("\r\n")
+	return msg.Bytes()
+}
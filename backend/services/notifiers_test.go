@@ -0,0 +1,234 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"web-scraper/database"
+	"web-scraper/models"
+)
+
+// fakeSMTPServer is a local stand-in of a mail server, it accepts every message and keeps it
+type fakeSMTPServer struct {
+	listener net.Listener
+	// offered as an extension when set, the upgrade itself isn't implemented
+	offerStartTLS bool
+
+	mu       sync.Mutex
+	from     []string
+	to       []string
+	messages []string
+}
+
+func startFakeSMTPServer(t *testing.T, offerStartTLS bool) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeSMTPServer{listener: listener, offerStartTLS: offerStartTLS}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			if s.offerStartTLS {
+				reply("250-localhost")
+				reply("250 STARTTLS")
+			} else {
+				reply("250 localhost")
+			}
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			s.mu.Lock()
+			s.from = append(s.from, strings.TrimSpace(line)[len("MAIL FROM:"):])
+			s.mu.Unlock()
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			s.mu.Lock()
+			s.to = append(s.to, strings.TrimSpace(line)[len("RCPT TO:"):])
+			s.mu.Unlock()
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, data.String())
+			s.mu.Unlock()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) received() (from, to, messages []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.from...), append([]string(nil), s.to...), append([]string(nil), s.messages...)
+}
+
+// decodedBody returns the quoted-printable body of a received message
+func decodedBody(t *testing.T, message string) string {
+	t.Helper()
+	_, body, ok := strings.Cut(message, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("message without body: %q", message)
+	}
+	decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(decoded)
+}
+
+func TestSendEmail(t *testing.T) {
+	server := startFakeSMTPServer(t, false)
+	opts := smtpOptions{host: "127.0.0.1", port: server.port(), from: "Talaash <alerts@example.com>", tls: "none"}
+
+	if err := sendEmail(t.Context(), opts, "team@example.com", "Analysis finished: https://example.com", "Broken links: 2"); err != nil {
+		t.Fatalf("sendEmail: %v", err)
+	}
+
+	from, to, messages := server.received()
+	if len(from) != 1 || from[0] != "<alerts@example.com>" {
+		t.Errorf("MAIL FROM = %v", from)
+	}
+	if len(to) != 1 || to[0] != "<team@example.com>" {
+		t.Errorf("RCPT TO = %v", to)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("received %d messages, want 1", len(messages))
+	}
+	if !strings.Contains(messages[0], "Subject: Analysis finished: https://example.com\r\n") {
+		t.Errorf("message without subject: %q", messages[0])
+	}
+	if body := decodedBody(t, messages[0]); !strings.Contains(body, "Broken links: 2") {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestSendEmailRequiresStartTLS(t *testing.T) {
+	server := startFakeSMTPServer(t, false)
+	opts := smtpOptions{host: "127.0.0.1", port: server.port(), from: "alerts@example.com", tls: "starttls"}
+
+	err := sendEmail(t.Context(), opts, "team@example.com", "subject", "body")
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("sendEmail = %v, want an error about STARTTLS", err)
+	}
+	if _, _, messages := server.received(); len(messages) != 0 {
+		t.Errorf("sent %d messages unencrypted", len(messages))
+	}
+}
+
+func TestEmailChannelConfirmation(t *testing.T) {
+	server := startFakeSMTPServer(t, false)
+	t.Setenv("SMTP_HOST", "127.0.0.1")
+	t.Setenv("SMTP_PORT", strconv.Itoa(server.port()))
+	t.Setenv("SMTP_FROM", "alerts@example.com")
+	t.Setenv("SMTP_TLS", "none")
+	t.Setenv("API_URL", "https://api.example.com/")
+	t.Setenv("CRAWL_SECRETS_KEY", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+
+	db, err := database.Open(database.Options{Driver: database.SQLite, DSN: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.MigrateUp(db, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	channel := models.NotificationChannel{UserID: "alice", Name: "Team", Type: ChannelEmail, Target: "team@example.com"}
+	if err := db.Create(&channel).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deliverNotification(db, &channel, "subject", "written by the user"); !errors.Is(err, ErrChannelNotConfirmed) {
+		t.Fatalf("deliverNotification before the confirmation = %v, want ErrChannelNotConfirmed", err)
+	}
+
+	if err := SendChannelConfirmation(db, &channel); err != nil {
+		t.Fatalf("SendChannelConfirmation: %v", err)
+	}
+	if err := SendChannelConfirmation(db, &channel); !errors.Is(err, ErrConfirmationRecentlySent) {
+		t.Fatalf("second SendChannelConfirmation = %v, want ErrConfirmationRecentlySent", err)
+	}
+
+	_, _, messages := server.received()
+	if len(messages) != 1 {
+		t.Fatalf("received %d messages, want only the confirmation", len(messages))
+	}
+	link := regexp.MustCompile(`https://api\.example\.com/notifications/confirm\?token=([0-9a-f]{64})`).FindStringSubmatch(decodedBody(t, messages[0]))
+	if link == nil {
+		t.Fatalf("confirmation email without link: %q", messages[0])
+	}
+
+	if _, err := ConfirmNotificationChannel(db, strings.Repeat("0", 64)); !errors.Is(err, ErrInvalidConfirmationToken) {
+		t.Errorf("ConfirmNotificationChannel with a wrong token = %v, want ErrInvalidConfirmationToken", err)
+	}
+	confirmed, err := ConfirmNotificationChannel(db, link[1])
+	if err != nil {
+		t.Fatalf("ConfirmNotificationChannel: %v", err)
+	}
+	if NeedsConfirmation(confirmed) {
+		t.Error("channel still needs a confirmation")
+	}
+	if _, err := ConfirmNotificationChannel(db, link[1]); !errors.Is(err, ErrInvalidConfirmationToken) {
+		t.Errorf("reused confirmation link = %v, want ErrInvalidConfirmationToken", err)
+	}
+
+	if err := deliverNotification(db, confirmed, "subject", "written by the user"); err != nil {
+		t.Fatalf("deliverNotification after the confirmation: %v", err)
+	}
+	if _, _, messages := server.received(); len(messages) != 2 || !strings.Contains(decodedBody(t, messages[1]), "written by the user") {
+		t.Errorf("notification not delivered after the confirmation: %q", messages)
+	}
+}
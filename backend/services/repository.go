@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	netURL "net/url"
+	"time"
+	"web-scraper/analyser"
+	"web-scraper/logging"
+	"web-scraper/models"
+
+	"gorm.io/gorm"
+)
+
+// Repository is where the crawl pipeline loads and stores analyses and what belongs to them,
+// NewGormRepository is the implementation of the server
+type Repository interface {
+	LoadAnalysis(ctx context.Context, id uint) (*models.URLAnalysis, error)
+	// SaveAnalysis writes every field of urlAnalysis
+	SaveAnalysis(ctx context.Context, urlAnalysis *models.URLAnalysis) error
+	SetStatus(ctx context.Context, id uint, status string) error
+	// AcquireLease marks a queued analysis running, leased by owner until expiresAt. It reports false when
+	// the analysis isn't queued anymore, it was cancelled or another worker claimed it.
+	AcquireLease(ctx context.Context, id uint, owner string, expiresAt time.Time) (bool, error)
+	// RenewLease extends the lease of owner on a running analysis, it reports false when owner lost it
+	RenewLease(ctx context.Context, id uint, owner string, expiresAt time.Time) (bool, error)
+	// QueueRetry moves an analysis waiting for its retry to queued. It reports false when the analysis
+	// isn't retrying with attempts anymore, it was re-submitted, cancelled or retried otherwise.
+	QueueRetry(ctx context.Context, id uint, attempts int) (bool, error)
+
+	// CrawlProfile returns the crawl profile applied to urlAnalysis, nil when there is none
+	CrawlProfile(ctx context.Context, urlAnalysis *models.URLAnalysis) (*models.CrawlProfile, error)
+	// ReplaceCrawlLog replaces the stored log of an analysis with entries
+	ReplaceCrawlLog(ctx context.Context, analysisID uint, entries []models.CrawlLogEntry) error
+
+	// LatestContentVersion returns the newest content version of an analysis, nil when it has none
+	LatestContentVersion(ctx context.Context, analysisID uint) (*models.ContentVersion, error)
+	// AddContentVersion stores version and deletes all but the newest keep versions of its analysis
+	AddContentVersion(ctx context.Context, version *models.ContentVersion, keep int) error
+
+	AddSnapshot(ctx context.Context, snapshot *models.Snapshot) error
+	// SnapshotsBeyond returns the snapshots of an analysis older than the newest keep
+	SnapshotsBeyond(ctx context.Context, analysisID uint, keep int) ([]models.Snapshot, error)
+	DeleteSnapshot(ctx context.Context, snapshot *models.Snapshot) error
+}
+
+// GormRepository is the Repository of the server database
+type GormRepository struct {
+	db *gorm.DB
+}
+
+func NewGormRepository(db *gorm.DB) *GormRepository {
+	return &GormRepository{db: db}
+}
+
+func (r *GormRepository) LoadAnalysis(ctx context.Context, id uint) (*models.URLAnalysis, error) {
+	var urlAnalysis models.URLAnalysis
+	if err := r.db.WithContext(ctx).First(&urlAnalysis, id).Error; err != nil {
+		return nil, err
+	}
+	return &urlAnalysis, nil
+}
+
+func (r *GormRepository) SaveAnalysis(ctx context.Context, urlAnalysis *models.URLAnalysis) error {
+	return r.db.WithContext(ctx).Select("*").Save(urlAnalysis).Error
+}
+
+func (r *GormRepository) SetStatus(ctx context.Context, id uint, status string) error {
+	return r.db.WithContext(ctx).Model(&models.URLAnalysis{ID: id}).Update("status", status).Error
+}
+
+func (r *GormRepository) AcquireLease(ctx context.Context, id uint, owner string, expiresAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.URLAnalysis{}).Where("id = ? AND status = ?", id, "queued").Updates(map[string]interface{}{
+		"status":           "running",
+		"lease_owner":      owner,
+		"lease_expires_at": expiresAt,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *GormRepository) RenewLease(ctx context.Context, id uint, owner string, expiresAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.URLAnalysis{}).Where("id = ? AND status = ? AND lease_owner = ?", id, "running", owner).Update("lease_expires_at", expiresAt)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *GormRepository) QueueRetry(ctx context.Context, id uint, attempts int) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.URLAnalysis{}).Where("id = ? AND status = ? AND attempts = ?", id, "retrying", attempts).Update("status", "queued")
+	return result.RowsAffected > 0, result.Error
+}
+
+// CrawlProfile returns the profile referenced by the analysis, or a profile of the submitting user whose
+// site matches the analysed host. Only profiles of the owner of the analysis apply, their credentials
+// must not be sent for anyone else. It returns nil when there is nothing to apply.
+func (r *GormRepository) CrawlProfile(ctx context.Context, urlAnalysis *models.URLAnalysis) (*models.CrawlProfile, error) {
+	db := r.db.WithContext(ctx)
+	var profile models.CrawlProfile
+
+	if urlAnalysis.CrawlProfileID != nil {
+		if err := db.Where("user_id = ?", urlAnalysis.UserID).First(&profile, *urlAnalysis.CrawlProfileID).Error; err != nil {
+			return nil, fmt.Errorf("crawl profile %d: %w", *urlAnalysis.CrawlProfileID, err)
+		}
+		return &profile, nil
+	}
+
+	if urlAnalysis.UserID == "" {
+		return nil, nil
+	}
+
+	pageURL, err := netURL.Parse(urlAnalysis.URL)
+	if err != nil {
+		return nil, nil
+	}
+
+	var candidates []models.CrawlProfile
+	if err := db.Where("user_id = ? AND site <> ''", urlAnalysis.UserID).Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	// most specific site wins, "app.example.com" over "example.com"
+	var match *models.CrawlProfile
+	for i := range candidates {
+		if analyser.HostMatchesSite(pageURL.Hostname(), candidates[i].Site) && (match == nil || len(candidates[i].Site) > len(match.Site)) {
+			match = &candidates[i]
+		}
+	}
+	return match, nil
+}
+
+func (r *GormRepository) ReplaceCrawlLog(ctx context.Context, analysisID uint, entries []models.CrawlLogEntry) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("url_analysis_id = ?", analysisID).Delete(&models.CrawlLogEntry{}).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(entries, 100).Error
+	})
+}
+
+func (r *GormRepository) LatestContentVersion(ctx context.Context, analysisID uint) (*models.ContentVersion, error) {
+	var previous models.ContentVersion
+	if err := r.db.WithContext(ctx).Where("url_analysis_id = ?", analysisID).Order("id DESC").Limit(1).Find(&previous).Error; err != nil {
+		return nil, err
+	}
+	if previous.ID == 0 {
+		return nil, nil
+	}
+	return &previous, nil
+}
+
+// AddContentVersion stores version, pruning failures are logged and only leave old versions behind
+func (r *GormRepository) AddContentVersion(ctx context.Context, version *models.ContentVersion, keep int) error {
+	db := r.db.WithContext(ctx)
+	if err := db.Create(version).Error; err != nil {
+		return err
+	}
+	if keep <= 0 {
+		return nil
+	}
+
+	logger := logging.FromContext(ctx).With("analysis_id", version.URLAnalysisID)
+	newest, err := newestIDs(db, &models.ContentVersion{}, version.URLAnalysisID, keep)
+	if err != nil {
+		logger.Warn("Failed to prune content versions", "error", err)
+		return nil
+	}
+	if err := db.Where("url_analysis_id = ? AND id NOT IN ?", version.URLAnalysisID, newest).Delete(&models.ContentVersion{}).Error; err != nil {
+		logger.Warn("Failed to prune content versions", "error", err)
+	}
+	return nil
+}
+
+func (r *GormRepository) AddSnapshot(ctx context.Context, snapshot *models.Snapshot) error {
+	return r.db.WithContext(ctx).Create(snapshot).Error
+}
+
+func (r *GormRepository) SnapshotsBeyond(ctx context.Context, analysisID uint, keep int) ([]models.Snapshot, error) {
+	db := r.db.WithContext(ctx)
+	newest, err := newestIDs(db, &models.Snapshot{}, analysisID, keep)
+	if err != nil {
+		return nil, err
+	}
+	var old []models.Snapshot
+	err = db.Where("url_analysis_id = ? AND id NOT IN ?", analysisID, newest).Order("id DESC").Find(&old).Error
+	return old, err
+}
+
+// newestIDs returns the ids of the newest keep rows of model belonging to an analysis. The rows beyond are
+// selected with NOT IN rather than OFFSET, MySQL takes no OFFSET without LIMIT nor LIMIT in IN subqueries.
+// It never returns an empty list, which would turn the NOT IN into invalid SQL.
+func newestIDs(db *gorm.DB, model any, analysisID uint, keep int) ([]uint, error) {
+	var ids []uint
+	if err := db.Model(model).Where("url_analysis_id = ?", analysisID).Order("id DESC").Limit(keep).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		// no row has id 0
+		ids = []uint{0}
+	}
+	return ids, nil
+}
+
+func (r *GormRepository) DeleteSnapshot(ctx context.Context, snapshot *models.Snapshot) error {
+	return r.db.WithContext(ctx).Delete(snapshot).Error
+}
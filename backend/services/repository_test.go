@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"web-scraper/database"
+	"web-scraper/models"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB returns a migrated in-memory SQLite database
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(database.Options{Driver: database.SQLite, DSN: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.MigrateUp(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// sqlRecorder is a GORM logger keeping the SQL of every statement
+type sqlRecorder struct {
+	logger.Interface
+	mu         sync.Mutex
+	statements []string
+}
+
+func (r *sqlRecorder) LogMode(logger.LogLevel) logger.Interface { return r }
+
+func (r *sqlRecorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	r.mu.Lock()
+	r.statements = append(r.statements, sql)
+	r.mu.Unlock()
+}
+
+// dryRunDBs return databases of the MySQL and PostgreSQL dialects which only build their SQL, neither
+// server is needed
+func dryRunDBs(t *testing.T) map[string]struct {
+	db       *gorm.DB
+	recorder *sqlRecorder
+} {
+	t.Helper()
+	dialectors := map[string]gorm.Dialector{
+		database.MySQL:    mysql.New(mysql.Config{DSN: "user:password@tcp(127.0.0.1:1)/db?parseTime=true", SkipInitializeWithVersion: true}),
+		database.Postgres: postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1 user=user dbname=db"}),
+	}
+	dbs := map[string]struct {
+		db       *gorm.DB
+		recorder *sqlRecorder
+	}{}
+	for name, dialector := range dialectors {
+		recorder := &sqlRecorder{Interface: logger.Discard}
+		db, err := gorm.Open(dialector, &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true, Logger: recorder})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		dbs[name] = struct {
+			db       *gorm.DB
+			recorder *sqlRecorder
+		}{db, recorder}
+	}
+	return dbs
+}
+
+// checkPortableSQL fails t for statements MySQL or PostgreSQL reject: an OFFSET without LIMIT or an empty IN list
+func checkPortableSQL(t *testing.T, dialect string, statements []string) {
+	t.Helper()
+	if len(statements) == 0 {
+		t.Errorf("%s: no statement recorded", dialect)
+	}
+	for _, sql := range statements {
+		upper := strings.ToUpper(sql)
+		if strings.Contains(upper, " OFFSET ") && !strings.Contains(upper, " LIMIT ") {
+			t.Errorf("%s: OFFSET without LIMIT: %s", dialect, sql)
+		}
+		if strings.Contains(upper, "IN ()") || strings.Contains(upper, "IN (NULL)") {
+			t.Errorf("%s: empty IN list: %s", dialect, sql)
+		}
+	}
+}
+
+func addSnapshots(t *testing.T, repo *GormRepository, analysisID uint, count int) []uint {
+	t.Helper()
+	ids := make([]uint, count)
+	for i := range ids {
+		snapshot := models.Snapshot{URLAnalysisID: analysisID, Attempt: i + 1, BlobKey: "snapshots/test"}
+		if err := repo.AddSnapshot(t.Context(), &snapshot); err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = snapshot.ID
+	}
+	return ids
+}
+
+func TestSnapshotsBeyond(t *testing.T) {
+	repo := NewGormRepository(newTestDB(t))
+
+	ids := addSnapshots(t, repo, 1, 5)
+	// snapshots of other analyses are never pruned with these
+	addSnapshots(t, repo, 2, 3)
+
+	old, err := repo.SnapshotsBeyond(t.Context(), 1, 2)
+	if err != nil {
+		t.Fatalf("SnapshotsBeyond: %v", err)
+	}
+	var got []uint
+	for _, snapshot := range old {
+		got = append(got, snapshot.ID)
+	}
+	want := []uint{ids[2], ids[1], ids[0]}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("SnapshotsBeyond = %v, want the oldest %v", got, want)
+	}
+
+	if old, err := repo.SnapshotsBeyond(t.Context(), 1, 10); err != nil || len(old) != 0 {
+		t.Errorf("SnapshotsBeyond with fewer snapshots than kept = %v, %v, want none", old, err)
+	}
+	if old, err := repo.SnapshotsBeyond(t.Context(), 3, 2); err != nil || len(old) != 0 {
+		t.Errorf("SnapshotsBeyond of an analysis without snapshots = %v, %v, want none", old, err)
+	}
+}
+
+func TestSnapshotsBeyondSQL(t *testing.T) {
+	for dialect, dryRun := range dryRunDBs(t) {
+		repo := NewGormRepository(dryRun.db)
+		if _, err := repo.SnapshotsBeyond(t.Context(), 1, 2); err != nil {
+			t.Errorf("%s: SnapshotsBeyond: %v", dialect, err)
+		}
+		checkPortableSQL(t, dialect, dryRun.recorder.statements)
+	}
+}
+
+func addContentVersions(t *testing.T, repo *GormRepository, analysisID uint, count, keep int) []uint {
+	t.Helper()
+	ids := make([]uint, count)
+	for i := range ids {
+		version := models.ContentVersion{URLAnalysisID: analysisID, Attempt: i + 1, Headings: models.StringList{}, Links: models.StringList{}}
+		if err := repo.AddContentVersion(t.Context(), &version, keep); err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = version.ID
+	}
+	return ids
+}
+
+func TestAddContentVersionPrunes(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewGormRepository(db)
+
+	ids := addContentVersions(t, repo, 1, 5, 2)
+	others := addContentVersions(t, repo, 2, 3, 0)
+
+	var kept []uint
+	if err := db.Model(&models.ContentVersion{}).Where("url_analysis_id = ?", 1).Order("id").Pluck("id", &kept).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 2 || kept[0] != ids[3] || kept[1] != ids[4] {
+		t.Errorf("kept versions %v, want the newest %v", kept, ids[3:])
+	}
+
+	var otherCount int64
+	db.Model(&models.ContentVersion{}).Where("url_analysis_id = ?", 2).Count(&otherCount)
+	if int(otherCount) != len(others) {
+		t.Errorf("analysis 2 has %d versions, want all %d, keep 0 prunes nothing", otherCount, len(others))
+	}
+}
+
+func TestAddContentVersionSQL(t *testing.T) {
+	for dialect, dryRun := range dryRunDBs(t) {
+		repo := NewGormRepository(dryRun.db)
+		version := models.ContentVersion{URLAnalysisID: 1, Headings: models.StringList{}, Links: models.StringList{}}
+		if err := repo.AddContentVersion(t.Context(), &version, 2); err != nil {
+			t.Errorf("%s: AddContentVersion: %v", dialect, err)
+		}
+		checkPortableSQL(t, dialect, dryRun.recorder.statements)
+	}
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+	"web-scraper/analyser"
+	"web-scraper/logging"
+	"web-scraper/metrics"
+	"web-scraper/models"
+	"web-scraper/warc"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNoSnapshot      = errors.New("the analysis has no snapshot")
+	ErrNotInSnapshot   = errors.New("not in the snapshot")
+	ErrAnalysisRunning = errors.New("the analysis is queued or running")
+)
+
+// maxReprocessBacklog is how many analyses of bulk requests may wait to be reprocessed
+const maxReprocessBacklog = 5000
+
+// reprocessJob is an analysis of a bulk request waiting to be reprocessed
+type reprocessJob struct {
+	db         *gorm.DB
+	userID     string
+	analysisID uint
+	requestID  string
+}
+
+var (
+	reprocessBacklog     = make(chan reprocessJob, maxReprocessBacklog)
+	startReprocessWorker sync.Once
+)
+
+// statuses of analyses a crawl may still write to, they aren't reprocessed
+var busyStatuses = []string{"queued", "running", "retrying"}
+
+// archiveTransport answers requests from the response records of a snapshot, it never touches the network
+type archiveTransport struct {
+	responses map[string]*warc.Record
+}
+
+func newArchiveTransport(records []*warc.Record) *archiveTransport {
+	t := &archiveTransport{responses: map[string]*warc.Record{}}
+	for _, record := range records {
+		if record.Header.Get("WARC-Type") == warc.TypeResponse {
+			t.responses[record.Header.Get("WARC-Target-URI")] = record
+		}
+	}
+	return t
+}
+
+func (t *archiveTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	record, ok := t.responses[req.URL.String()]
+	if !ok || req.Method != http.MethodGet {
+		return nil, fmt.Errorf("%w: %s %s", ErrNotInSnapshot, req.Method, req.URL)
+	}
+	return warc.ReadHTTPResponse(record.Block, req)
+}
+
+// loadSnapshotRecords reads all records of the WARC file of snapshot
+func loadSnapshotRecords(ctx context.Context, snapshot models.Snapshot) ([]*warc.Record, error) {
+	body, err := OpenSnapshot(ctx, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	reader, err := warc.NewReader(body)
+	if err != nil {
+		return nil, err
+	}
+	var records []*warc.Record
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+// ReprocessAnalysis runs the page analysis again on the newest snapshot of an analysis, without any network
+// access. Everything derived from the page document is replaced: HTML version, title, headings, link counts,
+// login detection, content and security report. Link checks, iframes, response metadata and TLS details need
+// live requests, the results of the last crawl are kept for them.
+// Only analyses of userID are reprocessed, others are gorm.ErrRecordNotFound.
+func ReprocessAnalysis(ctx context.Context, db *gorm.DB, userID string, analysisID uint) (*models.URLAnalysis, error) {
+	logger := logging.FromContext(ctx).With("analysis_id", analysisID)
+
+	urlAnalysis, err := reprocess(ctx, db, userID, analysisID)
+	if err != nil {
+		metrics.Reprocessed.WithLabelValues("failed").Inc()
+		logger.Warn("Reprocessing failed", "error", err)
+		return nil, err
+	}
+	metrics.Reprocessed.WithLabelValues("done").Inc()
+	logger.Info("Reprocessed analysis from snapshot", "snapshot_id", *urlAnalysis.SnapshotID)
+	return urlAnalysis, nil
+}
+
+// QueueReprocess queues the analyses of userID among ids to be reprocessed in the background, one at a time,
+// so bulk requests don't hold their connection open. It returns the queued ids and the ids of userID that
+// didn't fit into the backlog, ids of other users are in neither. Waiting analyses are lost on restart.
+func QueueReprocess(ctx context.Context, db *gorm.DB, userID string, ids []uint) (queued, backlogFull []uint, err error) {
+	var owned []uint
+	if err := db.Model(&models.URLAnalysis{}).Where("user_id = ? AND id IN ?", userID, ids).Pluck("id", &owned).Error; err != nil {
+		return nil, nil, err
+	}
+
+	startReprocessWorker.Do(func() { go runReprocessBacklog() })
+
+	for _, id := range owned {
+		select {
+		case reprocessBacklog <- reprocessJob{db: db, userID: userID, analysisID: id, requestID: logging.RequestID(ctx)}:
+			queued = append(queued, id)
+		default:
+			backlogFull = append(backlogFull, id)
+		}
+	}
+	return queued, backlogFull, nil
+}
+
+// runReprocessBacklog reprocesses the analyses of bulk requests for the lifetime of the process
+func runReprocessBacklog() {
+	for job := range reprocessBacklog {
+		logger := slog.Default().With("request_id", job.requestID, "user_id", job.userID)
+		ctx := logging.WithLogger(logging.WithRequestID(context.Background(), job.requestID), logger)
+		// failures are logged and counted by ReprocessAnalysis
+		_, _ = ReprocessAnalysis(ctx, job.db, job.userID, job.analysisID)
+	}
+}
+
+func reprocess(ctx context.Context, db *gorm.DB, userID string, analysisID uint) (*models.URLAnalysis, error) {
+	var urlAnalysis models.URLAnalysis
+	if err := db.Where("user_id = ?", userID).First(&urlAnalysis, analysisID).Error; err != nil {
+		return nil, err
+	}
+	if slices.Contains(busyStatuses, urlAnalysis.Status) {
+		return nil, ErrAnalysisRunning
+	}
+
+	snapshot := models.Snapshot{}
+	query := db.Where("url_analysis_id = ?", urlAnalysis.ID).Order("id DESC")
+	if urlAnalysis.SnapshotID != nil {
+		query = query.Where("id = ?", *urlAnalysis.SnapshotID)
+	}
+	if err := query.First(&snapshot).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoSnapshot
+		}
+		return nil, err
+	}
+
+	records, err := loadSnapshotRecords(ctx, snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %d: %w", snapshot.ID, err)
+	}
+
+	opts := analyser.OptionsFromEnv()
+	opts.HTTPClient = &http.Client{Transport: newArchiveTransport(records)}
+	opts.KnownTLS = urlAnalysis.Security.TLS
+	replay, err := analyser.AnalyseDocument(ctx, urlAnalysis.URL, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay snapshot %d: %w", snapshot.ID, err)
+	}
+
+	replay.ApplyPageTo(&urlAnalysis)
+	loginDetection := replay.Login
+	for _, frame := range urlAnalysis.Frames {
+		loginDetection = analyser.MergeFrameLogin(loginDetection, frame.URL, frameLogin(urlAnalysis.LoginDetection, frame))
+	}
+	urlAnalysis.HasLoginForm = loginDetection.Detected
+	urlAnalysis.LoginDetection = loginDetection
+	urlAnalysis.Security = replay.Security
+	now := time.Now()
+	urlAnalysis.ReprocessedAt = &now
+
+	// only the page analysis is written, and not over a crawl started in the meantime
+	result := db.Model(&urlAnalysis).
+		Where("status NOT IN ?", busyStatuses).
+		Select("html_version", "page_title", "h1_count", "h2_count", "h3_count", "h4_count", "h5_count", "h6_count",
+			"internal_link_count", "external_link_count", "word_count", "content", "main_content",
+			"has_login_form", "login_detection", "security", "reprocessed_at").
+		Updates(&urlAnalysis)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrAnalysisRunning
+	}
+
+	urlAnalysis.SnapshotID = &snapshot.ID
+	return &urlAnalysis, nil
+}
+
+// frameLogin rebuilds the login detection of an iframe from the evidence kept on the analysis,
+// iframes aren't part of snapshots
+func frameLogin(previous models.LoginDetection, frame models.FrameAnalysis) models.LoginDetection {
+	detection := models.LoginDetection{Detected: frame.HasLoginForm, Type: frame.LoginType, Evidence: []models.LoginEvidence{}}
+	for _, evidence := range previous.Evidence {
+		if evidence.Frame == frame.URL {
+			detection.Evidence = append(detection.Evidence, evidence)
+			detection.Score += evidence.Score
+		}
+	}
+	detection.Score = min(detection.Score, 100)
+	return detection
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"web-scraper/analyser"
+	"web-scraper/config"
+	"web-scraper/metrics"
+	"web-scraper/models"
+)
+
+// attempt history entries kept per analysis
+const maxAttemptHistory = 20
+
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// loadRetryPolicy reads the retry settings of errored analyses
+// CRAWL_RETRY_MAX_ATTEMPTS is the total number of runs (default 3, 1 disables retries),
+// CRAWL_RETRY_BASE_DELAY the delay before the first retry (default 30s), doubled for every further retry
+// up to CRAWL_RETRY_MAX_DELAY (default 10m).
+func loadRetryPolicy() retryPolicy {
+	return retryPolicy{
+		maxAttempts: config.GetEnvInt("CRAWL_RETRY_MAX_ATTEMPTS", 3),
+		baseDelay:   config.GetEnvDuration("CRAWL_RETRY_BASE_DELAY", 30*time.Second),
+		maxDelay:    config.GetEnvDuration("CRAWL_RETRY_MAX_DELAY", 10*time.Minute),
+	}
+}
+
+// shouldRetry reports whether a failure after attempts runs gets another one
+func (p retryPolicy) shouldRetry(failure analyser.Failure, attempts int) bool {
+	return failure.Transient && attempts < p.maxAttempts
+}
+
+// delay is the exponential backoff after attempts runs, with jitter so analyses failing together
+// (e.g. on a DNS outage) don't all come back at the same moment
+func (p retryPolicy) delay(attempts int) time.Duration {
+	d := p.baseDelay
+	for i := 1; i < attempts && d < p.maxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, p.maxDelay)
+	if d <= 0 {
+		return 0
+	}
+	// equal jitter: between half and the full delay
+	return d/2 + rand.N(d/2+1)
+}
+
+// delayAfter is the delay after attempts runs when the page asked for retryAfter (its Retry-After header,
+// 0 when it didn't). The server's wait is honoured up to maxDelay, a shorter one doesn't cut the backoff.
+func (p retryPolicy) delayAfter(attempts int, retryAfter time.Duration) time.Duration {
+	return max(p.delay(attempts), min(retryAfter, p.maxDelay))
+}
+
+// parseRetryAfter reads a Retry-After header, delay seconds or an HTTP date, relative to now. Missing,
+// invalid and past values are 0.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
+// recordAttempt appends a run to the attempt history, the oldest entries go first once the cap is reached
+func recordAttempt(urlAnalysis *models.URLAnalysis, attempt models.CrawlAttempt) {
+	history := append(urlAnalysis.AttemptHistory, attempt)
+	if len(history) > maxAttemptHistory {
+		history = history[len(history)-maxAttemptHistory:]
+	}
+	urlAnalysis.AttemptHistory = history
+}
+
+// scheduleRetry queues the analysis again once its retry is due. Nothing happens when the analysis
+// was re-submitted, cancelled or retried otherwise in the meantime.
+func scheduleRetry(repo Repository, id uint, attempts int, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		ctx := context.Background()
+		urlAnalysis, err := repo.LoadAnalysis(ctx, id)
+		if err != nil {
+			slog.Error("Couldn't load analysis for retry", "analysis_id", id, "error", err)
+			return
+		}
+		if urlAnalysis.Status != "retrying" || urlAnalysis.Attempts != attempts {
+			return
+		}
+
+		// queued first, so a shutdown refusing the job leaves it to RequeueInterrupted
+		queued, err := repo.QueueRetry(ctx, id, attempts)
+		if err != nil {
+			metrics.DBSaveFailures.WithLabelValues("retry").Inc()
+			slog.Error("Failed to queue retry", "analysis_id", id, "error", err)
+			return
+		}
+		if !queued {
+			return
+		}
+
+		lane, ok := ParseLane(urlAnalysis.Lane)
+		if !ok {
+			lane = LaneInteractive
+		}
+		if err := EnqueueURL(ctx, id, urlAnalysis.UserID, lane); err != nil {
+			slog.Warn("Retry not queued", "analysis_id", id, "error", err)
+		}
+	})
+}
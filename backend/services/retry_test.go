@@ -0,0 +1,116 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+	"web-scraper/analyser"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := retryPolicy{maxAttempts: 10, baseDelay: 30 * time.Second, maxDelay: 10 * time.Minute}
+
+	// equal jitter: between half and the full backoff, doubled per attempt and capped at maxDelay
+	tests := []struct {
+		attempts int
+		backoff  time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{6, 10 * time.Minute},
+		{7, 10 * time.Minute},
+		{100, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		for range 200 {
+			if d := policy.delay(tt.attempts); d < tt.backoff/2 || d > tt.backoff {
+				t.Fatalf("delay(%d) = %s, want between %s and %s", tt.attempts, d, tt.backoff/2, tt.backoff)
+			}
+		}
+	}
+
+	if d := (retryPolicy{maxAttempts: 3}).delay(2); d != 0 {
+		t.Errorf("delay without a base delay = %s, want 0", d)
+	}
+	// a base delay above the cap is capped too
+	if d := (retryPolicy{baseDelay: time.Hour, maxDelay: time.Minute}).delay(1); d > time.Minute {
+		t.Errorf("delay with a base delay above the cap = %s, want at most 1m", d)
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	policy := retryPolicy{maxAttempts: 3}
+	transient := analyser.Failure{Category: analyser.ErrorCategoryHTTPServer, Transient: true}
+	permanent := analyser.Failure{Category: analyser.ErrorCategoryHTTPClient}
+
+	tests := []struct {
+		name     string
+		failure  analyser.Failure
+		attempts int
+		want     bool
+	}{
+		{"transient after the first run", transient, 1, true},
+		{"transient after the second run", transient, 2, true},
+		{"transient after the last run", transient, 3, false},
+		{"permanent", permanent, 1, false},
+	}
+	for _, tt := range tests {
+		if got := policy.shouldRetry(tt.failure, tt.attempts); got != tt.want {
+			t.Errorf("%s: shouldRetry = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if (retryPolicy{maxAttempts: 1}).shouldRetry(transient, 1) {
+		t.Error("retried with a single attempt allowed")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{" 5 ", 5 * time.Second},
+		{"0", 0},
+		{"-30", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Hour).Format(http.TimeFormat), 0},
+		// the obsolete RFC 850 date format is still accepted
+		{now.Add(time.Hour).Format(time.RFC850), time.Hour},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyDelayAfter(t *testing.T) {
+	policy := retryPolicy{maxAttempts: 5, baseDelay: 30 * time.Second, maxDelay: 10 * time.Minute}
+
+	tests := []struct {
+		name       string
+		attempts   int
+		retryAfter time.Duration
+		min, max   time.Duration
+	}{
+		{"no Retry-After", 1, 0, 15 * time.Second, 30 * time.Second},
+		{"longer Retry-After", 1, 5 * time.Minute, 5 * time.Minute, 5 * time.Minute},
+		{"Retry-After beyond the cap", 1, time.Hour, 10 * time.Minute, 10 * time.Minute},
+		{"shorter Retry-After keeps the backoff", 3, time.Second, time.Minute, 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		for range 100 {
+			if d := policy.delayAfter(tt.attempts, tt.retryAfter); d < tt.min || d > tt.max {
+				t.Fatalf("%s: delayAfter(%d, %s) = %s, want between %s and %s", tt.name, tt.attempts, tt.retryAfter, d, tt.min, tt.max)
+			}
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"sync"
+	"web-scraper/metrics"
+)
+
+// Lane is the priority class of a queued analysis
+type Lane string
+
+const (
+	// LaneInteractive is for URLs submitted one at a time by a user waiting for the result
+	LaneInteractive Lane = "interactive"
+	// LaneScheduled is for recurring checks
+	LaneScheduled Lane = "scheduled"
+	// LaneBulk is for imports of many URLs at once
+	LaneBulk Lane = "bulk"
+)
+
+// lanes in order of priority
+var laneOrder = []Lane{LaneInteractive, LaneScheduled, LaneBulk}
+
+// share of the dispatches each lane gets while all of them have work, a bulk import still moves
+// when interactive checks keep coming in
+var laneWeights = map[Lane]int{
+	LaneInteractive: 6,
+	LaneScheduled:   3,
+	LaneBulk:        1,
+}
+
+// ParseLane returns the lane named s, the interactive lane for an empty s
+func ParseLane(s string) (Lane, bool) {
+	if s == "" {
+		return LaneInteractive, true
+	}
+	for _, lane := range laneOrder {
+		if string(lane) == s {
+			return lane, true
+		}
+	}
+	return "", false
+}
+
+// laneQueue holds the jobs of one lane per tenant, tenants take turns round robin
+type laneQueue struct {
+	tenants map[string][]analysisJob
+	ring    []string // tenants with queued jobs, in turn order
+	next    int
+	size    int
+	// current weight of the smooth weighted round robin between lanes
+	credit int
+}
+
+// nextTenant returns the ring index of the first tenant from the current turn on that has a job and may run it
+func (q *laneQueue) nextTenant(canRun func(userID string) bool) int {
+	for i := range q.ring {
+		idx := (q.next + i) % len(q.ring)
+		if canRun(q.ring[idx]) {
+			return idx
+		}
+	}
+	return -1
+}
+
+func (q *laneQueue) push(job analysisJob) {
+	if _, ok := q.tenants[job.UserID]; !ok {
+		q.ring = append(q.ring, job.UserID)
+	}
+	q.tenants[job.UserID] = append(q.tenants[job.UserID], job)
+	q.size++
+}
+
+func (q *laneQueue) pop(idx int) analysisJob {
+	userID := q.ring[idx]
+	jobs := q.tenants[userID]
+	job := jobs[0]
+	q.size--
+
+	if len(jobs) == 1 {
+		delete(q.tenants, userID)
+		q.ring = append(q.ring[:idx], q.ring[idx+1:]...)
+		q.next = idx // the following tenant moved into this slot
+	} else {
+		q.tenants[userID] = jobs[1:]
+		q.next = idx + 1
+	}
+	if len(q.ring) > 0 {
+		q.next %= len(q.ring)
+	} else {
+		q.next = 0
+	}
+	return job
+}
+
+// scheduler is the queue of the worker pool. Jobs are dispatched by lane weight, round robin across
+// the users of a lane, and never beyond the per-user concurrency limit.
+// It also tracks the pool size so workers can be added and retired at runtime.
+type scheduler struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	lanes   map[Lane]*laneQueue
+	queued  map[uint]bool  // analysis IDs waiting, an analysis is queued once
+	running map[string]int // jobs being processed per user
+
+	maxJobsPerUser int // 0 means no limit
+
+	workers      int // worker goroutines alive
+	target       int // desired pool size
+	busy         int
+	nextWorkerID int
+
+	closed bool
+}
+
+func newScheduler(maxJobsPerUser int) *scheduler {
+	s := &scheduler{
+		lanes:          map[Lane]*laneQueue{},
+		queued:         map[uint]bool{},
+		running:        map[string]int{},
+		maxJobsPerUser: maxJobsPerUser,
+	}
+	for _, lane := range laneOrder {
+		s.lanes[lane] = &laneQueue{tenants: map[string][]analysisJob{}}
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// push queues job, it reports false when the scheduler is closed or the analysis is already waiting
+func (s *scheduler) push(job analysisJob) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	if s.queued[job.ID] {
+		return true
+	}
+
+	q, ok := s.lanes[job.Lane]
+	if !ok {
+		job.Lane = LaneInteractive
+		q = s.lanes[job.Lane]
+	}
+	q.push(job)
+	s.queued[job.ID] = true
+	metrics.QueuedJobs.WithLabelValues(string(job.Lane)).Set(float64(q.size))
+
+	s.cond.Broadcast()
+	return true
+}
+
+// pop blocks until a job may run. It returns false once the scheduler is closed or when the
+// calling worker has to retire because the pool was shrunk.
+func (s *scheduler) pop() (analysisJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		if s.closed || s.workers > s.target {
+			s.workers--
+			return analysisJob{}, false
+		}
+		if job, ok := s.take(); ok {
+			s.running[job.UserID]++
+			s.busy++
+			return job, true
+		}
+		s.cond.Wait()
+	}
+}
+
+func (s *scheduler) canRun(userID string) bool {
+	return s.maxJobsPerUser <= 0 || s.running[userID] < s.maxJobsPerUser
+}
+
+// take picks the lane by smooth weighted round robin among the lanes with a runnable job,
+// then the next user in turn within it. It must be called with s.mu held.
+func (s *scheduler) take() (analysisJob, bool) {
+	var chosen *laneQueue
+	var chosenTenant, totalWeight int
+	var chosenLane Lane
+
+	for _, lane := range laneOrder {
+		q := s.lanes[lane]
+		if q.size == 0 {
+			continue
+		}
+		idx := q.nextTenant(func(userID string) bool { return s.canRun(userID) })
+		if idx < 0 {
+			continue
+		}
+
+		q.credit += laneWeights[lane]
+		totalWeight += laneWeights[lane]
+		if chosen == nil || q.credit > chosen.credit {
+			chosen, chosenTenant, chosenLane = q, idx, lane
+		}
+	}
+	if chosen == nil {
+		return analysisJob{}, false
+	}
+
+	chosen.credit -= totalWeight
+	job := chosen.pop(chosenTenant)
+	delete(s.queued, job.ID)
+	metrics.QueuedJobs.WithLabelValues(string(chosenLane)).Set(float64(chosen.size))
+	return job, true
+}
+
+// done releases the per-user slot of a finished job
+func (s *scheduler) done(job analysisJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.busy--
+	if s.running[job.UserID]--; s.running[job.UserID] <= 0 {
+		delete(s.running, job.UserID)
+	}
+	s.cond.Broadcast()
+}
+
+// resize sets the pool size and returns the IDs of the workers to start, surplus workers retire
+// once they are done with their current job
+func (s *scheduler) resize(size int) []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.target = size
+	var start []int
+	for s.workers < s.target && !s.closed {
+		start = append(start, s.nextWorkerID)
+		s.nextWorkerID++
+		s.workers++
+	}
+	metrics.WorkersTotal.Set(float64(s.target))
+
+	s.cond.Broadcast()
+	return start
+}
+
+func (s *scheduler) setMaxJobsPerUser(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxJobsPerUser = limit
+	s.cond.Broadcast()
+}
+
+// close stops dispatching, jobs still waiting are dropped as their rows stay queued in the database
+func (s *scheduler) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	s.cond.Broadcast()
+}
+
+func (s *scheduler) depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queued)
+}
+
+// PoolStatus describes the worker pool and its queue as reported by the admin API
+type PoolStatus struct {
+	Workers        int            `json:"workers"`
+	Target         int            `json:"target"`
+	Busy           int            `json:"busy"`
+	MaxJobsPerUser int            `json:"maxJobsPerUser"`
+	Queued         map[Lane]int   `json:"queued"`
+	QueuedUsers    map[Lane]int   `json:"queuedUsers"`
+	RunningByUser  map[string]int `json:"runningByUser"`
+	LaneWeights    map[Lane]int   `json:"laneWeights"`
+}
+
+func (s *scheduler) status() PoolStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := PoolStatus{
+		Workers:        s.workers,
+		Target:         s.target,
+		Busy:           s.busy,
+		MaxJobsPerUser: s.maxJobsPerUser,
+		Queued:         map[Lane]int{},
+		QueuedUsers:    map[Lane]int{},
+		RunningByUser:  map[string]int{},
+		LaneWeights:    laneWeights,
+	}
+	for lane, q := range s.lanes {
+		status.Queued[lane] = q.size
+		status.QueuedUsers[lane] = len(q.ring)
+	}
+	for userID, running := range s.running {
+		status.RunningByUser[userID] = running
+	}
+	return status
+}
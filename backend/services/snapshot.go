@@ -0,0 +1,122 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+	"web-scraper/analyser"
+	"web-scraper/blobstore"
+	"web-scraper/config"
+	"web-scraper/logging"
+	"web-scraper/models"
+	"web-scraper/tracing"
+	"web-scraper/warc"
+)
+
+var ErrSnapshotStoreNotConfigured = errors.New("snapshot store is not configured")
+
+// the blob store snapshots are written to, set with SetSnapshotStore
+var snapshotStore blobstore.Store
+
+// SetSnapshotStore sets where snapshots are archived and read from
+func SetSnapshotStore(store blobstore.Store) {
+	snapshotStore = store
+}
+
+// OpenSnapshot returns the WARC file of snapshot, the caller closes it
+func OpenSnapshot(ctx context.Context, snapshot models.Snapshot) (io.ReadCloser, error) {
+	if snapshotStore == nil {
+		return nil, ErrSnapshotStoreNotConfigured
+	}
+	return snapshotStore.Get(ctx, snapshot.BlobKey)
+}
+
+// archiveOptions controls snapshot archiving, CRAWL_ARCHIVE turns it on
+type archiveOptions struct {
+	capture analyser.CaptureOptions
+	// snapshots kept per analysis, older ones are deleted
+	keep int
+}
+
+func loadArchiveOptions() archiveOptions {
+	return archiveOptions{
+		capture: analyser.CaptureOptions{
+			Enabled:      config.GetEnvBool("CRAWL_ARCHIVE", false),
+			Resources:    config.GetEnvBool("CRAWL_ARCHIVE_RESOURCES", false),
+			MaxResources: config.GetEnvInt("CRAWL_ARCHIVE_MAX_RESOURCES", 50),
+			MaxBodyBytes: int64(config.GetEnvInt("CRAWL_ARCHIVE_MAX_BODY_BYTES", 10<<20)),
+		},
+		keep: config.GetEnvInt("CRAWL_ARCHIVE_KEEP", 5),
+	}
+}
+
+// saveSnapshot writes the captured exchanges as a WARC file to the snapshot store and records it,
+// snapshots of the analysis beyond the newest keep are deleted. It returns nil when nothing was captured.
+func saveSnapshot(ctx context.Context, repo Repository, urlAnalysis *models.URLAnalysis, capture *analyser.Capture, keep int) (*models.Snapshot, error) {
+	if snapshotStore == nil {
+		return nil, ErrSnapshotStoreNotConfigured
+	}
+	if capture.Empty() {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	w := warc.NewWriter(&buf, true)
+
+	info := w.NewRecord(warc.TypeWarcinfo, "application/warc-fields", []byte(fmt.Sprintf(
+		"software: %s\r\nformat: WARC File Format 1.1\r\nisPartOf: analysis-%d\r\n", tracing.ServiceName(), urlAnalysis.ID)))
+	if err := w.WriteRecord(info); err != nil {
+		return nil, err
+	}
+	stats, err := capture.WriteRecords(w)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := models.Snapshot{
+		URLAnalysisID: urlAnalysis.ID,
+		Attempt:       urlAnalysis.Attempts,
+		URL:           urlAnalysis.URL,
+		Records:       1 + stats.Records,
+		Resources:     stats.Resources,
+		Truncated:     stats.Truncated,
+		Size:          int64(buf.Len()),
+	}
+	snapshot.BlobKey = fmt.Sprintf("snapshots/%d/%s-%d.warc.gz", urlAnalysis.ID, time.Now().UTC().Format("20060102T150405Z"), urlAnalysis.Attempts)
+	if err := snapshotStore.Put(ctx, snapshot.BlobKey, &buf, "application/warc"); err != nil {
+		return nil, fmt.Errorf("failed to store snapshot: %w", err)
+	}
+	if err := repo.AddSnapshot(ctx, &snapshot); err != nil {
+		snapshotStore.Delete(ctx, snapshot.BlobKey)
+		return nil, err
+	}
+
+	pruneSnapshots(ctx, repo, urlAnalysis.ID, keep)
+	return &snapshot, nil
+}
+
+// pruneSnapshots deletes all but the newest keep snapshots of an analysis, failures are logged and only
+// leave them behind
+func pruneSnapshots(ctx context.Context, repo Repository, analysisID uint, keep int) {
+	if keep <= 0 {
+		return
+	}
+	logger := logging.FromContext(ctx).With("analysis_id", analysisID)
+	old, err := repo.SnapshotsBeyond(ctx, analysisID, keep)
+	if err != nil {
+		logger.Warn("Failed to find snapshots to prune", "error", err)
+		return
+	}
+	for _, snapshot := range old {
+		if err := snapshotStore.Delete(ctx, snapshot.BlobKey); err != nil {
+			logger.Warn("Failed to delete the file of a pruned snapshot", "snapshot_id", snapshot.ID, "error", err)
+			continue
+		}
+		if err := repo.DeleteSnapshot(ctx, &snapshot); err != nil {
+			logger.Warn("Failed to delete a pruned snapshot", "snapshot_id", snapshot.ID, "error", err)
+		}
+	}
+}
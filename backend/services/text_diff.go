@@ -0,0 +1,191 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// lines of context around every change of a unified diff
+	diffContextLines = 3
+	// above this many cells the changed middle of two texts is diffed as a whole block
+	maxDiffCells = 1 << 20
+	// unified diffs are cut at this size
+	maxTextDiffBytes = 64 << 10
+)
+
+type diffOp struct {
+	kind byte // ' ' kept, '-' removed, '+' added
+	line string
+}
+
+// diffLines returns the edit script turning a into b, a longest common subsequence of lines is kept
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+func diffMiddle(a, b []string) []diffOp {
+	var ops []diffOp
+	if len(a)*len(b) > maxDiffCells {
+		// too large to align line by line, reported as replaced
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// unifiedDiff returns the changes from a to b in unified diff format with the number of added and removed lines
+func unifiedDiff(a, b []string, fromLabel, toLabel string) (string, int, int) {
+	ops := diffLines(a, b)
+
+	var added, removed int
+	var changes []int
+	for i, op := range ops {
+		switch op.kind {
+		case '+':
+			added++
+			changes = append(changes, i)
+		case '-':
+			removed++
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return "", 0, 0
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromLabel, toLabel)
+
+	// line numbers of a and b at the start of every op
+	aLine, bLine := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if op.kind != '+' {
+			aLine[i+1]++
+		}
+		if op.kind != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	for c := 0; c < len(changes); {
+		// a hunk takes in every change within twice the context of the previous one
+		start := max(changes[c]-diffContextLines, 0)
+		end := changes[c]
+		for c < len(changes) && changes[c] <= end+2*diffContextLines {
+			end = changes[c]
+			c++
+		}
+		end = min(end+diffContextLines+1, len(ops))
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aLine[start]+1, aLine[end]-aLine[start], bLine[start]+1, bLine[end]-bLine[start])
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			out.WriteByte('\n')
+		}
+		if out.Len() > maxTextDiffBytes {
+			return truncateUTF8(out.String(), maxTextDiffBytes) + "\n... diff truncated\n", added, removed
+		}
+	}
+	return out.String(), added, removed
+}
+
+// setDiff returns the entries only in b and the ones only in a, in their original order
+func setDiff(a, b []string) ([]string, []string) {
+	inA, inB := map[string]bool{}, map[string]bool{}
+	for _, s := range a {
+		inA[s] = true
+	}
+	for _, s := range b {
+		inB[s] = true
+	}
+
+	added, removed := []string{}, []string{}
+	for _, s := range b {
+		if !inA[s] {
+			added = append(added, s)
+			inA[s] = true // once per entry
+		}
+	}
+	for _, s := range a {
+		if !inB[s] {
+			removed = append(removed, s)
+			inB[s] = true
+		}
+	}
+	return added, removed
+}
+
+// truncateUTF8 cuts s to at most limit bytes without splitting a character
+func truncateUTF8(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	s = s[:limit]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
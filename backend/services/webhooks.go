@@ -0,0 +1,316 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+	"web-scraper/config"
+	"web-scraper/metrics"
+	"web-scraper/models"
+	"web-scraper/netguard"
+	"web-scraper/tracing"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EventWebhookPing is sent by SendWebhookPing to check a receiver, whatever the webhook subscribed to
+const EventWebhookPing EventType = "webhook.ping"
+
+// the part of a rejected delivery's response body kept in its attempt log
+const maxDeliveryResponseBytes = 1 << 10
+
+// attempt log entries kept per delivery
+const maxDeliveryAttemptLog = 20
+
+var ErrWebhooksNotEnabled = errors.New("webhooks are not enabled")
+
+// webhookOptions controls webhook deliveries
+type webhookOptions struct {
+	// retries of failed deliveries, with the same exponential backoff as crawl retries
+	retry   retryPolicy
+	timeout time.Duration
+}
+
+// loadWebhookOptions reads WEBHOOK_MAX_ATTEMPTS (default 6), WEBHOOK_RETRY_BASE_DELAY (default 30s),
+// WEBHOOK_RETRY_MAX_DELAY (default 1h) and WEBHOOK_TIMEOUT (default 10s)
+func loadWebhookOptions() webhookOptions {
+	return webhookOptions{
+		retry: retryPolicy{
+			maxAttempts: config.GetEnvInt("WEBHOOK_MAX_ATTEMPTS", 6),
+			baseDelay:   config.GetEnvDuration("WEBHOOK_RETRY_BASE_DELAY", 30*time.Second),
+			maxDelay:    config.GetEnvDuration("WEBHOOK_RETRY_MAX_DELAY", time.Hour),
+		},
+		timeout: config.GetEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+	}
+}
+
+// webhookDispatcher sends the deliveries of events to the subscribed webhooks
+type webhookDispatcher struct {
+	db     *gorm.DB
+	client *http.Client
+	opts   webhookOptions
+}
+
+// the dispatcher set up by EnableWebhooks
+var webhooks *webhookDispatcher
+
+// EnableWebhooks delivers published events to the webhooks subscribed to them and resumes the deliveries
+// a previous process left pending. It must be called once per process.
+func EnableWebhooks(db *gorm.DB) error {
+	opts := loadWebhookOptions()
+	d := &webhookDispatcher{
+		db:     db,
+		client: guardedHTTPClient(netguard.Default(), opts.timeout),
+		opts:   opts,
+	}
+
+	var pending []models.WebhookDelivery
+	if err := db.Select("id", "next_attempt_at").Where("status IN ?", []string{models.DeliveryPending, models.DeliveryRetrying}).Find(&pending).Error; err != nil {
+		return err
+	}
+	for _, delivery := range pending {
+		var delay time.Duration
+		if delivery.NextAttemptAt != nil {
+			delay = max(time.Until(*delivery.NextAttemptAt), 0)
+		}
+		d.schedule(delivery.ID, delay)
+	}
+	if len(pending) > 0 {
+		slog.Info("Resumed webhook deliveries", "count", len(pending))
+	}
+
+	webhooks = d
+	SubscribeEvents(d.queue)
+	return nil
+}
+
+// guardedHTTPClient returns a client for posting to user submitted URLs, they go through guard, the
+// SSRF policy of crawls outside tests
+func guardedHTTPClient(guard *netguard.Policy, timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: guard.Transport(&http.Transport{
+			DialContext:         guard.DialContext(dialer),
+			TLSHandshakeTimeout: 10 * time.Second,
+		}),
+		// a redirect is an answer, following it would post the payload to a host nobody subscribed
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// NewWebhookSecret returns a random signing secret for a webhook
+func NewWebhookSecret() models.EncryptedString {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return models.EncryptedString("whsec_" + hex.EncodeToString(b))
+}
+
+// SignWebhookPayload returns the X-Webhook-Signature of a payload sent at timestamp (unix seconds),
+// the hex HMAC-SHA256 of "<timestamp>.<payload>" keyed with the secret of the webhook
+func SignWebhookPayload(secret models.EncryptedString, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// queue stores a delivery for every active webhook of the user subscribed to the event and sends them
+func (d *webhookDispatcher) queue(event Event) {
+	if event.UserID == "" {
+		return
+	}
+
+	var subscribed []models.Webhook
+	if err := d.db.Where("user_id = ? AND active = ?", event.UserID, true).Find(&subscribed).Error; err != nil {
+		slog.Error("Failed to load webhooks", "event", event.Type, "analysis_id", event.AnalysisID, "error", err)
+		return
+	}
+	for _, webhook := range subscribed {
+		if webhook.Subscribed(string(event.Type)) {
+			d.deliver(webhook, event)
+		}
+	}
+}
+
+// deliver stores a delivery of event to webhook and sends it in the background
+func (d *webhookDispatcher) deliver(webhook models.Webhook, event Event) (*models.WebhookDelivery, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	delivery := models.WebhookDelivery{
+		WebhookID:  webhook.ID,
+		UserID:     webhook.UserID,
+		EventID:    event.ID,
+		EventType:  string(event.Type),
+		AnalysisID: event.AnalysisID,
+		Payload:    models.LongText(payload),
+		Status:     models.DeliveryPending,
+		AttemptLog: models.DeliveryAttempts{},
+	}
+	if err := d.db.Create(&delivery).Error; err != nil {
+		metrics.DBSaveFailures.WithLabelValues("webhook_delivery").Inc()
+		slog.Error("Failed to store webhook delivery", "webhook_id", webhook.ID, "event", event.Type, "error", err)
+		return nil, err
+	}
+	d.schedule(delivery.ID, 0)
+	return &delivery, nil
+}
+
+func (d *webhookDispatcher) schedule(id uint, delay time.Duration) {
+	time.AfterFunc(delay, func() { d.attempt(id) })
+}
+
+// attempt posts a delivery once. Failed deliveries are retried with backoff until the attempts run out,
+// then they are dead and stay in the dead letter list until redelivered.
+func (d *webhookDispatcher) attempt(id uint) {
+	var delivery models.WebhookDelivery
+	if err := d.db.First(&delivery, id).Error; err != nil {
+		slog.Error("Couldn't load webhook delivery", "delivery_id", id, "error", err)
+		return
+	}
+	if delivery.Status != models.DeliveryPending && delivery.Status != models.DeliveryRetrying {
+		return
+	}
+
+	// claimed first, a redelivery racing a retry timer sends the payload only once
+	claim := d.db.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND attempts = ? AND status IN ?", id, delivery.Attempts, []string{models.DeliveryPending, models.DeliveryRetrying}).
+		Update("attempts", delivery.Attempts+1)
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		return
+	}
+	delivery.Attempts++
+
+	logger := slog.With("delivery_id", delivery.ID, "webhook_id", delivery.WebhookID, "event", delivery.EventType, "attempt", delivery.Attempts)
+
+	var webhook models.Webhook
+	result := models.DeliveryAttempt{Attempt: delivery.Attempts, Time: time.Now()}
+	err := d.db.First(&webhook, delivery.WebhookID).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		result.Error = "webhook was deleted"
+	case err != nil:
+		result.Error = "failed to load webhook: " + err.Error()
+	case !webhook.Active:
+		result.Error = "webhook is disabled"
+	default:
+		result = d.post(webhook, delivery, result)
+	}
+
+	delivery.AttemptLog = append(delivery.AttemptLog, result)
+	if len(delivery.AttemptLog) > maxDeliveryAttemptLog {
+		delivery.AttemptLog = delivery.AttemptLog[len(delivery.AttemptLog)-maxDeliveryAttemptLog:]
+	}
+	delivery.NextAttemptAt = nil
+
+	var retryDelay time.Duration
+	switch {
+	case result.Error == "" && result.StatusCode >= 200 && result.StatusCode < 300:
+		delivery.Status = models.DeliveryDelivered
+		delivery.DeliveredAt = &result.Time
+		logger.Info("Webhook delivered", "status_code", result.StatusCode, "duration_ms", result.DurationMs)
+	case webhook.Active && delivery.Attempts < d.opts.retry.maxAttempts:
+		retryDelay = d.opts.retry.delay(delivery.Attempts)
+		nextAttemptAt := time.Now().Add(retryDelay)
+		delivery.Status = models.DeliveryRetrying
+		delivery.NextAttemptAt = &nextAttemptAt
+		logger.Warn("Webhook delivery failed, retry scheduled", "status_code", result.StatusCode, "error", result.Error, "retry_in", retryDelay.Round(time.Millisecond))
+	default:
+		delivery.Status = models.DeliveryDead
+		logger.Error("Webhook delivery failed, moved to dead letters", "status_code", result.StatusCode, "error", result.Error)
+	}
+	metrics.WebhookDeliveries.WithLabelValues(delivery.Status).Inc()
+
+	if err := d.db.Model(&delivery).Select("status", "next_attempt_at", "delivered_at", "attempt_log").Updates(&delivery).Error; err != nil {
+		metrics.DBSaveFailures.WithLabelValues("webhook_delivery").Inc()
+		logger.Error("Failed to save webhook delivery", "error", err)
+		return
+	}
+	if delivery.Status == models.DeliveryRetrying {
+		d.schedule(delivery.ID, retryDelay)
+	}
+}
+
+// post sends the payload of delivery to webhook and returns the outcome
+func (d *webhookDispatcher) post(webhook models.Webhook, delivery models.WebhookDelivery, result models.DeliveryAttempt) models.DeliveryAttempt {
+	payload := []byte(delivery.Payload)
+	timestamp := result.Time.Unix()
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.opts.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", tracing.ServiceName()+"-webhooks")
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", SignWebhookPayload(webhook.Secret, timestamp, payload))
+
+	resp, err := d.client.Do(req)
+	result.DurationMs = time.Since(result.Time).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxDeliveryResponseBytes))
+		result.Response = truncateUTF8(string(body), maxDeliveryResponseBytes)
+	}
+	return result
+}
+
+// RedeliverWebhook sends a delivery once more, e.g. one from the dead letter list. A delivery that
+// already used up its attempts gets a single one, without further retries.
+func RedeliverWebhook(db *gorm.DB, delivery *models.WebhookDelivery) error {
+	if webhooks == nil {
+		return ErrWebhooksNotEnabled
+	}
+	if err := db.Model(delivery).Select("status", "next_attempt_at").Updates(map[string]interface{}{"status": models.DeliveryPending, "next_attempt_at": nil}).Error; err != nil {
+		return err
+	}
+	delivery.Status = models.DeliveryPending
+	delivery.NextAttemptAt = nil
+	webhooks.schedule(delivery.ID, 0)
+	return nil
+}
+
+// SendWebhookPing delivers a webhook.ping event to webhook, to check the receiver and its signature verification
+func SendWebhookPing(webhook models.Webhook) (*models.WebhookDelivery, error) {
+	if webhooks == nil {
+		return nil, ErrWebhooksNotEnabled
+	}
+	return webhooks.deliver(webhook, Event{
+		ID:     uuid.NewString(),
+		Type:   EventWebhookPing,
+		UserID: webhook.UserID,
+		Time:   time.Now(),
+		Data:   map[string]any{"webhookId": webhook.ID},
+	})
+}
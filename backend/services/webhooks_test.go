@@ -0,0 +1,300 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"web-scraper/models"
+	"web-scraper/netguard"
+
+	"gorm.io/gorm"
+)
+
+// receivedWebhook is a request the fake receiver got
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+	time   time.Time
+}
+
+// webhookReceiver answers deliveries with the status codes of its script in turn, the last one repeats
+type webhookReceiver struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	script   []int
+	requests []receivedWebhook
+}
+
+func startWebhookReceiver(t *testing.T, script ...int) *webhookReceiver {
+	t.Helper()
+	r := &webhookReceiver{script: script}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.requests = append(r.requests, receivedWebhook{header: req.Header.Clone(), body: body, time: time.Now()})
+		status := r.script[min(len(r.requests), len(r.script))-1]
+		r.mu.Unlock()
+
+		w.WriteHeader(status)
+		if status >= 300 {
+			io.WriteString(w, "unavailable, try later")
+		}
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *webhookReceiver) received() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedWebhook(nil), r.requests...)
+}
+
+// setScript changes the answers of the following requests
+func (r *webhookReceiver) setScript(script ...int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.script = append(make([]int, len(r.requests)), script...)
+}
+
+// newTestDispatcher returns a dispatcher posting through the SSRF guard with 127.0.0.1 allowed, so the
+// receivers of the tests are reachable, and with retries a few milliseconds apart
+func newTestDispatcher(t *testing.T, maxAttempts int) *webhookDispatcher {
+	t.Helper()
+	t.Setenv("CRAWL_SECRETS_KEY", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	opts := webhookOptions{
+		retry:   retryPolicy{maxAttempts: maxAttempts, baseDelay: 40 * time.Millisecond, maxDelay: 80 * time.Millisecond},
+		timeout: 5 * time.Second,
+	}
+	return &webhookDispatcher{
+		db:     newTestDB(t),
+		client: guardedHTTPClient(netguard.NewPolicy("127.0.0.1", ""), opts.timeout),
+		opts:   opts,
+	}
+}
+
+func createWebhook(t *testing.T, db *gorm.DB, url string) models.Webhook {
+	t.Helper()
+	webhook := models.Webhook{UserID: "alice", URL: url, Events: models.StringList{string(EventAnalysisCompleted)}, Active: true, Secret: NewWebhookSecret()}
+	if err := db.Create(&webhook).Error; err != nil {
+		t.Fatal(err)
+	}
+	return webhook
+}
+
+// waitForDelivery waits until the delivery reached status and returns it
+func waitForDelivery(t *testing.T, db *gorm.DB, id uint, status string) models.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		// a fresh struct every time, scanning NULL leaves the pointers of a used one set
+		var delivery models.WebhookDelivery
+		if err := db.First(&delivery, id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if delivery.Status == status {
+			return delivery
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery %d is %s after %d attempts, want %s: %+v", id, delivery.Status, delivery.Attempts, status, delivery.AttemptLog)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func completedEvent() Event {
+	return Event{ID: "3f8e2a9c-1b7d-4c55-9e0a-2d6f4b8c1a37", Type: EventAnalysisCompleted, AnalysisID: 7, UserID: "alice", URL: "https://example.com", Time: time.Now()}
+}
+
+func TestWebhookDeliverySignature(t *testing.T) {
+	receiver := startWebhookReceiver(t, http.StatusNoContent)
+	d := newTestDispatcher(t, 3)
+	webhook := createWebhook(t, d.db, receiver.server.URL+"/hooks")
+
+	queued, err := d.deliver(webhook, completedEvent())
+	if err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	delivery := waitForDelivery(t, d.db, queued.ID, models.DeliveryDelivered)
+	if delivery.Attempts != 1 || delivery.DeliveredAt == nil {
+		t.Errorf("delivered after %d attempts at %v, want the first one", delivery.Attempts, delivery.DeliveredAt)
+	}
+
+	requests := receiver.received()
+	if len(requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(requests))
+	}
+	req := requests[0]
+
+	var event Event
+	if err := json.Unmarshal(req.body, &event); err != nil || event.ID != completedEvent().ID || event.Type != EventAnalysisCompleted {
+		t.Errorf("payload %s, %v, want the completed event", req.body, err)
+	}
+	if got := req.header.Get("X-Webhook-Event"); got != string(EventAnalysisCompleted) {
+		t.Errorf("X-Webhook-Event = %q", got)
+	}
+	if got := req.header.Get("X-Webhook-Delivery"); got != strconv.FormatUint(uint64(delivery.ID), 10) {
+		t.Errorf("X-Webhook-Delivery = %q, want %d", got, delivery.ID)
+	}
+
+	// a receiver verifies the HMAC-SHA256 of "<timestamp>.<payload>" with its copy of the secret
+	timestamp, err := strconv.ParseInt(req.header.Get("X-Webhook-Timestamp"), 10, 64)
+	if err != nil || time.Since(time.Unix(timestamp, 0)) > time.Minute {
+		t.Fatalf("X-Webhook-Timestamp = %q", req.header.Get("X-Webhook-Timestamp"))
+	}
+	mac := hmac.New(sha256.New, []byte(webhook.Secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(req.body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	signature := req.header.Get("X-Webhook-Signature")
+	if signature != want {
+		t.Errorf("X-Webhook-Signature = %q, want %q", signature, want)
+	}
+	if signature != SignWebhookPayload(webhook.Secret, timestamp, req.body) {
+		t.Error("SignWebhookPayload doesn't verify the signature sent")
+	}
+	if SignWebhookPayload("whsec_other", timestamp, req.body) == signature {
+		t.Error("signature verifies with another secret")
+	}
+}
+
+func TestWebhookDeliveryRetries(t *testing.T) {
+	receiver := startWebhookReceiver(t, http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusOK)
+	d := newTestDispatcher(t, 5)
+	webhook := createWebhook(t, d.db, receiver.server.URL)
+
+	queued, err := d.deliver(webhook, completedEvent())
+	if err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	delivery := waitForDelivery(t, d.db, queued.ID, models.DeliveryDelivered)
+
+	if delivery.Attempts != 3 || len(delivery.AttemptLog) != 3 {
+		t.Fatalf("delivered after %d attempts with log %+v, want 3", delivery.Attempts, delivery.AttemptLog)
+	}
+	for i, want := range []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusOK} {
+		if got := delivery.AttemptLog[i]; got.Attempt != i+1 || got.StatusCode != want {
+			t.Errorf("attempt log %d = %+v, want attempt %d with %d", i, got, i+1, want)
+		}
+	}
+	if delivery.AttemptLog[0].Response != "unavailable, try later" {
+		t.Errorf("response of the failed attempt = %q", delivery.AttemptLog[0].Response)
+	}
+
+	// equal jitter waits at least half the backoff, 40ms doubled to 80ms before the third attempt
+	requests := receiver.received()
+	if len(requests) != 3 {
+		t.Fatalf("receiver got %d requests, want 3", len(requests))
+	}
+	for i, minDelay := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond} {
+		if gap := requests[i+1].time.Sub(requests[i].time); gap < minDelay {
+			t.Errorf("attempt %d came %s after the previous one, want a backoff of %s at least", i+2, gap, minDelay)
+		}
+	}
+
+	// every attempt posts the same payload, signed again
+	if string(requests[0].body) != string(requests[2].body) {
+		t.Errorf("payload changed between attempts: %s and %s", requests[0].body, requests[2].body)
+	}
+}
+
+func TestWebhookDeadLetterAndRedelivery(t *testing.T) {
+	receiver := startWebhookReceiver(t, http.StatusBadGateway)
+	d := newTestDispatcher(t, 2)
+	webhook := createWebhook(t, d.db, receiver.server.URL)
+
+	previous := webhooks
+	webhooks = d
+	t.Cleanup(func() { webhooks = previous })
+
+	queued, err := d.deliver(webhook, completedEvent())
+	if err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	delivery := waitForDelivery(t, d.db, queued.ID, models.DeliveryDead)
+	if delivery.Attempts != 2 || delivery.NextAttemptAt != nil || delivery.DeliveredAt != nil {
+		t.Errorf("dead delivery after %d attempts, next at %v, delivered at %v, want 2 and no further attempt", delivery.Attempts, delivery.NextAttemptAt, delivery.DeliveredAt)
+	}
+	// no retry is left behind
+	time.Sleep(150 * time.Millisecond)
+	if n := len(receiver.received()); n != 2 {
+		t.Fatalf("receiver got %d requests, want 2", n)
+	}
+
+	receiver.setScript(http.StatusOK)
+	if err := RedeliverWebhook(d.db, &delivery); err != nil {
+		t.Fatalf("RedeliverWebhook: %v", err)
+	}
+	delivery = waitForDelivery(t, d.db, queued.ID, models.DeliveryDelivered)
+	if delivery.Attempts != 3 || len(delivery.AttemptLog) != 3 || delivery.AttemptLog[2].StatusCode != http.StatusOK {
+		t.Errorf("redelivered after %d attempts with log %+v, want a third one with 200", delivery.Attempts, delivery.AttemptLog)
+	}
+
+	requests := receiver.received()
+	if len(requests) != 3 || string(requests[2].body) != string(requests[0].body) {
+		t.Errorf("receiver got %d requests, want the same payload a third time", len(requests))
+	}
+}
+
+func TestRedeliverWebhookRequiresDispatcher(t *testing.T) {
+	previous := webhooks
+	webhooks = nil
+	t.Cleanup(func() { webhooks = previous })
+
+	if err := RedeliverWebhook(newTestDB(t), &models.WebhookDelivery{ID: 1}); err != ErrWebhooksNotEnabled {
+		t.Errorf("RedeliverWebhook = %v, want ErrWebhooksNotEnabled", err)
+	}
+}
+
+func TestWebhookRedirectRefused(t *testing.T) {
+	target := startWebhookReceiver(t, http.StatusOK)
+	redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.server.URL+"/elsewhere", http.StatusTemporaryRedirect)
+	}))
+	t.Cleanup(redirecting.Close)
+
+	d := newTestDispatcher(t, 1)
+	webhook := createWebhook(t, d.db, redirecting.URL)
+
+	queued, err := d.deliver(webhook, completedEvent())
+	if err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	delivery := waitForDelivery(t, d.db, queued.ID, models.DeliveryDead)
+	if len(delivery.AttemptLog) != 1 || delivery.AttemptLog[0].StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("attempt log %+v, want the redirect as the failed answer", delivery.AttemptLog)
+	}
+	if n := len(target.received()); n != 0 {
+		t.Errorf("the redirect target got %d requests, the payload must only go to the subscribed URL", n)
+	}
+}
+
+func TestWebhookBlockedDestination(t *testing.T) {
+	receiver := startWebhookReceiver(t, http.StatusOK)
+	d := newTestDispatcher(t, 1)
+	// the default policy refuses loopback receivers
+	d.client = guardedHTTPClient(netguard.NewPolicy("", ""), d.opts.timeout)
+	webhook := createWebhook(t, d.db, receiver.server.URL)
+
+	queued, err := d.deliver(webhook, completedEvent())
+	if err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	delivery := waitForDelivery(t, d.db, queued.ID, models.DeliveryDead)
+	if len(delivery.AttemptLog) != 1 || delivery.AttemptLog[0].Error == "" {
+		t.Errorf("attempt log %+v, want the refused destination", delivery.AttemptLog)
+	}
+	if n := len(receiver.received()); n != 0 {
+		t.Errorf("loopback receiver got %d requests", n)
+	}
+}
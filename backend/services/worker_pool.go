@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+	"web-scraper/config"
+	"web-scraper/logging"
+	"web-scraper/metrics"
+	"web-scraper/models"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const defaultNumOfWorkers = 3
+
+const (
+	// leaseDuration is how long a running analysis stays leased by its process without a renewal
+	leaseDuration = time.Minute
+	// leaseRenewInterval leaves two renewals to fail before the lease expires
+	leaseRenewInterval = leaseDuration / 3
+)
+
+// instanceID identifies this process as the owner of the leases of its running analyses
+var instanceID = newInstanceID()
+
+// to cancel a crawl process, cancel funcs are context.CancelCauseFunc
+var runningCrawls sync.Map
+
+var (
+	pool       = newScheduler(0)
+	workersWG  sync.WaitGroup
+	workerRepo Repository
+)
+
+// ErrShuttingDown is the cancellation cause of crawls interrupted by a shutdown, they are re-queued instead of cancelled.
+// EnqueueURL returns it once the shutdown started.
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// ErrCancelledByUser is the cancellation cause of crawls cancelled through the API
+var ErrCancelledByUser = errors.New("cancelled by user")
+
+// analysisJob is a queued analysis, the trace context and request ID travel with it from the API request to the worker
+type analysisJob struct {
+	ID           uint
+	UserID       string
+	Lane         Lane
+	RequestID    string
+	TraceCarrier propagation.MapCarrier
+}
+
+// EnqueueURL queues an analysis of userID in lane. Analyses refused during shutdown keep their queued
+// status and are picked up by RequeueInterrupted on the next start.
+func EnqueueURL(ctx context.Context, id uint, userID string, lane Lane) error {
+	ctx, span := tracer.Start(ctx, "EnqueueURL", trace.WithAttributes(
+		attribute.Int("analysis.id", int(id)),
+		attribute.String("queue.lane", string(lane)),
+	))
+	defer span.End()
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	job := analysisJob{ID: id, UserID: userID, Lane: lane, RequestID: logging.RequestID(ctx), TraceCarrier: carrier}
+	if !pool.push(job) {
+		return ErrShuttingDown
+	}
+	return nil
+}
+
+// StartWorkers starts WORKER_COUNT workers (default 3) storing their analyses in repo. MAX_JOBS_PER_USER
+// limits the analyses of one user running at the same time, 0 (default) means no limit.
+func StartWorkers(repo Repository) {
+	workerRepo = repo
+
+	pool.setMaxJobsPerUser(config.GetEnvInt("MAX_JOBS_PER_USER", 0))
+	metrics.RegisterQueueDepth(func() float64 { return float64(pool.depth()) })
+
+	ResizeWorkers(config.GetEnvInt("WORKER_COUNT", defaultNumOfWorkers))
+}
+
+// ResizeWorkers changes the size of the worker pool at runtime. Workers above the new size retire
+// after their current analysis.
+func ResizeWorkers(size int) {
+	for _, workerId := range pool.resize(size) {
+		startWorker(workerId)
+	}
+}
+
+// SetMaxJobsPerUser changes the per-user concurrency limit, 0 means no limit
+func SetMaxJobsPerUser(limit int) {
+	pool.setMaxJobsPerUser(limit)
+}
+
+// WorkerPoolStatus returns the size, load and queue of the worker pool
+func WorkerPoolStatus() PoolStatus {
+	return pool.status()
+}
+
+func startWorker(workerId int) {
+	workersWG.Add(1)
+	go func() {
+		defer workersWG.Done()
+
+		for {
+			job, ok := pool.pop()
+			if !ok {
+				slog.Debug("Worker stopped", "worker_id", workerId)
+				return
+			}
+			runJob(workerId, job)
+			pool.done(job)
+		}
+	}()
+}
+
+func runJob(workerId int, job analysisJob) {
+	analysisID := job.ID
+
+	jobCtx := otel.GetTextMapPropagator().Extract(context.Background(), job.TraceCarrier)
+	jobCtx, span := tracer.Start(jobCtx, "worker.analysis", trace.WithAttributes(
+		attribute.Int("analysis.id", int(analysisID)),
+		attribute.Int("worker.id", workerId),
+		attribute.String("queue.lane", string(job.Lane)),
+	))
+	defer span.End()
+
+	logger := slog.Default().With("worker_id", workerId, "analysis_id", analysisID, "lane", job.Lane, "request_id", job.RequestID)
+	jobCtx = logging.WithLogger(logging.WithRequestID(jobCtx, job.RequestID), logger)
+
+	ctx, cancel := context.WithCancelCause(jobCtx)
+	defer cancel(nil)
+
+	logger.Debug("Registered crawl context")
+	runningCrawls.Store(analysisID, cancel)
+
+	metrics.ActiveWorkers.Inc()
+	CrawlAndAnalyseURL(ctx, analysisID, workerRepo)
+	metrics.ActiveWorkers.Dec()
+	metrics.LastJobFinished.SetToCurrentTime()
+
+	runningCrawls.Delete(analysisID)
+	logger.Debug("Unregistered crawl context")
+}
+
+// CancelAnalysis cancels the crawl of a running analysis, it reports false when the analysis isn't running
+func CancelAnalysis(id uint) bool {
+	cancel, ok := runningCrawls.LoadAndDelete(id)
+	if ok {
+		cancel.(context.CancelCauseFunc)(ErrCancelledByUser)
+	}
+	return ok
+}
+
+// StopWorkers stops dispatching queued jobs and waits up to gracePeriod for running crawls to finish.
+// Crawls still running after that are interrupted and saved as queued, ctx bounds the wait for those saves.
+func StopWorkers(ctx context.Context, gracePeriod time.Duration) error {
+	pool.close()
+
+	done := make(chan struct{})
+	go func() {
+		workersWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(gracePeriod):
+	}
+
+	var interrupted int
+	runningCrawls.Range(func(key, cancel any) bool {
+		cancel.(context.CancelCauseFunc)(ErrShuttingDown)
+		interrupted++
+		return true
+	})
+	slog.Warn("Shutdown grace period is over, interrupting running crawls", "running", interrupted, "grace_period", gracePeriod)
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("workers did not stop: %w", ctx.Err())
+	}
+}
+
+// RequeueInterrupted queues the analyses a previous process left queued, or running with an expired lease, oldest
+// first, and reschedules pending retries. Analyses running on other live processes keep renewing their leases
+// and are left alone. It must be called after StartWorkers, once per process.
+func RequeueInterrupted(db *gorm.DB) error {
+	var retrying []models.URLAnalysis
+	if err := db.Select("id", "attempts", "next_retry_at").Where("status = ?", "retrying").Find(&retrying).Error; err != nil {
+		return err
+	}
+	for _, analysis := range retrying {
+		var delay time.Duration
+		if analysis.NextRetryAt != nil {
+			delay = max(time.Until(*analysis.NextRetryAt), 0)
+		}
+		scheduleRetry(workerRepo, analysis.ID, analysis.Attempts, delay)
+	}
+
+	now := time.Now()
+	// running rows without a lease were left by a release before leases
+	leaseExpired := db.Where("lease_expires_at IS NULL").Or("lease_expires_at < ?", now)
+
+	var analyses []models.URLAnalysis
+	if err := db.Select("id", "user_id", "lane").
+		Where("status = ?", "queued").
+		Or(db.Where("status = ?", "running").Where(leaseExpired)).
+		Order("updated_at").Find(&analyses).Error; err != nil {
+		return err
+	}
+	if len(analyses) == 0 {
+		return nil
+	}
+
+	if err := db.Model(&models.URLAnalysis{}).Where("status = ?", "running").Where(leaseExpired).Update("status", "queued").Error; err != nil {
+		return err
+	}
+
+	for _, analysis := range analyses {
+		lane, ok := ParseLane(analysis.Lane)
+		if !ok {
+			lane = LaneInteractive
+		}
+		if err := EnqueueURL(context.Background(), analysis.ID, analysis.UserID, lane); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Re-queued interrupted analyses", "count", len(analyses))
+	return nil
+}
+
+// renewLease renews the lease of this process on a running analysis every leaseRenewInterval, until the
+// returned func is called or the analysis isn't running anymore
+func renewLease(ctx context.Context, repo Repository, id uint, logger *slog.Logger) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(leaseRenewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			held, err := repo.RenewLease(ctx, id, instanceID, time.Now().Add(leaseDuration))
+			if err != nil {
+				metrics.DBSaveFailures.WithLabelValues("lease").Inc()
+				logger.Warn("Failed to renew the lease of the analysis", "error", err)
+				continue
+			}
+			if !held {
+				logger.Debug("Analysis isn't running anymore, stopped renewing its lease")
+				return
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// newInstanceID returns the host name with a random suffix, unique per process
+func newInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "worker"
+	}
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	// lease_owner holds 64 characters
+	return fmt.Sprintf("%.55s-%x", host, suffix)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"web-scraper/blobstore"
+	"web-scraper/models"
+	"web-scraper/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetUrlSnapshots lists the archived snapshots of an analysis, newest first
+func GetUrlSnapshots(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	urlAnalysis, ok := findUserAnalysis(c, db, "id")
+	if !ok {
+		return
+	}
+
+	snapshots := []models.Snapshot{}
+	if err := db.Where("url_analysis_id = ?", urlAnalysis.ID).Order("id DESC").Find(&snapshots).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch snapshots " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": urlAnalysis.ID, "snapshots": snapshots})
+}
+
+// DownloadUrlSnapshot serves the WARC file of a snapshot, "latest" picks the newest one
+func DownloadUrlSnapshot(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	urlAnalysis, ok := findUserAnalysis(c, db, "id")
+	if !ok {
+		return
+	}
+
+	query := db.Where("url_analysis_id = ?", urlAnalysis.ID)
+	if param := c.Param("snapshotId"); param == "latest" {
+		query = query.Order("id DESC")
+	} else {
+		snapshotID, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid snapshot ID format"})
+			return
+		}
+		query = query.Where("id = ?", snapshotID)
+	}
+
+	snapshot := models.Snapshot{}
+	if err := query.First(&snapshot).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Snapshot not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch snapshot: " + err.Error()})
+		}
+		return
+	}
+
+	body, err := services.OpenSnapshot(c.Request.Context(), snapshot)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Snapshot file not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read snapshot: " + err.Error()})
+		}
+		return
+	}
+	defer body.Close()
+
+	filename := fmt.Sprintf("analysis-%d-snapshot-%d.warc.gz", snapshot.URLAnalysisID, snapshot.ID)
+	c.DataFromReader(http.StatusOK, snapshot.Size, "application/warc", body, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, filename),
+	})
+}
+
+type ReprocessURLsInput struct {
+	IDs []uint `json:"ids" binding:"required,min=1,max=1000"`
+}
+
+// reprocessError maps a reprocessing failure to its response status and message
+func reprocessError(err error) (int, string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound, "URL analysis not found"
+	case errors.Is(err, services.ErrNoSnapshot), errors.Is(err, blobstore.ErrNotFound):
+		return http.StatusNotFound, "No snapshot to reprocess"
+	case errors.Is(err, services.ErrAnalysisRunning):
+		return http.StatusConflict, "URL analysis is queued or running"
+	default:
+		return http.StatusUnprocessableEntity, "Failed to reprocess: " + err.Error()
+	}
+}
+
+// ReprocessUrl runs the current page analysis again on the stored snapshot of an analysis, without refetching
+func ReprocessUrl(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL ID format"})
+		return
+	}
+
+	urlAnalysis, err := services.ReprocessAnalysis(c.Request.Context(), db, c.GetString("UserID"), uint(id))
+	if err != nil {
+		status, message := reprocessError(err)
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	c.JSON(http.StatusOK, urlAnalysis)
+}
+
+// ReprocessUrls queues many analyses of the caller to be reprocessed in the background, the response reports
+// which were queued. Their reprocessedAt shows when they are done.
+func ReprocessUrls(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	var input ReprocessURLsInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	queued, backlogFull, err := services.QueueReprocess(c.Request.Context(), db, c.GetString("UserID"), input.IDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue reprocessing: " + err.Error()})
+		return
+	}
+
+	results := make([]gin.H, 0, len(input.IDs))
+	seen := map[uint]bool{}
+	for _, id := range input.IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		switch {
+		case slices.Contains(queued, id):
+			results = append(results, gin.H{"id": id, "status": "queued"})
+		case slices.Contains(backlogFull, id):
+			results = append(results, gin.H{"id": id, "error": "Too many analyses are waiting to be reprocessed, try again later"})
+		default:
+			results = append(results, gin.H{"id": id, "error": "URL analysis not found"})
+		}
+	}
+
+	status := http.StatusAccepted
+	if len(queued) == 0 {
+		status = http.StatusBadRequest
+		if len(backlogFull) > 0 {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	c.JSON(status, gin.H{"queued": len(queued), "results": results})
+}
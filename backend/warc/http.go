@@ -0,0 +1,66 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// HTTPRequestBlock serialises the request line and headers of req as sent on the wire, without a body
+func HTTPRequestBlock(req *http.Request) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fmt.Fprintf(&buf, "Host: %s\r\n", host)
+	req.Header.Write(&buf)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// HTTPResponseBlock serialises the status line, headers and body of resp. The body is the decoded one,
+// Go's transport already dropped Content-Encoding and Content-Length when it decompressed it.
+func HTTPResponseBlock(resp *http.Response, body []byte) []byte {
+	var buf bytes.Buffer
+	proto := resp.Proto
+	if proto == "" || proto == "HTTP/2.0" {
+		proto = "HTTP/1.1" // WARC replay tools expect an HTTP/1 message
+	}
+	fmt.Fprintf(&buf, "%s %s\r\n", proto, statusText(resp))
+	header := resp.Header.Clone()
+	header.Del("Transfer-Encoding") // the body is stored unchunked
+	header.Write(&buf)
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func statusText(resp *http.Response) string {
+	if resp.Status != "" {
+		return resp.Status
+	}
+	return fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+}
+
+// ReadHTTPResponse parses a response block written by HTTPResponseBlock. The body is everything after
+// the headers, whatever Content-Length says, so truncated records still load.
+func ReadHTTPResponse(block []byte, req *http.Request) (*http.Response, error) {
+	headerEnd := bytes.Index(block, []byte("\r\n\r\n"))
+	if headerEnd < 0 {
+		return nil, errors.New("invalid HTTP response block, no end of headers")
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(block[:headerEnd+4])), req)
+	if err != nil {
+		return nil, err
+	}
+	body := block[headerEnd+4:]
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.TransferEncoding = nil
+	return resp, nil
+}
@@ -0,0 +1,90 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Reader reads the records of a WARC file, plain or gzip compressed
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader detects gzip compression from the first bytes of r
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		// every record is its own gzip member, the reader runs through all of them
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(zr)
+	}
+	return &Reader{r: br}, nil
+}
+
+// Next returns the next record, io.EOF after the last one
+func (r *Reader) Next() (*Record, error) {
+	line, err := r.readLine()
+	for err == nil && line == "" {
+		line, err = r.readLine() // blank lines between records
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, fmt.Errorf("invalid WARC record version line %q", line)
+	}
+
+	record := &Record{}
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid WARC header line %q", line)
+		}
+		record.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	length, err := strconv.ParseInt(record.Header.Get("Content-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid WARC Content-Length %q", record.Header.Get("Content-Length"))
+	}
+	record.Block = make([]byte, length)
+	if _, err := io.ReadFull(r.r, record.Block); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return record, nil
+}
+
+func (r *Reader) readLine() (string, error) {
+	line, err := r.r.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+// Package warc writes and reads WARC 1.1 files (ISO 28500), the web archive format
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const Version = "WARC/1.1"
+
+// Record types written by this package
+const (
+	TypeWarcinfo = "warcinfo"
+	TypeRequest  = "request"
+	TypeResponse = "response"
+	TypeMetadata = "metadata"
+)
+
+// Content types of HTTP message blocks
+const (
+	ContentTypeHTTPRequest  = "application/http;msgtype=request"
+	ContentTypeHTTPResponse = "application/http;msgtype=response"
+)
+
+// Header holds the named fields of a record in the order they are written
+type Header struct {
+	names  []string
+	values map[string]string
+}
+
+func (h *Header) Set(name, value string) {
+	if h.values == nil {
+		h.values = map[string]string{}
+	}
+	if _, ok := h.values[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.values[name] = value
+}
+
+func (h *Header) Get(name string) string {
+	return h.values[name]
+}
+
+// Record is a single WARC record, Block is its content
+type Record struct {
+	Header Header
+	Block  []byte
+}
+
+// Writer writes records to w, each as its own gzip member when compressed as in ".warc.gz" files
+type Writer struct {
+	w        io.Writer
+	compress bool
+	now      func() time.Time
+}
+
+func NewWriter(w io.Writer, compress bool) *Writer {
+	return &Writer{w: w, compress: compress, now: time.Now}
+}
+
+// NewRecord returns a record of recordType with a fresh WARC-Record-ID and the current WARC-Date
+func (w *Writer) NewRecord(recordType, contentType string, block []byte) *Record {
+	r := &Record{Block: block}
+	r.Header.Set("WARC-Type", recordType)
+	r.Header.Set("WARC-Record-ID", NewRecordID())
+	r.Header.Set("WARC-Date", w.now().UTC().Format(time.RFC3339Nano))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	return r
+}
+
+// WriteRecord writes r with its Content-Length and WARC-Block-Digest filled in
+func (w *Writer) WriteRecord(r *Record) error {
+	r.Header.Set("WARC-Block-Digest", Digest(r.Block))
+	r.Header.Set("Content-Length", strconv.Itoa(len(r.Block)))
+
+	var buf bytes.Buffer
+	buf.WriteString(Version + "\r\n")
+	for _, name := range r.Header.names {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, r.Header.values[name])
+	}
+	buf.WriteString("\r\n")
+	buf.Write(r.Block)
+	buf.WriteString("\r\n\r\n")
+
+	if !w.compress {
+		_, err := w.w.Write(buf.Bytes())
+		return err
+	}
+	zw := gzip.NewWriter(w.w)
+	if _, err := zw.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// NewRecordID returns a random "<urn:uuid:...>" record id
+func NewRecordID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Digest returns the "sha1:<base32>" digest of data used by WARC-Block-Digest and WARC-Payload-Digest
+func Digest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"web-scraper/logging"
+	"web-scraper/models"
+	"web-scraper/netguard"
+	"web-scraper/secrets"
+	"web-scraper/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// deliveries returned by the delivery log endpoints, newest first
+const maxListedDeliveries = 100
+
+type WebhookInput struct {
+	URL    string   `json:"url" binding:"required,url,max=2048"`
+	Events []string `json:"events" binding:"required,min=1"`
+	// defaults to true
+	Active *bool `json:"active"`
+	// replace the signing secret, the new one is returned once
+	RotateSecret bool `json:"rotateSecret"`
+}
+
+// validate checks the events exist and the receiver is reachable under the SSRF policy
+func (input WebhookInput) validate(c *gin.Context) bool {
+	for _, event := range input.Events {
+		if !slices.Contains(services.EventTypes, services.EventType(event)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event type: " + event, "eventTypes": services.EventTypes})
+			return false
+		}
+	}
+	if err := netguard.Default().ValidateURL(c.Request.Context(), input.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook URL is not allowed: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// applyTo copies everything but the owner and the secret onto webhook
+func (input WebhookInput) applyTo(webhook *models.Webhook) {
+	webhook.URL = strings.TrimSpace(input.URL)
+	webhook.Events = models.StringList{}
+	for _, event := range input.Events {
+		if !slices.Contains(webhook.Events, event) {
+			webhook.Events = append(webhook.Events, event)
+		}
+	}
+	webhook.Active = input.Active == nil || *input.Active
+}
+
+// webhookResponse describes a webhook, the secret is only included when given
+func webhookResponse(webhook models.Webhook, secret models.EncryptedString) gin.H {
+	response := gin.H{
+		"id":        webhook.ID,
+		"url":       webhook.URL,
+		"events":    webhook.Events,
+		"active":    webhook.Active,
+		"createdAt": webhook.CreatedAt,
+		"updatedAt": webhook.UpdatedAt,
+	}
+	if secret != "" {
+		response["secret"] = secret
+	}
+	return response
+}
+
+// findUserWebhook loads the webhook with the id of the request path, making sure it belongs to the caller
+func findUserWebhook(c *gin.Context, db *gorm.DB) (models.Webhook, bool) {
+	var webhook models.Webhook
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID format"})
+		return webhook, false
+	}
+
+	result := db.Where("user_id = ?", c.GetString("UserID")).First(&webhook, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhook: " + result.Error.Error()})
+		}
+		return webhook, false
+	}
+
+	return webhook, true
+}
+
+func webhookSaveError(c *gin.Context, err error) {
+	if errors.Is(err, secrets.ErrKeyNotConfigured) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Webhooks are disabled: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save webhook: " + err.Error()})
+}
+
+// CreateWebhook subscribes the caller to events, the response carries the signing secret, it isn't shown again
+func CreateWebhook(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	var input WebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !input.validate(c) {
+		return
+	}
+
+	webhook := models.Webhook{UserID: c.GetString("UserID"), Secret: services.NewWebhookSecret()}
+	input.applyTo(&webhook)
+
+	if err := db.Create(&webhook).Error; err != nil {
+		webhookSaveError(c, err)
+		return
+	}
+
+	logging.FromContext(c.Request.Context()).Info("Webhook created", "webhook_id", webhook.ID, "events", webhook.Events)
+	c.JSON(http.StatusCreated, webhookResponse(webhook, webhook.Secret))
+}
+
+func GetWebhooks(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	// the secret isn't listed, leaving it out spares its decryption
+	webhooks := []models.Webhook{}
+	if err := db.Omit("secret").Where("user_id = ?", c.GetString("UserID")).Find(&webhooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch webhooks " + err.Error()})
+		return
+	}
+
+	response := make([]gin.H, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		response = append(response, webhookResponse(webhook, ""))
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": response, "eventTypes": services.EventTypes})
+}
+
+func GetWebhook(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	webhook, ok := findUserWebhook(c, db)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, webhookResponse(webhook, ""))
+}
+
+// UpdateWebhook replaces the URL, events and active flag of a webhook, optionally with a new secret
+func UpdateWebhook(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	webhook, ok := findUserWebhook(c, db)
+	if !ok {
+		return
+	}
+
+	var input WebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !input.validate(c) {
+		return
+	}
+
+	input.applyTo(&webhook)
+	var newSecret models.EncryptedString
+	if input.RotateSecret {
+		newSecret = services.NewWebhookSecret()
+		webhook.Secret = newSecret
+	}
+
+	if err := db.Save(&webhook).Error; err != nil {
+		webhookSaveError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, webhookResponse(webhook, newSecret))
+}
+
+// DeleteWebhook removes a subscription, its pending deliveries end up in the dead letters
+func DeleteWebhook(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	webhook, ok := findUserWebhook(c, db)
+	if !ok {
+		return
+	}
+
+	if err := db.Delete(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted", "id": webhook.ID})
+}
+
+// PingWebhook sends a webhook.ping event, the delivery shows how the receiver answered
+func PingWebhook(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	webhook, ok := findUserWebhook(c, db)
+	if !ok {
+		return
+	}
+
+	delivery, err := services.SendWebhookPing(webhook)
+	if err != nil {
+		if errors.Is(err, services.ErrWebhooksNotEnabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send ping: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// GetWebhookDeliveries returns the delivery log of a webhook, newest first, ?status= filters it
+func GetWebhookDeliveries(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	webhook, ok := findUserWebhook(c, db)
+	if !ok {
+		return
+	}
+
+	query := db.Where("webhook_id = ?", webhook.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	if err := query.Order("id DESC").Limit(maxListedDeliveries).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch webhook deliveries " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": webhook.ID, "deliveries": deliveries})
+}
+
+// GetDeadLetters lists the deliveries of all webhooks of the caller that ran out of attempts, newest first
+func GetDeadLetters(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	deliveries := []models.WebhookDelivery{}
+	if err := db.Where("user_id = ? AND status = ?", c.GetString("UserID"), models.DeliveryDead).Order("id DESC").Limit(maxListedDeliveries).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch dead letters " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// RedeliverWebhook sends a delivery of a webhook again, typically one from the dead letters
+func RedeliverWebhook(c *gin.Context) {
+	dbInstance, exists := c.Get("db")
+	if !exists {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database instance not found"})
+		return
+	}
+
+	db := dbInstance.(*gorm.DB)
+
+	webhook, ok := findUserWebhook(c, db)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := strconv.ParseInt(c.Param("deliveryId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID format"})
+		return
+	}
+
+	var delivery models.WebhookDelivery
+	if err := db.Where("webhook_id = ?", webhook.ID).First(&delivery, deliveryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch delivery: " + err.Error()})
+		}
+		return
+	}
+	if delivery.Status == models.DeliveryPending || delivery.Status == models.DeliveryRetrying {
+		c.JSON(http.StatusConflict, gin.H{"error": "Delivery is still being attempted", "status": delivery.Status})
+		return
+	}
+
+	if err := services.RedeliverWebhook(db, &delivery); err != nil {
+		if errors.Is(err, services.ErrWebhooksNotEnabled) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeliver: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
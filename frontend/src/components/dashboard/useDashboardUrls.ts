@@ -45,7 +45,9 @@ export function useDashboardUrls() {
     for (const url of runningUrls) {
       switch (url.status) {
         case 'done': completed++; break;
+        case 'partial': completed++; break;
         case 'queued': queued++; break;
+        case 'retrying': queued++; break;
         case 'running': running++; break;
         case 'error': errored++; break;
         case 'errored': errored++; break;